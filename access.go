@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Name of the per-directory access control file. It protects the directory
+// holding it and everything below, and is never listed or served.
+//
+//	# comments are allowed
+//	password: s3cret
+//	users: alice, bob
+//	roles: admin
+//
+// A request is allowed when its identity is one of the users, has one of the
+// roles, or carries the cookie the password form at /unlock sets for the
+// directory. Without basic auth logins, the password is also accepted as the
+// basic auth password, for scripts.
+const accessFileName = ".fbaccess"
+
+// Prefix of the cookies remembering unlocked directories, followed by a
+// hash of the directory's path
+const accessCookiePrefix = "filebrowser-access-"
+
+// Key of the unlock cookies' HMACs. It is generated at startup, so unlocked
+// directories lock again when the server restarts.
+var accessCookieKey = func() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}()
+
+// Rules read from a .fbaccess file
+type AccessRule struct {
+	Password string
+	Users    []string
+	Roles    []string
+}
+
+// Authenticated client, attached to the request context by the auth layer
+type Identity struct {
+	Name  string
+	Roles []string
+}
+
+type identityKey struct{}
+
+func withIdentity(r *http.Request, id *Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id))
+}
+
+func requestIdentity(r *http.Request) *Identity {
+	id, _ := r.Context().Value(identityKey{}).(*Identity)
+	return id
+}
+
+func loadAccessRule(dir string) (*AccessRule, error) {
+	f, err := os.Open(filepath.Join(dir, accessFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rule := &AccessRule{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key: value", accessFileName, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "password":
+			rule.Password = value
+		case "users":
+			rule.Users = append(rule.Users, splitList(value)...)
+		case "roles":
+			rule.Roles = append(rule.Roles, splitList(value)...)
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown key %q", accessFileName, lineNo, key)
+		}
+	}
+	return rule, scanner.Err()
+}
+
+// accessCookieName returns the name of the cookie unlocking dir.
+func accessCookieName(dir string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(dir)))
+	return accessCookiePrefix + hex.EncodeToString(sum[:8])
+}
+
+// accessCookieValue returns the content of the cookie unlocking dir with
+// password; changing the password invalidates the cookies issued for it.
+func accessCookieValue(dir, password string) string {
+	mac := hmac.New(sha256.New, accessCookieKey)
+	fmt.Fprintf(mac, "%s\x00%s", filepath.ToSlash(dir), password)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// allows reports whether r passes rule, read from the access file of dir.
+func (rule *AccessRule) allows(r *http.Request, dir string) bool {
+	if rule.Password == "" && len(rule.Users) == 0 && len(rule.Roles) == 0 {
+		return true
+	}
+	if id := requestIdentity(r); id != nil {
+		if slices.Contains(rule.Users, id.Name) {
+			return true
+		}
+		for _, role := range id.Roles {
+			if slices.Contains(rule.Roles, role) {
+				return true
+			}
+		}
+	}
+	if rule.Password == "" {
+		return false
+	}
+	if cookie, err := r.Cookie(accessCookieName(dir)); err == nil &&
+		hmac.Equal([]byte(cookie.Value), []byte(accessCookieValue(dir, rule.Password))) {
+		return true
+	}
+	// With basic auth logins the header holds the user's own password
+	if _, pass, ok := r.BasicAuth(); ok && !authEnabled() {
+		return subtle.ConstantTimeCompare([]byte(pass), []byte(rule.Password)) == 1
+	}
+	return false
+}
+
+// accessDirs returns the directories whose access files apply to dir, from
+// the files dir down to dir itself, or false when dir is outside it. When
+// symlinks lead dir elsewhere below the files dir, the directories above its
+// real location follow.
+func accessDirs(dir string) ([]string, bool) {
+	rel, err := filepath.Rel(filesDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, false
+	}
+	dirs := appendAccessDirs([]string{filesDir}, rel)
+	if real, ok := realURLPath(dir); ok {
+		if realRel := filepath.FromSlash(strings.TrimPrefix(real, "/")); realRel != "" && realRel != rel {
+			dirs = appendAccessDirs(dirs, realRel)
+		}
+	}
+	return dirs, true
+}
+
+// appendAccessDirs appends the directories from the files dir down to rel,
+// skipping those already in dirs.
+func appendAccessDirs(dirs []string, rel string) []string {
+	if rel == "." {
+		return dirs
+	}
+	current := filesDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		if !slices.Contains(dirs, current) {
+			dirs = append(dirs, current)
+		}
+	}
+	return dirs
+}
+
+// checkAccess evaluates every .fbaccess file from the files dir down to dir.
+// Unreadable or malformed access files deny access.
+func checkAccess(r *http.Request, dir string) bool {
+	dirs, ok := accessDirs(dir)
+	if !ok {
+		return false
+	}
+	for _, current := range dirs {
+		rule, err := loadAccessRule(current)
+		if err != nil {
+			slog.Warn("Denying access", "path", current, "err", err)
+			return false
+		}
+		if rule != nil && !rule.allows(r, current) {
+			return false
+		}
+	}
+	return true
+}
+
+// denyAccess answers a request refused by an access file: pages get the
+// password form, other clients a plain 401.
+func denyAccess(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") && !wantsJSON(r) {
+		target := r.URL.Path
+		if p := r.URL.Query().Get("path"); p != "" {
+			target = path.Clean("/" + p)
+		}
+		serveUnlockForm(w, r, http.StatusForbidden, target, r.URL.RequestURI(), "")
+		return
+	}
+	if !authEnabled() {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", title))
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// unlockHandler checks a password posted from the unlock form against the
+// access files protecting "path" and sets a cookie for each directory it
+// opens, then sends the browser back to "next".
+func unlockHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := requestValues(r, "path", "password", "next")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	urlPath := path.Clean("/" + req["path"])
+	fullPath := resolvePath(urlPath)
+	if !withinRoot(fullPath) {
+		notFound(w, r)
+		return
+	}
+	dir := fullPath
+	if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+		dir = filepath.Dir(fullPath)
+	}
+	dirs, ok := accessDirs(dir)
+	if !ok {
+		notFound(w, r)
+		return
+	}
+
+	unlocked := false
+	for _, current := range dirs {
+		rule, err := loadAccessRule(current)
+		if err != nil || rule == nil || rule.Password == "" ||
+			subtle.ConstantTimeCompare([]byte(req["password"]), []byte(rule.Password)) != 1 {
+			continue
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     accessCookieName(current),
+			Value:    accessCookieValue(current, rule.Password),
+			Path:     prefixURL("/"),
+			HttpOnly: true,
+			Secure:   requestScheme(r) == "https",
+			SameSite: http.SameSiteLaxMode,
+		})
+		unlocked = true
+	}
+	if !unlocked {
+		slog.Warn("Wrong access file password", "path", urlPath, "client", clientIP(r))
+		if wantsJSON(r) {
+			writeJSONError(w, "Wrong password", http.StatusForbidden)
+			return
+		}
+		serveUnlockForm(w, r, http.StatusForbidden, urlPath, req["next"], "Wrong password")
+		return
+	}
+
+	recordAudit(r, "unlock", urlPath)
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"path": urlPath})
+		return
+	}
+	next := req["next"]
+	// Only paths on this server, not //host or /\host
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = urlPath
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+var unlockTmpl = template.Must(template.New("unlock").Funcs(template.FuncMap{
+	"url": prefixURL,
+}).Parse(unlockTemplate))
+
+func serveUnlockForm(w http.ResponseWriter, r *http.Request, status int, urlPath, next, message string) {
+	lang := requestLanguage(r)
+	if message == "" {
+		message = "This folder is protected by a password."
+	}
+	var buf strings.Builder
+	data := struct {
+		Path, Next, CSRFToken string
+		Message, Label        string
+		Button                string
+	}{urlPath, next, csrfToken(w, r), translate(lang, message), translate(lang, "Password"), translate(lang, "Unlock")}
+	if err := unlockTmpl.Execute(&buf, data); err != nil {
+		slog.Error("Error rendering unlock form", "err", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	name := translate(lang, "Password required")
+	serveDocument(w, r, urlPath, Document{
+		Status:      status,
+		Content:     template.HTML(buf.String()),
+		Name:        name,
+		Breadcrumbs: append(buildBreadcrumbs(strings.TrimSuffix(path.Dir(urlPath), "/")+"/"), Crumb{Label: name, URL: ""}),
+	})
+}
+
+const unlockTemplate = `<p class="search-summary">{{.Message}}</p>
+<form method="post" action="{{url "/unlock"}}">
+  <input type="hidden" name="csrf" value="{{.CSRFToken}}">
+  <input type="hidden" name="path" value="{{.Path}}">
+  <input type="hidden" name="next" value="{{.Next}}">
+  <input type="password" name="password" placeholder="{{.Label}}" aria-label="{{.Label}}" required autofocus>
+  <button type="submit">{{.Button}}</button>
+</form>`
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
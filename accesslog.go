@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Timestamp layout of the Common Log Format
+const accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+var accessLogger *log.Logger
+
+// openAccessLog opens the ACCESS_LOG destination: stdout, stderr or a file
+// appended to and rotated like LOG_FILE.
+func openAccessLog(dest string) (io.Writer, error) {
+	switch dest {
+	case "stdout", "-":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return openLogFile(dest)
+}
+
+// Response writer recording the status and body size for the access log
+// and metrics
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withAccessLog writes a line per request in the Common or Combined Log
+// Format. The extended format appends the duration in microseconds, like
+// Apache's %D.
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		user := "-"
+		if name, _, ok := r.BasicAuth(); ok && name != "" {
+			user = name
+		}
+		size := "-"
+		if rec.bytes > 0 {
+			size = strconv.FormatInt(rec.bytes, 10)
+		}
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		line := fmt.Sprintf("%s - %s [%s] %q %d %s", clientIP(r), user, start.Format(accessLogTimeLayout),
+			r.Method+" "+r.RequestURI+" "+r.Proto, status, size)
+		if accessLogFormat != "common" {
+			line += fmt.Sprintf(" %q %q", orDefault(r.Referer(), "-"), orDefault(r.UserAgent(), "-"))
+		}
+		if accessLogFormat == "extended" {
+			line += " " + strconv.FormatInt(time.Since(start).Microseconds(), 10)
+		}
+		accessLogger.Print(line)
+	})
+}
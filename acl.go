@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type Permission uint8
+
+const (
+	PermRead Permission = 1 << iota
+	PermWrite
+	PermList
+)
+
+// Access rule from the ACL file. Subject is "*" for everyone, "role:NAME"
+// for identities holding a role, or a user/token name.
+type ACLRule struct {
+	Prefix  string
+	Subject string
+	Perms   Permission
+}
+
+var aclRules []ACLRule
+
+// Routes whose handlers check every path they touch with permitted. With an
+// ACL loaded, anonymous clients get past basic auth on these only, so the
+// ACL decides what they see; /unlock only sets access file cookies.
+var aclRoutes = map[string]bool{
+	"/":                 true,
+	"/upload":           true,
+	"/upload/chunk":     true,
+	"/archive":          true,
+	"/unlock":           true,
+	"/rename":           true,
+	"/mkdir":            true,
+	"/delete":           true,
+	"/move":             true,
+	"/thumb/":           true,
+	"/preview":          true,
+	"/exif":             true,
+	"/checksum":         true,
+	"/qr":               true,
+	"/search":           true,
+	"/tree":             true,
+	"/versions":         true,
+	"/versions/restore": true,
+	"/share":            true,
+	"/sign":             true,
+}
+
+// aclRoute reports whether routes dispatches r to one of aclRoutes.
+func aclRoute(routes *http.ServeMux, r *http.Request) bool {
+	_, pattern := routes.Handler(r)
+	return aclRoutes[pattern]
+}
+
+// loadACL reads an ACL file with one "prefix subject permissions" rule per
+// line, where permissions is a comma separated list of read, write, list or
+// the single word deny.
+func loadACL(file string) ([]ACLRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseACL(f, file)
+}
+
+// parseACL reads the rules of an ACL file, named file in errors. Prefixes
+// are stored in NFC, the form permitted compares paths in.
+func parseACL(r io.Reader, file string) ([]ACLRule, error) {
+	var rules []ACLRule
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: expected prefix subject permissions", file, lineNo)
+		}
+		rule := ACLRule{Prefix: aclPath(fields[0]), Subject: fields[1]}
+		for _, perm := range splitList(fields[2]) {
+			switch perm {
+			case "read":
+				rule.Perms |= PermRead
+			case "write":
+				rule.Perms |= PermWrite
+			case "list":
+				rule.Perms |= PermList
+			case "deny":
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown permission %q", file, lineNo, perm)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// specificity ranks how closely the rule subject matches id, or -1 when it
+// doesn't apply to id at all.
+func (rule ACLRule) specificity(id *Identity) int {
+	switch {
+	case rule.Subject == "*":
+		return 0
+	case id == nil:
+		return -1
+	case strings.HasPrefix(rule.Subject, "role:"):
+		if slices.Contains(id.Roles, strings.TrimPrefix(rule.Subject, "role:")) {
+			return 1
+		}
+		return -1
+	case rule.Subject == id.Name:
+		return 2
+	default:
+		return -1
+	}
+}
+
+// aclPath cleans urlPath and converts it to NFC, so rules match whichever
+// normalization form a client spells a name in; resolvePath serves the same
+// file for all of them.
+func aclPath(urlPath string) string {
+	return norm.NFC.String(path.Clean("/" + urlPath))
+}
+
+func (rule ACLRule) matchesPath(urlPath string) bool {
+	return rule.Prefix == "/" || urlPath == rule.Prefix || strings.HasPrefix(urlPath, rule.Prefix+"/")
+}
+
+// permitted reports whether the request may perform perm on urlPath. The
+// rule with the longest matching prefix wins, ties going to the most specific
+// subject. Without a matching rule, the request is allowed unless it is
+// anonymous while basic auth is enabled, which keeps auth-only behaviour.
+// Paths reached through symlinks must also be permitted where they lead.
+func permitted(r *http.Request, urlPath string, perm Permission) bool {
+	if len(aclRules) == 0 {
+		return true
+	}
+	urlPath = aclPath(urlPath)
+	id := requestIdentity(r)
+	if !permittedPath(id, urlPath, perm) {
+		return false
+	}
+	if real, ok := realURLPath(resolvePath(urlPath)); ok && aclPath(real) != urlPath {
+		return permittedPath(id, aclPath(real), perm)
+	}
+	return true
+}
+
+func permittedPath(id *Identity, urlPath string, perm Permission) bool {
+	var best *ACLRule
+	bestSpecificity := -1
+	for i := range aclRules {
+		rule := &aclRules[i]
+		if !rule.matchesPath(urlPath) {
+			continue
+		}
+		specificity := rule.specificity(id)
+		if specificity < 0 {
+			continue
+		}
+		if best == nil || len(rule.Prefix) > len(best.Prefix) ||
+			(len(rule.Prefix) == len(best.Prefix) && specificity > bestSpecificity) {
+			best, bestSpecificity = rule, specificity
+		}
+	}
+	if best == nil {
+		return id != nil || !authEnabled()
+	}
+	return best.Perms&perm != 0
+}
+
+// denyPermission asks anonymous clients to log in and rejects everyone else.
+func denyPermission(w http.ResponseWriter, r *http.Request) {
+	if requestIdentity(r) == nil && authEnabled() {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", authRealm))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	serveError(w, r, http.StatusForbidden, "Forbidden")
+}
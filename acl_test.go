@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func TestRequireAuthAnonymousACLRoutes(t *testing.T) {
+	defer func(user, pass string, rules []ACLRule) {
+		authUser, authPass, aclRules = user, pass, rules
+	}(authUser, authPass, aclRules)
+	authUser, authPass = "alice", "pw"
+	aclRules = []ACLRule{{Prefix: "/public", Subject: "*", Perms: PermRead | PermList}}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	mux := http.NewServeMux()
+	mux.Handle("/", ok)
+	mux.Handle("/thumb/", ok)
+	mux.Handle("/metrics", ok)
+	mux.Handle("/admin", ok)
+	mux.Handle("/api/openapi.json", ok)
+	handler := requireAuth(mux, mux)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/public/file.txt", http.StatusOK},
+		{"/thumb/public/photo.jpg", http.StatusOK},
+		{"/metrics", http.StatusUnauthorized},
+		{"/admin", http.StatusUnauthorized},
+		{"/api/openapi.json", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			if w.Code != tt.want {
+				t.Errorf("anonymous GET %s = %d, want %d", tt.path, w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseACL(t *testing.T) {
+	rules, err := parseACL(strings.NewReader(`# comment
+
+/public    *           read,list
+private/   alice       read,write,list
+/team      role:staff  write
+/`+norm.NFD.String("café")+`      *   deny
+`), "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ACLRule{
+		{Prefix: "/public", Subject: "*", Perms: PermRead | PermList},
+		{Prefix: "/private", Subject: "alice", Perms: PermRead | PermWrite | PermList},
+		{Prefix: "/team", Subject: "role:staff", Perms: PermWrite},
+		{Prefix: "/" + norm.NFC.String("café"), Subject: "*", Perms: 0},
+	}
+	if !slices.Equal(rules, want) {
+		t.Errorf("parseACL = %+v, want %+v", rules, want)
+	}
+
+	for _, bad := range []string{"/public *", "/public * read extra", "/public * execute"} {
+		if _, err := parseACL(strings.NewReader(bad), "acl"); err == nil {
+			t.Errorf("parseACL(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPermitted(t *testing.T) {
+	defer func(user string, rules []ACLRule) {
+		authUser, aclRules = user, rules
+	}(authUser, aclRules)
+	rules, err := parseACL(strings.NewReader(`
+/public          *           read,list
+/public/drafts   *           deny
+/public/drafts   role:staff  read,list
+/private         *           deny
+/private         role:staff  read,list
+/private         alice       read,write,list
+/café            *           deny
+`), "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	aclRules = rules
+
+	alice := &Identity{Name: "alice", Roles: []string{"staff"}}
+	bob := &Identity{Name: "bob", Roles: []string{"staff"}}
+	carol := &Identity{Name: "carol"}
+	tests := []struct {
+		name     string
+		authUser string
+		id       *Identity
+		path     string
+		perm     Permission
+		want     bool
+	}{
+		{"anonymous reads public", "admin", nil, "/public/a.txt", PermRead, true},
+		{"anonymous can't write public", "admin", nil, "/public/a.txt", PermWrite, false},
+		{"prefix stops at segment", "admin", nil, "/publicity/a.txt", PermRead, false},
+		{"cleaned path", "admin", nil, "/public/../private/a.txt", PermRead, false},
+		{"longer prefix wins", "admin", nil, "/public/drafts/a.txt", PermRead, false},
+		{"role on longer prefix", "admin", bob, "/public/drafts/a.txt", PermRead, true},
+		{"role beats everyone", "admin", bob, "/private/a.txt", PermRead, true},
+		{"role without write", "admin", bob, "/private/a.txt", PermWrite, false},
+		{"user beats role", "admin", alice, "/private/a.txt", PermWrite, true},
+		{"no role", "admin", carol, "/private/a.txt", PermRead, false},
+		{"no rule, logged in", "admin", carol, "/other/a.txt", PermRead, true},
+		{"no rule, anonymous with auth", "admin", nil, "/other/a.txt", PermRead, false},
+		{"no rule, anonymous without auth", "", nil, "/other/a.txt", PermRead, true},
+		{"NFC spelling", "", nil, "/" + norm.NFC.String("café") + "/a.txt", PermRead, false},
+		{"NFD spelling", "", nil, "/" + norm.NFD.String("café") + "/a.txt", PermRead, false},
+		{"read or list", "admin", nil, "/public/a.txt", PermRead | PermList, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authUser = tt.authUser
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.id != nil {
+				r = withIdentity(r, tt.id)
+			}
+			if got := permitted(r, tt.path, tt.perm); got != tt.want {
+				t.Errorf("permitted(%s, %q) = %v, want %v", tt.name, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathHandlerChecksACLBeforeStat(t *testing.T) {
+	defer func(dir, user, pass string, rules []ACLRule) {
+		filesDir, authUser, authPass, aclRules = dir, user, pass, rules
+	}(filesDir, authUser, authPass, aclRules)
+	filesDir = t.TempDir()
+	authUser, authPass = "alice", "pw"
+	aclRules = []ACLRule{{Prefix: "/private", Subject: "*", Perms: 0}}
+	if err := os.MkdirAll(filepath.Join(filesDir, "private"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filesDir, "private", "exists.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"/private/exists.txt", "/private/missing.txt"} {
+		w := httptest.NewRecorder()
+		pathHandler(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("anonymous GET %s = %d, want %d", p, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestUploadChecksTargetBeforeCreatingIt(t *testing.T) {
+	withTestTree(t, map[string]string{"readonly/.keep": ""})
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(filesDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	aclRules = []ACLRule{
+		{Prefix: "/", Subject: "*", Perms: PermRead | PermWrite | PermList},
+		{Prefix: "/readonly", Subject: "*", Perms: PermRead | PermList},
+	}
+
+	for _, dir := range []string{"/readonly/new", "/escape/new"} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("dir", dir)
+		part, _ := mw.CreateFormFile("file", "a.txt")
+		part.Write([]byte("hello"))
+		mw.Close()
+		r := httptest.NewRequest("POST", "/upload", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		uploadHandler(w, r)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("upload to %s: status = %d, want 403", dir, w.Code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, "readonly", "new")); !os.IsNotExist(err) {
+		t.Errorf("directory created without write permission: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("directory created outside the root: %v", err)
+	}
+}
+
+func TestSymlinksFollowTargetRules(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"private/docs/a.txt": "",
+		"locked/.fbaccess":   "password: s3cret\n",
+		"locked/docs/b.txt":  "",
+		"public/a.txt":       "",
+	})
+	for link, target := range map[string]string{"private": "../private/docs", "locked": "../locked/docs"} {
+		if err := os.Symlink(target, filepath.Join(filesDir, "public", link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aclRules = []ACLRule{
+		{Prefix: "/", Subject: "*", Perms: PermRead | PermList},
+		{Prefix: "/private", Subject: "*", Perms: 0},
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	if !permitted(r, "/public/a.txt", PermRead) {
+		t.Error("file below /public refused")
+	}
+	for _, p := range []string{"/public/private", "/public/private/a.txt"} {
+		if permitted(r, p, PermRead) {
+			t.Errorf("%s permitted under the rules of /public", p)
+		}
+	}
+	if !checkAccess(r, filepath.Join(filesDir, "public")) {
+		t.Error("access to /public refused")
+	}
+	if checkAccess(r, filepath.Join(filesDir, "public", "locked")) {
+		t.Error("access file of the link's target ignored")
+	}
+}
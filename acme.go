@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/tls"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// Default HTTPS address with ACME, the port certificates are issued for
+	acmeHTTPSAddr = ":443"
+	// Answers HTTP-01 challenges and redirects everything else to HTTPS
+	acmeHTTPAddr = ":80"
+)
+
+// acmeTLSConfig returns a TLS config obtaining certificates automatically
+// for acmeDomains, which must resolve to this host and reach it on ports 80
+// and 443, and starts the challenge listener on port 80. Certificates are
+// cached in acmeCacheDir so restarts do not request new ones.
+func acmeTLSConfig() *tls.Config {
+	manager := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(acmeDomains...),
+		Cache:      autocert.DirCache(acmeCacheDir),
+		Email:      acmeEmail,
+	}
+	if acmeDirectoryURL != "" {
+		manager.Client = &acme.Client{DirectoryURL: acmeDirectoryURL}
+	}
+
+	go func() {
+		fatal("ACME challenge server stopped", "err", newServer(acmeHTTPAddr, manager.HTTPHandler(nil)).ListenAndServe())
+	}()
+	return manager.TLSConfig()
+}
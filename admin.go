@@ -0,0 +1,465 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setting shown on the admin dashboard
+type ConfigEntry struct {
+	Name  string
+	Value string
+}
+
+func effectiveConfig() []ConfigEntry {
+	return []ConfigEntry{
+		{"Files dir", filesDir},
+		{"HTTP address", orDefault(httpAddr, "(disabled)")},
+		{"HTTPS address", orDefault(httpsAddr, "(disabled)")},
+		{"Uploads", strconv.FormatBool(enableUpload)},
+		{"Read-only", strconv.FormatBool(readOnly.Load())},
+		{"Metrics", strconv.FormatBool(enableMetrics)},
+		{"Name normalization", normalizeNames},
+		{"Upload staging dir", orDefault(uploadTmpDir, "(target directory)")},
+		{"Max upload size", formatLimit(maxUploadSize)},
+		{"Upload concurrency", strconv.Itoa(uploadConcurrency)},
+		{"Confirm drop uploads", strconv.FormatBool(confirmDropUpload)},
+		{"Kept versions", formatKeepVersions()},
+		{"Shared links", formatShares()},
+		{"Trash", orDefault(trashDir, "(disabled, deletes are permanent)")},
+		{"Signed URLs", formatSignedURLs()},
+		{"Upload types", uploadTypes.String()},
+		{"Quotas", quotaSummary()},
+		{"Listing page size", formatPageSize()},
+		{"Hide dotfiles", strconv.FormatBool(hideDotfiles)},
+		{"Block .fbignore matches", strconv.FormatBool(blockIgnored)},
+		{"Serve index.html", strconv.FormatBool(serveIndex)},
+		{"Precompressed files", strconv.FormatBool(servePrecompressedFiles)},
+		{"Templates dir", orDefault(templatesDir, "(embedded)")},
+		{"Custom CSS", orDefault(customCSSFile, "(none)")},
+		{"Custom footer", orDefault(customFooterFile, "(none)")},
+		{"Theme", theme},
+		{"Language", orDefault(uiLanguage, "(Accept-Language)")},
+		{"Time zone", displayLocation.String()},
+		{"Date format", dateFormat},
+		{"Relative dates", strconv.FormatBool(relativeDates)},
+		{"Size units", sizeUnits},
+		{"Exact sizes", strconv.FormatBool(exactSizes)},
+		{"Logo", orDefault(logoFile, "(none)")},
+		{"Favicon", orDefault(faviconFile, "(emoji)")},
+		{"Transfer limits", formatTransferLimits()},
+		{"Timeouts", formatTimeouts()},
+		{"ACME domains", orDefault(strings.Join(acmeDomains, ", "), "(disabled)")},
+		{"HTTP/3", strconv.FormatBool(enableHTTP3)},
+		{"Access log", formatAccessLog()},
+		{"Log", strings.ToLower(logLevel) + " (" + strings.ToLower(logFormat) + ")"},
+		{"Log file", formatLogFile()},
+		{"Tracing", formatTracing()},
+		{"pprof", formatPprof()},
+		{"CSRF protection", strconv.FormatBool(csrfProtection)},
+		{"Security headers", formatSecurityHeaders()},
+		{"CORS", formatCORS()},
+		{"IP rules", formatIPRules()},
+		{"Trusted proxies", formatTrustedProxies()},
+		{"Base URL", orDefault(baseURL, "/")},
+		{"SPA fallback", strconv.FormatBool(spaFallback)},
+		{"Error pages", orDefault(errorPagesDir, "(built-in)")},
+		{"Symlink roots", orDefault(strings.Join(symlinkRoots, ", "), "(root only)")},
+		{"Directory sizes", formatDirSizes()},
+		{"Thumbnails", formatThumbnails()},
+		{"Content index", formatContentIndex()},
+		{"Virus scanning", orDefault(clamdAddress, "disabled")},
+		{"Build", GitCommit + " | " + BuildDate},
+	}
+}
+
+// isAdmin reports whether the request carries admin credentials, either via
+// an identity with the admin role or the ADMIN_USER/ADMIN_PASS pair.
+func isAdmin(r *http.Request) bool {
+	if id := requestIdentity(r); id != nil && slices.Contains(id.Roles, "admin") {
+		return true
+	}
+	if adminPass == "" {
+		return false
+	}
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(adminUser)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(adminPass)) == 1
+	return userOK && passOK
+}
+
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if isAdmin(r) {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", title+" admin"))
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	requests, requestErrors := requestCounts()
+	stats := []ConfigEntry{
+		{"Uptime", time.Since(startTime).Truncate(time.Second).String()},
+		{"Goroutines", strconv.Itoa(runtime.NumGoroutine())},
+		{"Heap in use", formatSize(int64(m.HeapAlloc))},
+		{"Requests", fmt.Sprintf("%d (%d ok, %d errors)", requests, requests-requestErrors, requestErrors)},
+		{"Uploads", fmt.Sprintf("%d (%d ok, %d errors)", counterValue(uploadsTotal), counterValue(uploadsSuccess), counterValue(uploadsError))},
+		{"Directory listings", strconv.FormatUint(counterValue(directoryLists), 10)},
+		{"File downloads", strconv.FormatUint(counterValue(fileServes), 10)},
+	}
+	if usage := lastDiskUsage.Load(); usage != nil {
+		stats = append(stats, ConfigEntry{"Disk", fmt.Sprintf("%s free of %s",
+			formatSize(int64(usage.AvailBytes)), formatSize(int64(usage.TotalBytes)))})
+	}
+	if trashDir != "" {
+		if batches, size, err := trashUsage(); err == nil {
+			stats = append(stats, ConfigEntry{"Trash", fmt.Sprintf("%s in %d deletes", formatSize(size), batches)})
+		}
+	}
+
+	// Links that still work
+	var shares []ShareView
+	if enableShares {
+		now := time.Now()
+		shareStore.Lock()
+		for _, s := range sortedShares() {
+			if !s.expired(now) && !s.exhausted() {
+				shares = append(shares, shareView(r, *s))
+			}
+		}
+		shareStore.Unlock()
+	}
+
+	tmpl, err := template.New("admin").Funcs(template.FuncMap{"url": prefixURL}).Parse(adminTemplate)
+	if err != nil {
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Title    string
+		Config   []ConfigEntry
+		Stats    []ConfigEntry
+		Jobs     []JobStatus
+		Shares   []ShareView
+		Events   []AuditEvent
+		ReadOnly bool
+		Trash    bool
+		Sharing  bool
+		CSRF     string
+	}{
+		Title:    title,
+		Config:   effectiveConfig(),
+		Stats:    stats,
+		Jobs:     jobStatuses(),
+		Shares:   shares,
+		Events:   recentAuditEvents(),
+		ReadOnly: readOnly.Load(),
+		Trash:    trashDir != "",
+		Sharing:  enableShares,
+		CSRF:     csrfToken(w, r),
+	}
+
+	tmpl.Execute(w, data)
+}
+
+// adminReadOnlyHandler toggles read-only mode at runtime.
+func adminReadOnlyHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	enabled := !readOnly.Load()
+	if value := r.FormValue("enabled"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid value", http.StatusBadRequest)
+			return
+		}
+		enabled = parsed
+	}
+	readOnly.Store(enabled)
+
+	if enabled {
+		recordAudit(r, "read-only on", "")
+	} else {
+		recordAudit(r, "read-only off", "")
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// adminPurgeTrashHandler permanently removes the deleted entries kept in
+// the trash.
+func adminPurgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	if trashDir == "" {
+		http.Error(w, "Trash is disabled", http.StatusNotFound)
+		return
+	}
+
+	purged, err := purgeTrash()
+	if purged > 0 {
+		recordAudit(r, "purge trash", "")
+	}
+	if err != nil {
+		serverError(w, "Error purging trash", err)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func formatLimit(bytes int64) string {
+	if bytes <= 0 {
+		return "unlimited"
+	}
+	return formatSize(bytes)
+}
+
+func formatPageSize() string {
+	if pageSize == 0 {
+		return "unpaginated"
+	}
+	return strconv.Itoa(pageSize)
+}
+
+func formatDirSizes() string {
+	if !enableDirSizes {
+		return "disabled"
+	}
+	return "cached for " + dirSizeTTL.String()
+}
+
+func formatThumbnails() string {
+	if !enableThumbnails {
+		return "disabled"
+	}
+	return thumbCacheDir + " (max " + formatSize(thumbCacheSize) + ")"
+}
+
+func formatContentIndex() string {
+	if !enableContentIndex {
+		return "disabled"
+	}
+	return fmt.Sprintf("%s (%d files)", indexDir, contentIndex.size())
+}
+
+func formatKeepVersions() string {
+	if keepVersions <= 0 {
+		return "disabled"
+	}
+	return fmt.Sprintf("%d in %s", keepVersions, versionsDir)
+}
+
+func formatShares() string {
+	if !enableShares {
+		return "disabled"
+	}
+	shareStore.Lock()
+	defer shareStore.Unlock()
+	return fmt.Sprintf("%d in %s", len(shareStore.shares), orDefault(sharesFile, "memory"))
+}
+
+func formatSignedURLs() string {
+	if len(urlSigningKey) == 0 {
+		return "false"
+	}
+	return "true (max " + signedURLMaxTTL.String() + ")"
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+const adminTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - admin</title>
+<style>
+  * { margin: 0; padding: 0; box-sizing: border-box; }
+  :root { --bg-color: #fff; --text-color: #000; --header-bg: #f0f0f0; --border-color: #ddd; --border-light: #eee; }
+  @media (prefers-color-scheme: dark) {
+    :root { --bg-color: #1a1a1a; --text-color: #e0e0e0; --header-bg: #2a2a2a; --border-color: #444; --border-light: #333; }
+  }
+  body { font-family: monospace; font-size: 14px; background: var(--bg-color); color: var(--text-color); }
+  header { background: var(--header-bg); padding: 10px; border-bottom: 1px solid var(--border-color); }
+  section { margin: 10px; }
+  h2 { font-size: 14px; margin-bottom: 4px; }
+  table { width: 100%; border-collapse: collapse; }
+  th, td { text-align: left; padding: 4px; border-bottom: 1px solid var(--border-light); white-space: nowrap; }
+  th { border-bottom: 1px solid var(--border-color); }
+  a { color: var(--text-color); }
+  button { padding: 4px 8px; background: var(--header-bg); color: var(--text-color); border: 1px solid var(--border-color); cursor: pointer; }
+</style>
+</head>
+<body>
+  <header><h1><a href="{{url "/"}}">{{.Title}}</a> / admin</h1></header>
+
+  <section>
+    <h2>Quick actions</h2>
+    <form action="{{url "/admin/readonly"}}" method="post">
+      <input type="hidden" name="csrf" value="{{.CSRF}}">
+      <input type="hidden" name="enabled" value="{{not .ReadOnly}}">
+      <button type="submit">{{if .ReadOnly}}Disable{{else}}Enable{{end}} read-only mode</button>
+    </form>
+    {{if .Trash}}
+    <form action="{{url "/admin/trash/purge"}}" method="post" onsubmit="return confirm('Permanently remove everything in the trash?')">
+      <input type="hidden" name="csrf" value="{{.CSRF}}">
+      <button type="submit">Purge trash</button>
+    </form>
+    {{end}}
+  </section>
+
+  <section>
+    <h2>Configuration</h2>
+    <table>{{range .Config}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+  </section>
+
+  <section>
+    <h2>Runtime</h2>
+    <table>{{range .Stats}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+  </section>
+
+  <section>
+    <h2>Jobs</h2>
+    <table>
+      <tr><th>Name</th><th>State</th><th>Runs</th><th>Last run</th><th>Last error</th></tr>
+      {{range .Jobs}}
+      <tr>
+        <td>{{.Name}}</td>
+        <td>{{if .Running}}running{{else}}idle{{end}}</td>
+        <td>{{.RunCount}}</td>
+        <td>{{if not .LastRun.IsZero}}{{.LastRun.Format "2006-01-02 15:04:05"}}{{else}}-{{end}}</td>
+        <td>{{or .LastErr "-"}}</td>
+      </tr>
+      {{else}}
+      <tr><td colspan="5">No background jobs</td></tr>
+      {{end}}
+    </table>
+  </section>
+
+  {{if .Sharing}}
+  <section>
+    <h2>Active shares</h2>
+    <table>
+      <tr><th>Path</th><th>Link</th><th>Expires</th><th>Downloads</th><th>Created by</th><th></th></tr>
+      {{range .Shares}}
+      <tr>
+        <td><a href="{{url .Path}}">{{.Path}}</a></td>
+        <td><a href="{{.URL}}">{{.Token}}</a></td>
+        <td>{{if .Expires}}{{.Expires.Format "2006-01-02 15:04:05"}}{{else}}never{{end}}</td>
+        <td>{{.Downloads}}{{if .MaxDownloads}} of {{.MaxDownloads}}{{end}}</td>
+        <td>{{or .CreatedBy "-"}}</td>
+        <td>
+          <form action="{{url "/shares/revoke"}}" method="post">
+            <input type="hidden" name="csrf" value="{{$.CSRF}}">
+            <input type="hidden" name="token" value="{{.Token}}">
+            <button type="submit">Revoke</button>
+          </form>
+        </td>
+      </tr>
+      {{else}}
+      <tr><td colspan="6">No active shares</td></tr>
+      {{end}}
+    </table>
+  </section>
+  {{end}}
+
+  <section>
+    <h2>Recent activity</h2>
+    <table>
+      <tr><th>Time</th><th>Client</th><th>User</th><th>Action</th><th>Path</th></tr>
+      {{range .Events}}
+      <tr>
+        <td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+        <td>{{.Remote}}</td>
+        <td>{{or .User "-"}}</td>
+        <td>{{.Action}}</td>
+        <td>{{or .Path "-"}}</td>
+      </tr>
+      {{else}}
+      <tr><td colspan="5">No recorded activity</td></tr>
+      {{end}}
+    </table>
+  </section>
+</body>
+</html>`
+
+func formatTrustedProxies() string {
+	if len(trustedProxies) == 0 {
+		return "(none)"
+	}
+	proxies := make([]string, len(trustedProxies))
+	for i, prefix := range trustedProxies {
+		proxies[i] = prefix.String()
+	}
+	return strings.Join(proxies, ", ")
+}
+
+func formatTimeouts() string {
+	write := "none"
+	if writeTimeout > 0 {
+		write = writeTimeout.String()
+	}
+	return fmt.Sprintf("header %s, idle %s, write %s, max header %s",
+		readHeaderTimeout, idleTimeout, write, formatSize(int64(maxHeaderBytes)))
+}
+
+func formatAccessLog() string {
+	if accessLog == "" {
+		return "(disabled)"
+	}
+	return accessLog + " (" + accessLogFormat + ")"
+}
+
+func formatLogFile() string {
+	if logFile == "" {
+		return "(stderr)"
+	}
+	return logFile + " (" + formatLogRotation() + ")"
+}
+
+func formatTracing() string {
+	if otlpEndpoint == "" {
+		return "(disabled)"
+	}
+	return otlpEndpoint + " (sample ratio " + strconv.FormatFloat(traceSampleRatio, 'g', -1, 64) + ")"
+}
+
+func formatPprof() string {
+	if !enablePprof {
+		return "(disabled)"
+	}
+	return orDefault(pprofAddr, "/debug/pprof/ (admins)")
+}
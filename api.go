@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Directory entry or file metadata returned by the JSON API
+type APIEntry struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	ModTime  string `json:"mtime"`
+	IsDir    bool   `json:"isDir"`
+	MimeType string `json:"mimeType,omitempty"`
+	Symlink  bool   `json:"symlink,omitempty"`
+}
+
+// Directory listing returned by the JSON API
+type APIListing struct {
+	Path    string     `json:"path"`
+	Entries []APIEntry `json:"entries"`
+	// Set when the listing was requested with ?page= or ?per_page=
+	Page    int `json:"page,omitempty"`
+	PerPage int `json:"perPage,omitempty"`
+	Total   int `json:"total,omitempty"`
+}
+
+// wantsJSON reports whether the client asked for JSON, either explicitly
+// with ?format=json or through an Accept header preferring it over HTML.
+func wantsJSON(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "json":
+		return true
+	case "html":
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+func newAPIEntry(info fs.FileInfo, urlPath string) APIEntry {
+	entry := APIEntry{
+		Name:    info.Name(),
+		Path:    urlPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UTC().Format(time.RFC3339),
+		IsDir:   info.IsDir(),
+		Symlink: info.Mode()&fs.ModeSymlink != 0,
+	}
+	if info.IsDir() {
+		entry.Size = 0
+		if !strings.HasSuffix(entry.Path, "/") {
+			entry.Path += "/"
+		}
+	} else {
+		entry.MimeType = mime.TypeByExtension(filepath.Ext(info.Name()))
+		if entry.MimeType == "" {
+			entry.MimeType = "application/octet-stream"
+		}
+	}
+	return entry
+}
+
+func serveJSONListing(w http.ResponseWriter, r *http.Request, dirPath string, urlPath string) {
+	r, span := startSpan(r, "listing", attribute.String("path", urlPath))
+	defer span.End()
+	order, err := parseListingSort(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Unpaginated unless asked for, as before pagination existed
+	page, err := parsePagination(r, 0, order)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := readDirectory(dirPath)
+	if err != nil {
+		writeJSONError(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+	entries = filterIgnored(filterDotfiles(r, entries), dirPath)
+	sorted := sortedInfos(entries, dirPath, order)
+	if listingNotModified(w, r, listingETag(sorted, "json")) {
+		return
+	}
+	infos := page.slice(sorted)
+
+	listing := APIListing{Path: urlPath, Entries: make([]APIEntry, 0, len(infos))}
+	for _, info := range infos {
+		listing.Entries = append(listing.Entries, newAPIEntry(info, path.Join(urlPath, info.Name())))
+	}
+	if page.Paginated() {
+		listing.Page, listing.PerPage, listing.Total = page.Page, page.PerPage, page.Total
+	}
+
+	writeJSON(w, http.StatusOK, listing)
+}
+
+func serveJSONMetadata(w http.ResponseWriter, info fs.FileInfo, urlPath string) {
+	writeJSON(w, http.StatusOK, newAPIEntry(info, urlPath))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		slog.Error("Unable to encode JSON response", "err", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
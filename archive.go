@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// archiveName returns the download name for the directory at urlPath.
+func archiveName(urlPath, ext string) string {
+	name := path.Base(path.Clean("/" + urlPath))
+	if name == "/" || name == "." {
+		name = "files"
+	}
+	return name + ext
+}
+
+// walkArchive calls fn for every regular file and directory below dirPath a
+// client may read, skipping internal files, symlinks, entries matched by
+// .fbignore files and subtrees denied by .fbaccess files or the ACL.
+func walkArchive(r *http.Request, dirPath, urlPath string, fn func(fullPath, rel string, info fs.FileInfo) error) error {
+	// .fbignore rules by parent directory
+	ignoreRules := make(map[string]IgnoreRules)
+	return filepath.WalkDir(dirPath, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if fullPath != dirPath && (strings.HasPrefix(name, stagingPrefix) || name == accessFileName) {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if fullPath != dirPath {
+			parent := filepath.Dir(fullPath)
+			rules, ok := ignoreRules[parent]
+			if !ok {
+				rules = loadIgnoreRules(parent)
+				ignoreRules[parent] = rules
+			}
+			if rootRel, err := filepath.Rel(filesDir, fullPath); err == nil && rules.ignored(filepath.ToSlash(rootRel), d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		rel, err := filepath.Rel(dirPath, fullPath)
+		if err != nil {
+			return err
+		}
+		entryURL := path.Join(urlPath, filepath.ToSlash(rel))
+		if d.IsDir() {
+			if !archiveAllows(r, fullPath, entryURL, PermList) {
+				return filepath.SkipDir
+			}
+		} else if !d.Type().IsRegular() || !archiveAllows(r, fullPath, entryURL, PermRead) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(fullPath, filepath.ToSlash(rel), info)
+	})
+}
+
+// serveTarGz streams dirPath as a gzipped tarball, preserving modification
+// times and permissions.
+func serveTarGz(w http.ResponseWriter, r *http.Request, dirPath, urlPath string) {
+	release, ok := acquireTransfer(w, r, downloadSlots)
+	if !ok {
+		return
+	}
+	defer release()
+	w, done := countDownload(w)
+	defer done()
+	root := archiveName(urlPath, "")
+	r, span := startSpan(r, "archive", attribute.String("path", urlPath), attribute.String("format", "tar.gz"))
+	allowLongWrite(w)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": root + ".tar.gz"}))
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := walkArchive(r, dirPath, urlPath, func(fullPath, rel string, info fs.FileInfo) error {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(root, rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		header.Uname, header.Gname = "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return copyFileTo(tw, fullPath)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	endSpan(span, err)
+	if err != nil {
+		slog.Error("Unable to stream archive", "path", dirPath, "err", err)
+	}
+}
+
+// archiveAllows reports whether an archive built for r may contain the
+// entry at fullPath: by the access files and the ACL, or in the archive of a
+// share by the share's own rule.
+func archiveAllows(r *http.Request, fullPath, entryURL string, perm Permission) bool {
+	if root, ok := sharedRoot(r); ok {
+		return !shareBlocked(root, fullPath)
+	}
+	if perm == PermList && !checkAccess(r, fullPath) {
+		return false
+	}
+	return permitted(r, entryURL, perm)
+}
+
+func copyFileTo(w io.Writer, fullPath string) error {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("%s: %w", fullPath, err)
+	}
+	return nil
+}
+
+// writeZipEntries adds the file or directory at fullPath to zw under name.
+func writeZipEntries(r *http.Request, zw *zip.Writer, fullPath, urlPath, name string) error {
+	return walkArchive(r, fullPath, urlPath, func(entryPath, rel string, info fs.FileInfo) error {
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, rel)
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		dst, err := zw.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return copyFileTo(dst, entryPath)
+	})
+}
+
+// serveZip streams dirPath as a zip file.
+func serveZip(w http.ResponseWriter, r *http.Request, dirPath, urlPath string) {
+	release, ok := acquireTransfer(w, r, downloadSlots)
+	if !ok {
+		return
+	}
+	defer release()
+	w, done := countDownload(w)
+	defer done()
+	name := archiveName(urlPath, "")
+	r, span := startSpan(r, "archive", attribute.String("path", urlPath), attribute.String("format", "zip"))
+	allowLongWrite(w)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+
+	zw := zip.NewWriter(w)
+	err := writeZipEntries(r, zw, dirPath, urlPath, name)
+	if err == nil {
+		err = zw.Close()
+	}
+	endSpan(span, err)
+	if err != nil {
+		slog.Error("Unable to stream archive", "path", dirPath, "err", err)
+	}
+}
+
+// archiveHandler streams a zip of the selected entries. Paths are given as
+// repeated "path" form values (or a JSON {"dir", "paths"} body) relative to
+// the "dir" directory.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, ok := readSelection(w, r)
+	if !ok {
+		return
+	}
+
+	baseURL := path.Clean("/" + req.Dir)
+	type selection struct{ fullPath, urlPath, name string }
+	selected := make([]selection, 0, len(req.Paths))
+	for _, p := range req.Paths {
+		urlPath, fullPath, ok := resolveTarget(path.Join(baseURL, p))
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invalid path %q", p), http.StatusBadRequest)
+			return
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: no such file or directory", urlPath), http.StatusNotFound)
+			return
+		}
+		accessDir := fullPath
+		perm := PermList
+		if !info.IsDir() {
+			accessDir = filepath.Dir(fullPath)
+			perm = PermRead
+		}
+		if !checkAccess(r, accessDir) || !permitted(r, urlPath, perm) {
+			denyPermission(w, r)
+			return
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(urlPath, baseURL), "/")
+		if name == "" {
+			name = path.Base(urlPath)
+		}
+		selected = append(selected, selection{fullPath, urlPath, name})
+	}
+
+	release, ok := acquireTransfer(w, r, downloadSlots)
+	if !ok {
+		return
+	}
+	defer release()
+	w, done := countDownload(w)
+	defer done()
+	r, span := startSpan(r, "archive", attribute.String("path", baseURL), attribute.String("format", "zip"), attribute.Int("entries", len(selected)))
+	allowLongWrite(w)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": archiveName(baseURL, ".zip")}))
+
+	zw := zip.NewWriter(w)
+	for _, sel := range selected {
+		if err := writeZipEntries(r, zw, sel.fullPath, sel.urlPath, sel.name); err != nil {
+			endSpan(span, err)
+			slog.Error("Unable to stream archive", "err", err)
+			return
+		}
+	}
+	err := zw.Close()
+	endSpan(span, err)
+	if err != nil {
+		slog.Error("Unable to stream archive", "err", err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Route serving the theme stylesheet and the configured logo and favicon;
+// files in a directory of this name at the root are shadowed
+const assetsPrefix = "/_assets/"
+
+// assetName returns the name file is served under below /_assets/, keeping
+// its extension so the content type is right.
+func assetName(name, file string) string {
+	return name + strings.ToLower(filepath.Ext(file))
+}
+
+// assetURL returns the URL of the asset served from file, or "" when file
+// is not configured.
+func assetURL(name, file string) string {
+	if file == "" {
+		return ""
+	}
+	return prefixURL(assetsPrefix + assetName(name, file))
+}
+
+func logoURL() string    { return assetURL("logo", logoFile) }
+func faviconURL() string { return assetURL("favicon", faviconFile) }
+
+// checkAssetFile fails when an asset file is missing or not a regular file.
+func checkAssetFile(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", file)
+	}
+	return nil
+}
+
+// assetsHandler serves the theme stylesheet and the logo and favicon files,
+// which live outside the files dir.
+func assetsHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, assetsPrefix)
+	var file string
+	switch {
+	case name == "theme.css":
+		serveThemeCSS(w, r)
+		return
+	case logoFile != "" && name == assetName("logo", logoFile):
+		file = logoFile
+	case faviconFile != "" && name == assetName("favicon", faviconFile):
+		file = faviconFile
+	default:
+		notFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeFile(w, r, file)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const auditLogSize = 100
+
+// Operation performed by a client, kept in memory for the admin dashboard
+type AuditEvent struct {
+	Time   time.Time
+	Remote string
+	User   string
+	Action string
+	Path   string
+}
+
+var auditLog = struct {
+	sync.Mutex
+	events []AuditEvent
+	next   int
+}{events: make([]AuditEvent, 0, auditLogSize)}
+
+func recordAudit(r *http.Request, action, path string) {
+	event := AuditEvent{
+		Time:   time.Now(),
+		Remote: clientIP(r),
+		Action: action,
+		Path:   path,
+	}
+	if id := requestIdentity(r); id != nil {
+		event.User = id.Name
+	}
+
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if len(auditLog.events) < auditLogSize {
+		auditLog.events = append(auditLog.events, event)
+	} else {
+		auditLog.events[auditLog.next] = event
+	}
+	auditLog.next = (auditLog.next + 1) % auditLogSize
+}
+
+// recentAuditEvents returns the recorded events, newest first.
+func recentAuditEvents() []AuditEvent {
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	events := make([]AuditEvent, 0, len(auditLog.events))
+	for i := 1; i <= len(auditLog.events); i++ {
+		events = append(events, auditLog.events[(auditLog.next-i+auditLogSize)%auditLogSize])
+	}
+	return events
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Users loaded from the htpasswd file, mapping names to password hashes
+var htpasswdUsers map[string]string
+
+func authEnabled() bool {
+	return authUser != "" || htpasswdUsers != nil
+}
+
+// loadHtpasswd reads an Apache htpasswd file. Only bcrypt ($2y$), SHA1
+// ({SHA}) and plain text entries are supported.
+func loadHtpasswd(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected user:hash", path, lineNo)
+		}
+		if strings.HasPrefix(hash, "$apr1$") || strings.HasPrefix(hash, "$1$") {
+			slog.Warn("MD5 hashes are not supported, skipping user", "file", path, "line", lineNo, "user", user)
+			continue
+		}
+		users[user] = hash
+	}
+	return users, scanner.Err()
+}
+
+func checkHtpasswd(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		encoded := base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(encoded), []byte(hash[len("{SHA}"):])) == 1
+	default:
+		return subtle.ConstantTimeCompare([]byte(password), []byte(hash)) == 1
+	}
+}
+
+// authenticate validates basic auth credentials against AUTH_USER/AUTH_PASS,
+// the htpasswd file and the admin credentials.
+func authenticate(user, pass string) *Identity {
+	if adminPass != "" &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(adminUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(adminPass)) == 1 {
+		return &Identity{Name: user, Roles: []string{"admin"}}
+	}
+	if authUser != "" && authPass != "" &&
+		subtle.ConstantTimeCompare([]byte(user), []byte(authUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(authPass)) == 1 {
+		return &Identity{Name: user}
+	}
+	if hash, ok := htpasswdUsers[user]; ok && checkHtpasswd(hash, pass) {
+		return &Identity{Name: user}
+	}
+	return nil
+}
+
+// requireAuth authenticates every request, either with an API token in an
+// "Authorization: Bearer" header or with basic auth credentials, and attaches
+// the resulting identity to the request context. When basic auth is
+// configured, requests without credentials are refused, except with an ACL
+// loaded on the routes of routes that consult it, where they continue
+// anonymously. Shared links under /s/ need none.
+func requireAuth(next http.Handler, routes *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Shared links carry their own token instead of credentials
+		if enableShares && strings.HasPrefix(r.URL.Path, sharePrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token, ok := bearerToken(r); ok {
+			if id := lookupAPIToken(token); id != nil {
+				next.ServeHTTP(w, withIdentity(r, id))
+				return
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer realm=%q, error=\"invalid_token\"", authRealm))
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		if !authEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			if id := authenticate(user, pass); id != nil {
+				next.ServeHTTP(w, withIdentity(r, id))
+				return
+			}
+		} else if len(aclRules) > 0 && aclRoute(routes, r) {
+			// Let the ACL decide what anonymous clients may see
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", authRealm))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCheckHtpasswd(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+	}{
+		{"bcrypt", string(bcryptHash), "s3cret", true},
+		{"bcrypt wrong", string(bcryptHash), "S3cret", false},
+		{"bcrypt empty", string(bcryptHash), "", false},
+		// htpasswd -nbs user s3cret
+		{"sha1", "{SHA}/vNB+F2HQ559kaLUZbmHHvZrXpg=", "s3cret", true},
+		{"sha1 wrong", "{SHA}/vNB+F2HQ559kaLUZbmHHvZrXpg=", "secret", false},
+		{"plain", "s3cret", "s3cret", true},
+		{"plain wrong", "s3cret", "s3cre", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkHtpasswd(tt.hash, tt.password); got != tt.want {
+				t.Errorf("checkHtpasswd(%q, %q) = %v, want %v", tt.hash, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	content := "# users\n\nalice:{SHA}/vNB+F2HQ559kaLUZbmHHvZrXpg=\nbob:$apr1$abc$def\ncarol:plain\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	users, err := loadHtpasswd(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users["alice"] == "" || users["carol"] != "plain" {
+		t.Errorf("loadHtpasswd = %v, want alice and carol", users)
+	}
+	if _, ok := users["bob"]; ok {
+		t.Error("MD5 entry was loaded")
+	}
+
+	if err := os.WriteFile(file, []byte("no separator\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadHtpasswd(file); err == nil {
+		t.Error("loadHtpasswd accepted a line without a hash")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	defer func(user, pass string, users map[string]string, admin string) {
+		authUser, authPass, htpasswdUsers, adminPass = user, pass, users, admin
+	}(authUser, authPass, htpasswdUsers, adminPass)
+	htpasswdUsers = map[string]string{"bob": "{SHA}/vNB+F2HQ559kaLUZbmHHvZrXpg="}
+	adminPass = ""
+
+	tests := []struct {
+		name             string
+		authUser         string
+		authPass         string
+		user, pass, want string
+	}{
+		{"env user", "alice", "pw", "alice", "pw", "alice"},
+		{"env user wrong password", "alice", "pw", "alice", "px", ""},
+		{"env user empty password", "alice", "", "alice", "", ""},
+		{"htpasswd user", "", "", "bob", "s3cret", "bob"},
+		{"htpasswd wrong password", "", "", "bob", "", ""},
+		{"unknown user", "alice", "pw", "mallory", "pw", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authUser, authPass = tt.authUser, tt.authPass
+			got := ""
+			if id := authenticate(tt.user, tt.pass); id != nil {
+				got = id.Name
+			}
+			if got != tt.want {
+				t.Errorf("authenticate(%q, %q) = %q, want %q", tt.user, tt.pass, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAuthRejectsBadCredentials(t *testing.T) {
+	defer func(user, pass string, rules []ACLRule) {
+		authUser, authPass, aclRules = user, pass, rules
+	}(authUser, authPass, aclRules)
+	authUser, authPass, aclRules = "alice", "pw", nil
+
+	handler := requireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(requestIdentity(r).Name))
+	}), http.NewServeMux())
+	tests := []struct {
+		name       string
+		user, pass string
+		want       int
+	}{
+		{"valid", "alice", "pw", http.StatusOK},
+		{"wrong password", "alice", "nope", http.StatusUnauthorized},
+		{"empty password", "alice", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.SetBasicAuth(tt.user, tt.pass)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("anonymous request: status = %d, WWW-Authenticate = %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// parseBaseURL normalizes BASE_URL to a cleaned path without a trailing
+// slash, empty when the app is mounted at the root.
+func parseBaseURL(value string) (string, error) {
+	if value == "" || value == "/" {
+		return "", nil
+	}
+	if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, "?#") {
+		return "", fmt.Errorf("invalid base URL %q, expected a path like /files", value)
+	}
+	return strings.TrimSuffix(path.Clean(value), "/"), nil
+}
+
+// prefixURL prepends the base URL to an absolute path. Relative URLs are
+// returned as they are.
+func prefixURL(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") {
+		return p
+	}
+	return baseURL + p
+}
+
+// withBaseURL serves h under the base URL: the prefix is stripped from
+// incoming paths and added back to the Location of redirects. Paths outside
+// the prefix are not found.
+func withBaseURL(h http.Handler) http.Handler {
+	if baseURL == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == baseURL {
+			target := baseURL + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, baseURL+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = strings.TrimPrefix(r.URL.Path, baseURL)
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, baseURL)
+		h.ServeHTTP(&baseURLWriter{ResponseWriter: w}, r2)
+	})
+}
+
+// Response writer prefixing absolute redirect locations with the base URL
+type baseURLWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *baseURLWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if location := w.Header().Get("Location"); location != "" {
+			w.Header().Set("Location", prefixURL(location))
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *baseURLWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses like ?tail=1 working.
+func (w *baseURLWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *baseURLWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+)
+
+var (
+	// Stylesheet appended to every page's styles, from CUSTOM_CSS
+	customCSS template.CSS
+	// Sanitized HTML shown in every page's footer, from CUSTOM_FOOTER_HTML
+	customFooter template.HTML
+)
+
+// loadCustomCSS reads the stylesheet at path. It is inlined in a <style>
+// element, so content able to close the element is refused.
+func loadCustomCSS(path string) (template.CSS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(strings.ToLower(string(data)), "</style") {
+		return "", fmt.Errorf("%s: stylesheet must not contain </style", path)
+	}
+	return template.CSS(data), nil
+}
+
+// loadCustomFooter reads the footer HTML at path, dropping scripts, event
+// handlers and anything else the markdown renderer would not allow either.
+func loadCustomFooter(path string) (template.HTML, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(markdownPolicy.SanitizeBytes(data)), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// Entries picked with the listing's checkboxes: names relative to Dir, and
+// the destination directory of a move
+type Selection struct {
+	Dir   string   `json:"dir"`
+	Paths []string `json:"paths"`
+	To    string   `json:"to,omitempty"`
+}
+
+// readSelection reads a Selection from a JSON body or from the posted form,
+// where each name is a "path" field. It answers with an error and returns
+// false when nothing was selected.
+func readSelection(w http.ResponseWriter, r *http.Request) (Selection, bool) {
+	var sel Selection
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return sel, false
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return sel, false
+		}
+		sel.Dir = r.PostForm.Get("dir")
+		sel.Paths = r.PostForm["path"]
+		sel.To = r.PostForm.Get("to")
+	}
+	if len(sel.Paths) == 0 {
+		http.Error(w, "No paths selected", http.StatusBadRequest)
+		return sel, false
+	}
+	return sel, true
+}
+
+// selectedTarget is one resolved entry of a Selection.
+type selectedTarget struct{ urlPath, fullPath string }
+
+// resolveSelection resolves the selected names below sel.Dir, answering
+// with an error and returning false when one is invalid.
+func resolveSelection(w http.ResponseWriter, sel Selection) ([]selectedTarget, bool) {
+	baseURL := path.Clean("/" + sel.Dir)
+	targets := make([]selectedTarget, 0, len(sel.Paths))
+	for _, p := range sel.Paths {
+		urlPath, fullPath, ok := resolveTarget(path.Join(baseURL, p))
+		if !ok {
+			http.Error(w, fmt.Sprintf("Invalid path %q", p), http.StatusBadRequest)
+			return nil, false
+		}
+		targets = append(targets, selectedTarget{urlPath, fullPath})
+	}
+	return targets, true
+}
+
+// respondBulk answers a successful bulk operation with the affected paths
+// for API clients or a redirect back to the listing of dir for browser forms.
+func respondBulk(w http.ResponseWriter, r *http.Request, dir string, paths []string) {
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string][]string{"paths": paths})
+		return
+	}
+	http.Redirect(w, r, strings.TrimSuffix(path.Clean("/"+dir), "/")+"/", http.StatusSeeOther)
+}
+
+// deleteHandler removes the selected files and directories, or moves them
+// to the trash when one is configured. Every entry is checked before
+// anything is removed.
+func deleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWritable(w) {
+		return
+	}
+
+	sel, ok := readSelection(w, r)
+	if !ok {
+		return
+	}
+	targets, ok := resolveSelection(w, sel)
+	if !ok {
+		return
+	}
+	for _, t := range targets {
+		if _, err := os.Lstat(t.fullPath); err != nil {
+			http.Error(w, fmt.Sprintf("%s: no such file or directory", t.urlPath), http.StatusNotFound)
+			return
+		}
+		if !canModifyTree(r, t.urlPath, t.fullPath) {
+			denyPermission(w, r)
+			return
+		}
+	}
+
+	deleted := make([]string, 0, len(targets))
+	batch := trashBatch()
+	for _, t := range targets {
+		size, _ := dirSize(t.fullPath)
+		versions := treeVersionDirs(t.fullPath)
+		if err := removeTree(batch, t.urlPath, t.fullPath); err != nil {
+			serverError(w, "Error deleting "+t.urlPath, err)
+			return
+		}
+		dropVersions(versions)
+		addQuotaUsage(t.urlPath, -size)
+		indexUpload(t.urlPath)
+		recordAudit(r, "delete", t.urlPath)
+		notifyWebhooks(r, WebhookEvent{Event: "delete", Path: t.urlPath, Size: size})
+		deleted = append(deleted, t.urlPath)
+	}
+	respondBulk(w, r, sel.Dir, deleted)
+}
+
+// moveHandler moves the selected files and directories into the "to"
+// directory, keeping their names. Every entry is checked before anything
+// is moved, and selections that overlap or would land on the same name are
+// refused.
+func moveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWritable(w) {
+		return
+	}
+
+	sel, ok := readSelection(w, r)
+	if !ok {
+		return
+	}
+	targets, ok := resolveSelection(w, sel)
+	if !ok {
+		return
+	}
+	toDir := path.Clean("/" + sel.To)
+	if sel.To == "" || !withinRoot(resolvePath(toDir)) {
+		http.Error(w, "Invalid destination path", http.StatusBadRequest)
+		return
+	}
+
+	destinations := make([]selectedTarget, len(targets))
+	for i, t := range targets {
+		for _, other := range targets[:i] {
+			if isUnder(t.fullPath, other.fullPath) || isUnder(other.fullPath, t.fullPath) {
+				http.Error(w, fmt.Sprintf("%s and %s overlap", other.urlPath, t.urlPath), http.StatusBadRequest)
+				return
+			}
+		}
+		toURL, toPath, ok := resolveTarget(path.Join(toDir, path.Base(t.urlPath)))
+		if !ok {
+			http.Error(w, "Invalid destination path", http.StatusBadRequest)
+			return
+		}
+		for _, other := range destinations[:i] {
+			if other.fullPath == toPath {
+				http.Error(w, fmt.Sprintf("More than one selected entry would be moved to %s", toURL), http.StatusConflict)
+				return
+			}
+		}
+		if !checkMove(w, r, t.urlPath, t.fullPath, toURL, toPath) {
+			return
+		}
+		destinations[i] = selectedTarget{toURL, toPath}
+	}
+
+	moved := make([]string, 0, len(targets))
+	for i, t := range targets {
+		to := destinations[i]
+		// Checked again as the destination may have appeared since
+		if _, err := os.Lstat(to.fullPath); err == nil {
+			http.Error(w, fmt.Sprintf("%s already exists", to.urlPath), http.StatusConflict)
+			return
+		}
+		size, _ := dirSize(t.fullPath)
+		if err := moveTree(t.fullPath, to.fullPath); err != nil {
+			serverError(w, "Error moving "+t.urlPath, err)
+			return
+		}
+		moveVersions(t.fullPath, to.fullPath)
+		addQuotaUsage(t.urlPath, -size)
+		addQuotaUsage(to.urlPath, size)
+		recordAudit(r, "move", t.urlPath+" -> "+to.urlPath)
+		moved = append(moved, to.urlPath)
+	}
+	respondBulk(w, r, sel.Dir, moved)
+}
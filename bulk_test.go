@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func deleteRequest(dir string, paths ...string) *httptest.ResponseRecorder {
+	form := url.Values{"dir": {dir}, "path": paths}
+	r := httptest.NewRequest("POST", "/delete", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	deleteHandler(w, r)
+	return w
+}
+
+func TestDeleteKeepsProtectedSubtrees(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"projects/private/.fbaccess": "password: s3cret\n",
+		"projects/private/plans.txt": "",
+		"ruled/archive/old.txt":      "",
+		"open/a.txt":                 "",
+	})
+	aclRules = []ACLRule{
+		{Prefix: "/", Subject: "*", Perms: PermRead | PermWrite | PermList},
+		{Prefix: "/ruled/archive", Subject: "*", Perms: PermRead | PermList},
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		kept  string
+	}{
+		{"access file below", []string{"projects"}, "projects/private/plans.txt"},
+		{"acl rule below", []string{"ruled"}, "ruled/archive/old.txt"},
+		{"nothing deleted when one entry is protected", []string{"open", "projects"}, "open/a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := deleteRequest("/", tt.paths...)
+			if w.Code == http.StatusSeeOther || w.Code == http.StatusOK {
+				t.Errorf("delete of %v succeeded with %d", tt.paths, w.Code)
+			}
+			if _, err := os.Stat(filepath.Join(filesDir, filepath.FromSlash(tt.kept))); err != nil {
+				t.Errorf("%s deleted: %v", tt.kept, err)
+			}
+		})
+	}
+
+	if w := deleteRequest("/", "open"); w.Code != http.StatusSeeOther {
+		t.Errorf("delete of an unprotected tree: status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, "open")); !os.IsNotExist(err) {
+		t.Errorf("unprotected tree still exists: %v", err)
+	}
+}
+
+func moveRequest(dir, to string, paths ...string) *httptest.ResponseRecorder {
+	form := url.Values{"dir": {dir}, "path": paths, "to": {to}}
+	r := httptest.NewRequest("POST", "/move", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	moveHandler(w, r)
+	return w
+}
+
+func TestMoveRefusesCollidingSelections(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"a/x.txt":    "from a",
+		"b/x.txt":    "from b",
+		"dest/.keep": "",
+	})
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  int
+	}{
+		{"same name twice", []string{"a/x.txt", "b/x.txt"}, http.StatusConflict},
+		{"directory and a file inside it", []string{"a", "a/x.txt"}, http.StatusBadRequest},
+		{"file and its directory", []string{"b/x.txt", "b"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := moveRequest("/", "/dest", tt.paths...); w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			for name, content := range map[string]string{"a/x.txt": "from a", "b/x.txt": "from b"} {
+				if data, err := os.ReadFile(filepath.Join(filesDir, filepath.FromSlash(name))); string(data) != content {
+					t.Errorf("%s = %q, %v after a refused move", name, data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMoveUpdatesQuotaUsage(t *testing.T) {
+	withTestTree(t, map[string]string{"alice/report.txt": "12345", "bob/.keep": ""})
+	defer func(q []*Quota) { quotas = q }(quotas)
+	alice, bob := &Quota{Prefix: "/alice", Limit: 100}, &Quota{Prefix: "/bob", Limit: 100}
+	alice.used.Store(5)
+	quotas = []*Quota{alice, bob}
+
+	if w := moveRequest("/alice", "/bob", "report.txt"); w.Code != http.StatusSeeOther {
+		t.Fatalf("move: status = %d, body %s", w.Code, w.Body)
+	}
+	if alice.Used() != 0 || bob.Used() != 5 {
+		t.Errorf("usage after the move: alice %d, bob %d, want 0 and 5", alice.Used(), bob.Used())
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Hash constructors by the algo names accepted by /checksum
+var checksumAlgos = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"blake2": func() hash.Hash {
+		h, _ := blake2b.New256(nil)
+		return h
+	},
+}
+
+// Identifies file contents; a changed size or mtime invalidates the entry
+type checksumKey struct {
+	path    string
+	algo    string
+	size    int64
+	modTime time.Time
+}
+
+const checksumCacheEntries = 10000
+
+var checksumCache = struct {
+	sync.Mutex
+	entries map[checksumKey]string
+}{entries: make(map[checksumKey]string)}
+
+// Checksum returned by /checksum
+type ChecksumResult struct {
+	Path     string `json:"path"`
+	Algo     string `json:"algo"`
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+	Cached   bool   `json:"cached"`
+}
+
+// fileChecksum hashes the file with algo, reusing the cached value while the
+// file's size and mtime are unchanged.
+func fileChecksum(fullPath, algo string, info os.FileInfo) (string, bool, error) {
+	key := checksumKey{fullPath, algo, info.Size(), info.ModTime()}
+	checksumCache.Lock()
+	sum, ok := checksumCache.entries[key]
+	checksumCache.Unlock()
+	if ok {
+		return sum, true, nil
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+	h := checksumAlgos[algo]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", false, err
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	checksumCache.Lock()
+	if len(checksumCache.entries) >= checksumCacheEntries {
+		// Drop an arbitrary half rather than tracking recency
+		for k := range checksumCache.entries {
+			if len(checksumCache.entries) < checksumCacheEntries/2 {
+				break
+			}
+			delete(checksumCache.entries, k)
+		}
+	}
+	checksumCache.entries[key] = sum
+	checksumCache.Unlock()
+	return sum, false, nil
+}
+
+// checksumHandler serves GET /checksum?path=...&algo=sha256.
+func checksumHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	algo := r.URL.Query().Get("algo")
+	if algo == "" {
+		algo = "sha256"
+	}
+	if checksumAlgos[algo] == nil {
+		writeJSONError(w, "Unsupported algo, expected md5, sha1, sha256 or blake2", http.StatusBadRequest)
+		return
+	}
+
+	urlPath, fullPath, ok := resolveTarget(r.URL.Query().Get("path"))
+	if !ok {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.Mode().IsRegular() {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !checkAccess(r, filepath.Dir(fullPath)) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermRead) {
+		denyPermission(w, r)
+		return
+	}
+
+	sum, cached, err := fileChecksum(fullPath, algo, info)
+	if err != nil {
+		serverError(w, "Error reading file", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ChecksumResult{
+		Path:     urlPath,
+		Algo:     algo,
+		Checksum: sum,
+		Size:     info.Size(),
+		Cached:   cached,
+	})
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxChunks     = 10000
+	chunkMaxAge   = 24 * time.Hour
+	chunkSweepDur = time.Hour
+	// Chunked uploads a single client may have in progress
+	maxChunkUploadsPerClient = 16
+)
+
+// Chunked upload in progress. The server issues its id when the upload
+// starts and only takes chunks for it from the same client.
+type chunkUpload struct {
+	owner string
+	// Target dir and file name given when starting, and the file's URL path
+	dir, name, path string
+	total           int
+	// Declared size of the file, and the bytes of the chunks stored or
+	// being received, which may never exceed it
+	size, claimed int64
+	// Sizes of the stored chunks by index
+	chunks  map[int]int64
+	updated time.Time
+}
+
+// Chunked uploads in progress by id
+var chunkUploads = struct {
+	sync.Mutex
+	uploads map[string]*chunkUpload
+}{uploads: map[string]*chunkUpload{}}
+
+// chunkBaseDir holds the chunks of in-progress uploads, one directory per
+// upload id.
+func chunkBaseDir() string {
+	if uploadTmpDir != "" {
+		return filepath.Join(uploadTmpDir, stagingPrefix+"chunks")
+	}
+	return filepath.Join(filesDir, stagingPrefix+"chunks")
+}
+
+func chunkName(index int) string {
+	return fmt.Sprintf("%06d", index)
+}
+
+// uploadOwner identifies the client of a chunked upload: its user or token,
+// else its browser session, else its address.
+func uploadOwner(r *http.Request) string {
+	if id := requestIdentity(r); id != nil {
+		return "user:" + id.Name
+	}
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return "session:" + cookie.Value
+	}
+	return "client:" + clientIP(r)
+}
+
+// chunkUploadHandler implements chunked uploads. A POST without an id starts
+// one: the query carries the target dir, the file name (which may contain a
+// relative path), the number of chunks and the file's total size, which is
+// checked against the upload size limit and quotas right away. The response
+// holds the upload id. Each chunk is then posted as the raw request body
+// with the id and its zero-based index. Once every chunk has arrived, they
+// are concatenated and moved into place like a regular upload.
+func chunkUploadHandler(w http.ResponseWriter, r *http.Request) {
+	allowLongWrite(w)
+	if r.Method != "POST" {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !enableUpload {
+		writeJSONError(w, "File uploads are disabled", http.StatusForbidden)
+		return
+	}
+	if readOnly.Load() {
+		writeJSONError(w, "Server is in read-only mode", http.StatusForbidden)
+		return
+	}
+	if r.URL.Query().Has("id") {
+		receiveChunk(w, r)
+	} else {
+		startChunkUpload(w, r)
+	}
+}
+
+func startChunkUpload(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	total, err1 := strconv.Atoi(query.Get("total"))
+	size, err2 := strconv.ParseInt(query.Get("size"), 10, 64)
+	if err1 != nil || err2 != nil || total < 1 || total > maxChunks || size < 0 {
+		writeJSONError(w, "Invalid chunk total or size", http.StatusBadRequest)
+		return
+	}
+	if maxUploadSize > 0 && size > maxUploadSize {
+		writeJSONError(w, uploadTooLargeMessage(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	targetDir := query.Get("dir")
+	if targetDir == "" {
+		targetDir = "/"
+	}
+	dirPath := resolvePath(filepath.Clean(targetDir))
+	if !checkAccess(r, dirPath) {
+		denyAccess(w, r)
+		return
+	}
+	finalPath, result := uploadTarget(r, targetDir, dirPath, query.Get("name"))
+	if result.Error != "" {
+		writeJSONError(w, result.Error, result.status)
+		return
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		serverError(w, "Error starting upload", err)
+		return
+	}
+	id := hex.EncodeToString(b)
+	owner := uploadOwner(r)
+
+	chunkUploads.Lock()
+	defer chunkUploads.Unlock()
+	inProgress := 0
+	for _, u := range chunkUploads.uploads {
+		if u.owner == owner {
+			inProgress++
+		}
+	}
+	if inProgress >= maxChunkUploadsPerClient {
+		writeJSONError(w, "Too many chunked uploads in progress", http.StatusTooManyRequests)
+		return
+	}
+	if !chunkQuotaAllows(result.Path, size-existingSize(finalPath)) {
+		writeJSONError(w, "Storage quota exceeded", http.StatusInsufficientStorage)
+		return
+	}
+	chunkUploads.uploads[id] = &chunkUpload{
+		owner:   owner,
+		dir:     targetDir,
+		name:    query.Get("name"),
+		path:    result.Path,
+		total:   total,
+		size:    size,
+		chunks:  map[int]int64{},
+		updated: time.Now(),
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"id": id, "total": total, "size": size})
+}
+
+// chunkQuotaAllows reports whether size more bytes fit the quotas covering
+// urlPath next to the sizes declared by the chunked uploads in progress.
+// chunkUploads must be locked.
+func chunkQuotaAllows(urlPath string, size int64) bool {
+	for _, q := range quotasFor(urlPath) {
+		pending := size
+		for _, u := range chunkUploads.uploads {
+			if q.contains(u.path) {
+				pending += u.size
+			}
+		}
+		if pending > q.Remaining() {
+			return false
+		}
+	}
+	return true
+}
+
+func receiveChunk(w http.ResponseWriter, r *http.Request) {
+	release, ok := acquireTransfer(w, r, uploadSlots)
+	if !ok {
+		return
+	}
+	defer release()
+
+	query := r.URL.Query()
+	id := query.Get("id")
+	index, err := strconv.Atoi(query.Get("index"))
+
+	chunkUploads.Lock()
+	u := chunkUploads.uploads[id]
+	if u == nil || u.owner != uploadOwner(r) {
+		chunkUploads.Unlock()
+		writeJSONError(w, "Unknown upload id", http.StatusNotFound)
+		return
+	}
+	if err != nil || index < 0 || index >= u.total {
+		chunkUploads.Unlock()
+		writeJSONError(w, "Invalid chunk index", http.StatusBadRequest)
+		return
+	}
+	if r.ContentLength < 0 {
+		chunkUploads.Unlock()
+		writeJSONError(w, "Chunks need a Content-Length", http.StatusLengthRequired)
+		return
+	}
+	// A chunk sent again replaces the one stored before
+	claim := r.ContentLength - u.chunks[index]
+	if u.claimed+claim > u.size {
+		chunkUploads.Unlock()
+		writeJSONError(w, "Chunks exceed the declared upload size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	u.claimed += claim
+	u.updated = time.Now()
+	chunkUploads.Unlock()
+
+	chunkDir := filepath.Join(chunkBaseDir(), id)
+	err = os.MkdirAll(chunkDir, 0o700)
+	if err == nil {
+		err = writeChunk(filepath.Join(chunkDir, chunkName(index)), http.MaxBytesReader(w, r.Body, r.ContentLength))
+	}
+
+	chunkUploads.Lock()
+	if err != nil {
+		u.claimed -= claim
+		chunkUploads.Unlock()
+		serverError(w, "Error storing chunk", err)
+		return
+	}
+	u.chunks[index] = r.ContentLength
+	received, complete := len(u.chunks), len(u.chunks) == u.total
+	if complete {
+		// Only the request completing the upload assembles it
+		delete(chunkUploads.uploads, id)
+	}
+	chunkUploads.Unlock()
+
+	if !complete {
+		writeJSON(w, http.StatusAccepted, map[string]any{"id": id, "received": received, "total": u.total})
+		return
+	}
+	defer os.RemoveAll(chunkDir)
+	if u.claimed != u.size {
+		writeJSONError(w, "Chunks don't add up to the declared upload size", http.StatusBadRequest)
+		return
+	}
+
+	uploadsTotal.Inc()
+	dirPath := resolvePath(filepath.Clean(u.dir))
+	result := assembleChunks(r, u.dir, dirPath, u.name, chunkDir, u.total)
+	if result.Error != "" {
+		uploadsError.Inc()
+		writeJSONError(w, result.Error, result.status)
+		return
+	}
+	uploadsSuccess.Inc()
+	uploadCompleted(r, result)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeChunk(chunkPath string, body io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(chunkPath), "part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), chunkPath)
+}
+
+func assembleChunks(r *http.Request, targetDir, dirPath, name, chunkDir string, total int) UploadResult {
+	files := make([]io.Reader, 0, total)
+	var size int64
+	for i := 0; i < total; i++ {
+		f, err := os.Open(filepath.Join(chunkDir, chunkName(i)))
+		if err != nil {
+			slog.Error("Unable to assemble chunked upload", "path", chunkDir, "err", err)
+			return UploadResult{Name: name, Error: "Missing chunk", status: http.StatusBadRequest}
+		}
+		defer f.Close()
+		if info, err := f.Stat(); err == nil {
+			size += info.Size()
+		}
+		files = append(files, f)
+	}
+	if maxUploadSize > 0 && size > maxUploadSize {
+		message := uploadTooLargeMessage()
+		return UploadResult{Name: name, Error: message, status: http.StatusRequestEntityTooLarge}
+	}
+	return saveUpload(r, targetDir, dirPath, name, io.MultiReader(files...))
+}
+
+// sweepChunks drops chunked uploads abandoned for chunkMaxAge, and chunks
+// left without an upload, such as those of uploads running when the server
+// stopped.
+func sweepChunks() {
+	job := registerJob("chunked upload cleanup")
+	for {
+		job.Run(func() error {
+			now := time.Now()
+			active := map[string]bool{}
+			chunkUploads.Lock()
+			for id, u := range chunkUploads.uploads {
+				if now.Sub(u.updated) > chunkMaxAge {
+					delete(chunkUploads.uploads, id)
+					continue
+				}
+				active[id] = true
+			}
+			chunkUploads.Unlock()
+
+			entries, err := os.ReadDir(chunkBaseDir())
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			for _, entry := range entries {
+				if active[entry.Name()] {
+					continue
+				}
+				// Recent directories may belong to an upload being assembled
+				info, err := entry.Info()
+				if err == nil && now.Sub(info.ModTime()) > chunkSweepDur {
+					os.RemoveAll(filepath.Join(chunkBaseDir(), entry.Name()))
+				}
+			}
+			return nil
+		})
+		time.Sleep(chunkSweepDur)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func chunkRequest(t *testing.T, query, body, cookie string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/upload/chunk?"+query, strings.NewReader(body))
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	chunkUploadHandler(w, r)
+	return w
+}
+
+func startChunks(t *testing.T, query, cookie string) string {
+	t.Helper()
+	w := chunkRequest(t, query, "", cookie)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start: status = %d, body %s", w.Code, w.Body)
+	}
+	var resp struct{ ID string }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ID == "" {
+		t.Fatalf("start: no id in %s", w.Body)
+	}
+	return resp.ID
+}
+
+func TestChunkUpload(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/.keep": ""})
+	t.Cleanup(func() { chunkUploads.uploads = map[string]*chunkUpload{} })
+
+	id := startChunks(t, "dir=/docs&name=a.txt&total=2&size=11", "s1")
+	if w := chunkRequest(t, "id="+id+"&index=1", "world", "s1"); w.Code != http.StatusAccepted {
+		t.Fatalf("chunk 1: status = %d, body %s", w.Code, w.Body)
+	}
+	if w := chunkRequest(t, "id="+id+"&index=0", "hello ", "s1"); w.Code != http.StatusOK {
+		t.Fatalf("chunk 0: status = %d, body %s", w.Code, w.Body)
+	}
+	data, err := os.ReadFile(filepath.Join(filesDir, "docs", "a.txt"))
+	if err != nil || string(data) != "hello world" {
+		t.Errorf("assembled file = %q, %v", data, err)
+	}
+	if _, ok := chunkUploads.uploads[id]; ok {
+		t.Error("completed upload still in progress")
+	}
+	if w := chunkRequest(t, "id="+id+"&index=0", "hello ", "s1"); w.Code != http.StatusNotFound {
+		t.Errorf("chunk after completion: status = %d, want 404", w.Code)
+	}
+}
+
+func TestChunkUploadRejects(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/.keep": ""})
+	t.Cleanup(func() { chunkUploads.uploads = map[string]*chunkUpload{} })
+	defer func(size int64) { maxUploadSize = size }(maxUploadSize)
+	maxUploadSize = 100
+
+	if w := chunkRequest(t, "dir=/docs&name=big.bin&total=2&size=101", "", "s1"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("start over MAX_UPLOAD_SIZE: status = %d, want 413", w.Code)
+	}
+	if w := chunkRequest(t, "id=client-chosen&index=0", "x", "s1"); w.Code != http.StatusNotFound {
+		t.Errorf("client-chosen id: status = %d, want 404", w.Code)
+	}
+
+	id := startChunks(t, "dir=/docs&name=b.bin&total=3&size=10", "s1")
+	if w := chunkRequest(t, "id="+id+"&index=0", "12345", "s2"); w.Code != http.StatusNotFound {
+		t.Errorf("chunk from another session: status = %d, want 404", w.Code)
+	}
+	if w := chunkRequest(t, "id="+id+"&index=0", "123456", "s1"); w.Code != http.StatusAccepted {
+		t.Fatalf("chunk 0: status = %d, body %s", w.Code, w.Body)
+	}
+	if w := chunkRequest(t, "id="+id+"&index=1", "12345", "s1"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunks over the declared size: status = %d, want 413", w.Code)
+	}
+	// Resending a chunk replaces it rather than adding to the total
+	if w := chunkRequest(t, "id="+id+"&index=0", "1234", "s1"); w.Code != http.StatusAccepted {
+		t.Errorf("resent chunk 0: status = %d, body %s", w.Code, w.Body)
+	}
+	if w := chunkRequest(t, "id="+id+"&index=1", "12345", "s1"); w.Code != http.StatusAccepted {
+		t.Errorf("chunk 1 after resend: status = %d, body %s", w.Code, w.Body)
+	}
+	if w := chunkRequest(t, "id="+id+"&index=3", "1", "s1"); w.Code != http.StatusBadRequest {
+		t.Errorf("index out of range: status = %d, want 400", w.Code)
+	}
+}
+
+func TestChunkUploadQuota(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/.keep": ""})
+	t.Cleanup(func() { chunkUploads.uploads = map[string]*chunkUpload{} })
+	defer func(q []*Quota) { quotas = q }(quotas)
+	quotas = []*Quota{{Prefix: "/", Limit: 100}}
+
+	startChunks(t, "dir=/docs&name=a.bin&total=1&size=60", "s1")
+	// The first upload's declared size is reserved until it completes
+	if w := chunkRequest(t, "dir=/docs&name=b.bin&total=1&size=60", "", "s1"); w.Code != http.StatusInsufficientStorage {
+		t.Errorf("second upload over quota: status = %d, want 507", w.Code)
+	}
+	startChunks(t, "dir=/docs&name=c.bin&total=1&size=40", "s1")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	clamdTimeout   = 2 * time.Minute
+	clamdChunkSize = 64 << 10
+)
+
+// Returned when clamd reports a signature for an upload
+type InfectedError struct {
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return "infected with " + e.Signature
+}
+
+// Returned when the scan could not be completed
+var errScanFailed = errors.New("virus scan failed")
+
+// dialClamd connects to clamdAddress, given as tcp://host:port,
+// unix:///path/to/socket or a bare socket path.
+func dialClamd() (net.Conn, error) {
+	network, address := "tcp", clamdAddress
+	switch {
+	case strings.HasPrefix(clamdAddress, "tcp://"):
+		address = strings.TrimPrefix(clamdAddress, "tcp://")
+	case strings.HasPrefix(clamdAddress, "unix://"):
+		network, address = "unix", strings.TrimPrefix(clamdAddress, "unix://")
+	case strings.HasPrefix(clamdAddress, "/"):
+		network = "unix"
+	}
+	return net.DialTimeout(network, address, 10*time.Second)
+}
+
+// scanFile streams the file to clamd with the INSTREAM command. It returns
+// nil for clean files, an *InfectedError when a signature matched and an
+// error wrapping errScanFailed otherwise.
+func scanFile(filePath string) error {
+	if clamdAddress == "" {
+		return nil
+	}
+	err := clamdScan(filePath)
+	var infected *InfectedError
+	switch {
+	case err == nil:
+		virusScansClean.Inc()
+	case errors.As(err, &infected):
+		virusScansInfected.Inc()
+	default:
+		virusScansError.Inc()
+		err = fmt.Errorf("%w: %v", errScanFailed, err)
+	}
+	return err
+}
+
+func clamdScan(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	conn, err := dialClamd()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdTimeout))
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, err := conn.Write(size); err != nil {
+				return err
+			}
+			if _, err := conn.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return err
+	}
+	result := string(bytes.TrimRight(reply, "\x00"))
+	result = strings.TrimPrefix(result, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(result, " FOUND")}
+	default:
+		return fmt.Errorf("clamd: %s", result)
+	}
+}
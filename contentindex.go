@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/gob"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	indexInterval = 5 * time.Minute
+	// Larger files are left out of the index
+	indexMaxFileSize = 10 << 20
+	indexMinTermLen  = 2
+	indexMaxTermLen  = 64
+	indexFileName    = "content-index.gob"
+)
+
+// Indexed state of one file
+type indexedDoc struct {
+	Size    int64
+	ModTime time.Time
+	Terms   []string
+}
+
+// Inverted index of the words in text files below filesDir, keyed by URL path
+type ContentIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]*indexedDoc
+	postings map[string]map[string]struct{}
+	dirty    bool
+}
+
+var contentIndex = &ContentIndex{
+	docs:     make(map[string]*indexedDoc),
+	postings: make(map[string]map[string]struct{}),
+}
+
+// tokenize splits text into unique lowercase words.
+func tokenize(text string) []string {
+	seen := make(map[string]struct{})
+	var terms []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		word = foldName(word)
+		if len(word) < indexMinTermLen || len(word) > indexMaxTermLen {
+			continue
+		}
+		if _, ok := seen[word]; !ok {
+			seen[word] = struct{}{}
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+func (idx *ContentIndex) addLocked(urlPath string, doc *indexedDoc) {
+	idx.removeLocked(urlPath)
+	idx.docs[urlPath] = doc
+	for _, term := range doc.Terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]struct{})
+		}
+		idx.postings[term][urlPath] = struct{}{}
+	}
+	idx.dirty = true
+}
+
+func (idx *ContentIndex) removeLocked(urlPath string) {
+	doc, ok := idx.docs[urlPath]
+	if !ok {
+		return
+	}
+	for _, term := range doc.Terms {
+		delete(idx.postings[term], urlPath)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.docs, urlPath)
+	idx.dirty = true
+}
+
+// update indexes the file at fullPath unless it is unchanged since the last
+// run, and drops it from the index when it is gone or no longer text.
+func (idx *ContentIndex) update(urlPath, fullPath string) {
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > indexMaxFileSize {
+		idx.mu.Lock()
+		idx.removeLocked(urlPath)
+		idx.mu.Unlock()
+		return
+	}
+
+	idx.mu.RLock()
+	doc, ok := idx.docs[urlPath]
+	idx.mu.RUnlock()
+	if ok && doc.Size == info.Size() && doc.ModTime.Equal(info.ModTime()) {
+		return
+	}
+
+	var terms []string
+	if isTextFile(fullPath) {
+		if data, err := os.ReadFile(fullPath); err == nil {
+			terms = tokenize(string(data))
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.addLocked(urlPath, &indexedDoc{Size: info.Size(), ModTime: info.ModTime(), Terms: terms})
+}
+
+// size reports the number of indexed files.
+func (idx *ContentIndex) size() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.docs)
+}
+
+// search returns the paths below dir containing every word of query.
+func (idx *ContentIndex) search(dir, query string) []string {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	// Start from the rarest term to keep the intersection small
+	sort.Slice(terms, func(i, j int) bool {
+		return len(idx.postings[terms[i]]) < len(idx.postings[terms[j]])
+	})
+	var matches []string
+	for urlPath := range idx.postings[terms[0]] {
+		if !strings.HasPrefix(urlPath, prefix) {
+			continue
+		}
+		found := true
+		for _, term := range terms[1:] {
+			if _, ok := idx.postings[term][urlPath]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			matches = append(matches, urlPath)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// reindex walks filesDir, updating changed files and dropping removed ones.
+func (idx *ContentIndex) reindex() error {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(filesDir, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := d.Name()
+		if fullPath != filesDir && (strings.HasPrefix(name, stagingPrefix) || name == accessFileName) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(filesDir, fullPath)
+		if err != nil {
+			return nil
+		}
+		urlPath := path.Join("/", filepath.ToSlash(rel))
+		seen[urlPath] = true
+		idx.update(urlPath, fullPath)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	for urlPath := range idx.docs {
+		if !seen[urlPath] {
+			idx.removeLocked(urlPath)
+		}
+	}
+	idx.mu.Unlock()
+	return idx.save()
+}
+
+// save writes the indexed documents to indexDir when anything changed.
+// Postings are rebuilt on load.
+func (idx *ContentIndex) save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.dirty || indexDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(indexDir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(indexDir, indexFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = gob.NewEncoder(tmp).Encode(idx.docs)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(indexDir, indexFileName)); err != nil {
+		return err
+	}
+	idx.dirty = false
+	return nil
+}
+
+func (idx *ContentIndex) load() error {
+	f, err := os.Open(filepath.Join(indexDir, indexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	var docs map[string]*indexedDoc
+	if err := gob.NewDecoder(f).Decode(&docs); err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for urlPath, doc := range docs {
+		idx.addLocked(urlPath, doc)
+	}
+	idx.dirty = false
+	return nil
+}
+
+// indexContents loads the stored index and keeps it up to date.
+func indexContents() {
+	if err := contentIndex.load(); err != nil {
+		slog.Warn("Unable to load content index, rebuilding", "err", err)
+	}
+	job := registerJob("content index")
+	for {
+		job.Run(contentIndex.reindex)
+		time.Sleep(indexInterval)
+	}
+}
+
+// indexUpload refreshes the index entry of a new or replaced file right away.
+func indexUpload(urlPath string) {
+	if !enableContentIndex {
+		return
+	}
+	go contentIndex.update(urlPath, resolvePath(urlPath))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// How long browsers may cache a preflight response, in seconds
+const corsMaxAge = 600
+
+// corsOriginAllowed reports whether origin may call the API, either listed
+// in CORS_ORIGINS or allowed by a "*" entry.
+func corsOriginAllowed(origin string) bool {
+	return slices.Contains(corsOrigins, "*") || slices.Contains(corsOrigins, origin)
+}
+
+// withCORS adds CORS headers for the allowed origins and answers preflight
+// requests itself, before authentication, since browsers send them without
+// credentials.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !corsOriginAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !slices.Contains(corsOrigins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		if corsCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, Location, Retry-After")
+		next.ServeHTTP(w, r)
+	})
+}
+
+func formatCORS() string {
+	if len(corsOrigins) == 0 {
+		return "(disabled)"
+	}
+	summary := strings.Join(corsOrigins, ", ") + "; " + strings.Join(corsMethods, ", ")
+	if corsCredentials {
+		summary += "; with credentials"
+	}
+	return summary
+}
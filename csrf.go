@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Session cookie holding the browser's CSRF token
+	csrfCookieName = "filebrowser-csrf"
+	// Form field, query parameter and header carrying the token back
+	csrfFieldName  = "csrf"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// csrfToken returns the CSRF token of the browser session, issuing a new
+// one in a session cookie on its first page.
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && len(cookie.Value) == 64 {
+		return cookie.Value
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     prefixURL("/"),
+		HttpOnly: true,
+		Secure:   requestScheme(r) == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	// Later reads in the same request see the new token
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+	return token
+}
+
+// submittedCSRFToken returns the token sent with a request: in the header
+// for scripts, the query for multipart forms, whose body the handler parses
+// itself, or the field of a urlencoded form.
+func submittedCSRFToken(r *http.Request) string {
+	if token := r.Header.Get(csrfHeaderName); token != "" {
+		return token
+	}
+	if token := r.URL.Query().Get(csrfFieldName); token != "" {
+		return token
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		return r.PostFormValue(csrfFieldName)
+	}
+	return ""
+}
+
+// needsCSRFCheck reports whether r may have been forged by another site:
+// a state changing request made by a browser, which sends Sec-Fetch-Site or
+// Origin, without an API token and not from a CORS origin. Scripts and
+// command line clients do not send cookies on their own and are let through.
+func needsCSRFCheck(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin != "" && len(corsOrigins) > 0 && corsOriginAllowed(origin) {
+		return false
+	}
+	return origin != "" || r.Header.Get("Sec-Fetch-Site") != ""
+}
+
+// requireCSRF refuses browser requests changing state without the session's
+// CSRF token, so other sites cannot upload or rename through a logged in
+// visitor.
+func requireCSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if needsCSRFCheck(r) {
+			cookie, err := r.Cookie(csrfCookieName)
+			submitted := submittedCSRFToken(r)
+			if err != nil || submitted == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(submitted)) != 1 {
+				slog.Warn("Refused request with a missing or invalid CSRF token", "method", r.Method, "path", r.URL.Path, "client", clientIP(r))
+				serveError(w, r, http.StatusForbidden, "Missing or invalid CSRF token, reload the page and try again")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNeedsCSRFCheck(t *testing.T) {
+	defer func(origins []string) { corsOrigins = origins }(corsOrigins)
+	corsOrigins = []string{"https://app.example.com"}
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"get from browser", "GET", map[string]string{"Sec-Fetch-Site": "cross-site"}, false},
+		{"post from browser", "POST", map[string]string{"Sec-Fetch-Site": "same-origin"}, true},
+		{"post with origin", "POST", map[string]string{"Origin": "https://evil.example"}, true},
+		{"post from curl", "POST", nil, false},
+		{"post with api token", "POST", map[string]string{"Origin": "https://evil.example", "Authorization": "Bearer abc"}, false},
+		{"post from cors origin", "POST", map[string]string{"Origin": "https://app.example.com"}, false},
+		{"delete from browser", "DELETE", map[string]string{"Sec-Fetch-Site": "same-site"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/mkdir", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := needsCSRFCheck(r); got != tt.want {
+				t.Errorf("needsCSRFCheck = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireCSRF(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	handler := requireCSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	form := func(value string) *http.Request {
+		r := httptest.NewRequest("POST", "/mkdir", strings.NewReader(url.Values{"csrf": {value}, "name": {"x"}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	header := func(value string) *http.Request {
+		r := httptest.NewRequest("POST", "/rename", nil)
+		r.Header.Set(csrfHeaderName, value)
+		return r
+	}
+	query := func(value string) *http.Request {
+		return httptest.NewRequest("POST", "/upload?csrf="+value, nil)
+	}
+	tests := []struct {
+		name   string
+		r      *http.Request
+		cookie string
+		want   int
+	}{
+		{"form field", form(token), token, http.StatusOK},
+		{"header", header(token), token, http.StatusOK},
+		{"query", query(token), token, http.StatusOK},
+		{"wrong token", form(strings.Repeat("0", 64)), token, http.StatusForbidden},
+		{"missing token", form(""), token, http.StatusForbidden},
+		{"missing cookie", header(token), "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.r.Header.Set("Sec-Fetch-Site", "same-origin")
+			if tt.cookie != "" {
+				tt.r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSRFToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	token := csrfToken(w, r)
+	if len(token) != 64 {
+		t.Fatalf("token = %q, want 64 hex characters", token)
+	}
+	if again := csrfToken(httptest.NewRecorder(), r); again != token {
+		t.Errorf("second call in the same request = %q, want %q", again, token)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookieName || cookies[0].Value != token || !cookies[0].HttpOnly {
+		t.Errorf("cookies = %v, want an HttpOnly %s cookie with the token", cookies, csrfCookieName)
+	}
+}
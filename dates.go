@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	// The image is built FROM scratch, without /usr/share/zoneinfo, so TZ
+	// needs the embedded copy of the time zone database.
+	_ "time/tzdata"
+)
+
+// Layout of the listing's dates unless DATE_FORMAT says otherwise
+const defaultDateFormat = "2006-01-02 15:04-07:00"
+
+// Time zone the pages show dates in, from TZ
+var displayLocation = time.Local
+
+// loadTimeZone resolves the TZ setting, with or without the leading colon
+// POSIX allows. Empty keeps the system's zone.
+func loadTimeZone(name string) (*time.Location, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), ":")
+	if name == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// checkDateFormat refuses DATE_FORMAT values without any layout element,
+// which would render every date as the same literal text.
+func checkDateFormat(layout string) error {
+	if layout == "" || time.Unix(0, 0).Format(layout) == layout {
+		return errors.New("layout has no date or time elements, see https://pkg.go.dev/time#Layout")
+	}
+	return nil
+}
+
+// formatDate renders t in the configured zone and layout.
+func formatDate(t time.Time) string {
+	return t.In(displayLocation).Format(dateFormat)
+}
+
+// formatRelativeDate renders t relative to now in lang, like "2 hours ago",
+// falling back to the absolute date past a month.
+func formatRelativeDate(lang string, t, now time.Time) string {
+	d := now.Sub(t)
+	switch {
+	case d < 0:
+		return formatDate(t)
+	case d < time.Minute:
+		return translate(lang, "just now")
+	case d < 2*time.Minute:
+		return translate(lang, "1 minute ago")
+	case d < time.Hour:
+		return translate(lang, "%d minutes ago", int(d/time.Minute))
+	case d < 2*time.Hour:
+		return translate(lang, "1 hour ago")
+	case d < 24*time.Hour:
+		return translate(lang, "%d hours ago", int(d/time.Hour))
+	case d < 48*time.Hour:
+		return translate(lang, "yesterday")
+	case d < 30*24*time.Hour:
+		return translate(lang, "%d days ago", int(d/(24*time.Hour)))
+	}
+	return formatDate(t)
+}
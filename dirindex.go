@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// File served in place of a directory listing when SERVE_INDEX is set
+const directoryIndexName = "index.html"
+
+// directoryIndex returns the index.html of dirPath when the request should
+// get it instead of the listing: SERVE_INDEX is on, or SPA_FALLBACK for the
+// root, ?listing=1 is absent and the client may read the file.
+func directoryIndex(r *http.Request, dirPath, urlPath string) (string, bool) {
+	if !(serveIndex || spaFallback && urlPath == "/") || r.URL.Query().Get("listing") == "1" {
+		return "", false
+	}
+	indexPath := filepath.Join(dirPath, directoryIndexName)
+	info, err := os.Stat(indexPath)
+	if err != nil || !info.Mode().IsRegular() || !withinRoot(indexPath) {
+		return "", false
+	}
+	if blockIgnored && isIgnored(indexPath) {
+		return "", false
+	}
+	return indexPath, permitted(r, path.Join(urlPath, directoryIndexName), PermRead)
+}
+
+// spaFallbackIndex returns the root index.html for a request to a missing path
+// with SPA_FALLBACK on, letting a single-page app in the root handle its own
+// routes. Only browser navigation qualifies: GET or HEAD and not JSON.
+func spaFallbackIndex(r *http.Request) (string, bool) {
+	if !spaFallback || (r.Method != http.MethodGet && r.Method != http.MethodHead) || wantsJSON(r) {
+		return "", false
+	}
+	indexPath := filepath.Join(filesDir, directoryIndexName)
+	info, err := os.Stat(indexPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", false
+	}
+	if !checkAccess(r, filesDir) {
+		return "", false
+	}
+	return indexPath, permitted(r, "/"+directoryIndexName, PermRead)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Recursive size of a directory as of the last walk
+type dirSizeEntry struct {
+	size     int64
+	computed time.Time
+}
+
+var dirSizes = struct {
+	sync.Mutex
+	entries map[string]dirSizeEntry
+	pending map[string]bool
+}{
+	entries: make(map[string]dirSizeEntry),
+	pending: make(map[string]bool),
+}
+
+var dirSizeQueue = make(chan string, 256)
+
+// Expired entries are dropped once the cache grows past this
+const dirSizeMaxEntries = 10000
+
+// cachedDirSize returns the last computed size of dir, queueing a walk when
+// it is missing or older than dirSizeTTL. Stale sizes are still returned so
+// listings never wait for a walk.
+func cachedDirSize(dir string) (int64, bool) {
+	dirSizes.Lock()
+	defer dirSizes.Unlock()
+
+	entry, ok := dirSizes.entries[dir]
+	if (!ok || time.Since(entry.computed) > dirSizeTTL) && !dirSizes.pending[dir] {
+		select {
+		case dirSizeQueue <- dir:
+			dirSizes.pending[dir] = true
+		default:
+		}
+	}
+	return entry.size, ok
+}
+
+// walkDirSizes computes queued directory sizes in the background.
+func walkDirSizes() {
+	job := registerJob("directory sizes")
+	for dir := range dirSizeQueue {
+		job.Run(func() error {
+			size, err := dirSize(dir)
+
+			dirSizes.Lock()
+			defer dirSizes.Unlock()
+			delete(dirSizes.pending, dir)
+			if err != nil {
+				slog.Warn("Unable to compute directory size", "path", dir, "err", err)
+				return err
+			}
+			dirSizes.entries[dir] = dirSizeEntry{size: size, computed: time.Now()}
+			if len(dirSizes.entries) > dirSizeMaxEntries {
+				for key, entry := range dirSizes.entries {
+					if time.Since(entry.computed) > dirSizeTTL {
+						delete(dirSizes.entries, key)
+					}
+				}
+			}
+			return nil
+		})
+	}
+}
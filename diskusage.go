@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Capacity of the filesystem backing a path
+type DiskUsage struct {
+	TotalBytes  uint64
+	FreeBytes   uint64
+	AvailBytes  uint64
+	TotalInodes uint64
+	FreeInodes  uint64
+}
+
+func (d DiskUsage) UsedBytes() uint64 {
+	return d.TotalBytes - d.FreeBytes
+}
+
+func (d DiskUsage) UsedInodes() uint64 {
+	return d.TotalInodes - d.FreeInodes
+}
+
+const diskUsageInterval = 30 * time.Second
+
+// Last known capacity of the files dir, nil until the first successful statfs
+var lastDiskUsage atomic.Pointer[DiskUsage]
+
+// refreshDiskUsage periodically samples the filesystem capacity so scrapes
+// never block on statfs.
+func refreshDiskUsage() {
+	job := registerJob("filesystem capacity")
+	for {
+		job.Run(func() error {
+			usage, err := statDisk(filesDir)
+			if err != nil {
+				slog.Warn("Unable to read filesystem capacity", "path", filesDir, "err", err)
+				return err
+			}
+			lastDiskUsage.Store(&usage)
+			return nil
+		})
+		time.Sleep(diskUsageInterval)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package main
+
+import "errors"
+
+func statDisk(path string) (DiskUsage, error) {
+	return DiskUsage{}, errors.New("filesystem capacity is not supported on this platform")
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+)
+
+// Page showing a single file inside the site chrome, either as rendered
+// HTML or embedded in a frame
+type Document struct {
+	Content template.HTML
+	Frame   string
+	// Page specific script, run after the content is in place
+	Script template.JS
+	// Links shown next to the breadcrumbs
+	Actions []Crumb
+	// Page name and breadcrumbs, derived from the file path when empty
+	Name        string
+	Breadcrumbs []Crumb
+	// Response status, 200 when unset
+	Status int
+}
+
+// serveDocument renders doc for the file at urlPath.
+func serveDocument(w http.ResponseWriter, r *http.Request, urlPath string, doc Document) {
+	tmpl, err := parseTemplates(requestLanguage(r), requestSizeUnits(r))
+	if err != nil {
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+
+	if doc.Name == "" {
+		doc.Name = path.Base(urlPath)
+	}
+	if doc.Breadcrumbs == nil {
+		doc.Breadcrumbs = append(buildBreadcrumbs(path.Dir(urlPath)), Crumb{Label: doc.Name, URL: doc.Name})
+	}
+
+	data := struct {
+		Document
+		Title        string
+		ExtraHeaders string
+		GitCommit    string
+		BuildDate    string
+		Theme        string
+	}{
+		Document:     doc,
+		Title:        title,
+		ExtraHeaders: extraHeaders,
+		GitCommit:    GitCommit,
+		BuildDate:    BuildDate,
+		Theme:        requestTheme(r),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if doc.Status != 0 {
+		w.WriteHeader(doc.Status)
+	}
+	tmpl.ExecuteTemplate(w, "document", data)
+}
+
+const documentTemplate = `<!DOCTYPE html>
+<html lang="{{lang}}"{{with .Theme}} data-theme="{{.}}"{{end}}>
+<head>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}} - {{.Title}}</title>
+{{- with faviconURL}}
+<link rel="icon" href="{{.}}">
+{{- else}}
+<link rel="icon" href="data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'><text y='14' font-size='14'>📄</text></svg>">
+{{- end}}
+{{.ExtraHeaders | safeHTML}}
+{{- template "head" .}}
+<style>
+{{- template "style" .}}
+</style>
+<link rel="stylesheet" href="{{url "/_assets/theme.css"}}">
+{{- with customCSS}}
+<style>{{.}}</style>
+{{- end}}
+</head>
+<body>
+  <header>
+    <div class="title-bar">
+      <h1>{{with logoURL}}<img class="logo" src="{{.}}" alt="">{{end}}{{range .Breadcrumbs}}<a href="{{.URL}}">{{.Label}}</a>{{end}}</h1>
+      <span class="download-links">
+        {{range .Actions}}<a href="{{.URL}}">{{.Label}}</a>{{end}}
+      </span>
+    </div>
+  </header>
+
+  <main>
+    {{if .Frame}}<iframe class="preview-frame" src="{{.Frame}}" title="{{.Name}}"></iframe>
+    {{else}}<article class="document">{{.Content}}</article>{{end}}
+  </main>
+
+  <footer>
+    {{t "Build"}}: {{.GitCommit}} | {{.BuildDate}}
+    {{- with customFooter}} | <span class="custom-footer">{{.}}</span>{{end}}
+    <button class="theme-toggle" onclick="toggleTheme()" title="{{t "Switch theme"}}">🌓</button>
+  </footer>
+
+  <script>
+    // Cycles through the themes; classic has no data-theme and follows the system
+    const themes = {{themes}};
+    function toggleTheme() {
+      const html = document.documentElement;
+      const current = html.getAttribute('data-theme') || 'classic';
+      const next = themes[(themes.indexOf(current) + 1) % themes.length];
+      if (next === 'classic') html.removeAttribute('data-theme');
+      else html.setAttribute('data-theme', next);
+      document.cookie = 'filebrowser-theme=' + next + '; path=/; max-age=31536000; SameSite=Lax';
+    }
+    {{- .Script}}
+  </script>
+</body>
+</html>`
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Session cookie set by the listing's toggle to show dotfiles
+const dotfilesCookie = "filebrowser-dotfiles"
+
+// showDotfiles reports whether listings include names starting with a dot.
+// With HIDE_DOTFILES they are shown only for ?hidden=1 or when the session
+// cookie asks for them.
+func showDotfiles(r *http.Request) bool {
+	if !hideDotfiles {
+		return true
+	}
+	switch r.URL.Query().Get("hidden") {
+	case "1":
+		return true
+	case "0":
+		return false
+	}
+	cookie, err := r.Cookie(dotfilesCookie)
+	return err == nil && cookie.Value == "show"
+}
+
+// filterDotfiles drops dotfiles from entries unless the request shows them.
+func filterDotfiles(r *http.Request, entries []os.DirEntry) []os.DirEntry {
+	if showDotfiles(r) {
+		return entries
+	}
+	visible := make([]os.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), ".") {
+			visible = append(visible, entry)
+		}
+	}
+	return visible
+}
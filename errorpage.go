@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Data available to error page templates
+type ErrorPage struct {
+	Status     int
+	StatusText string
+	Message    string
+	Path       string
+	Title      string
+}
+
+// Templates from errorPagesDir by status code; 0 holds error.html, used for
+// statuses without their own page
+var errorPages map[int]*template.Template
+
+// Status codes with a dedicated template in errorPagesDir
+var errorPageStatuses = []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError}
+
+// loadErrorPages parses 403.html, 404.html, 500.html and error.html from dir,
+// skipping the ones that do not exist.
+func loadErrorPages(dir string) (map[int]*template.Template, error) {
+	pages := make(map[int]*template.Template)
+	names := map[int]string{0: "error.html"}
+	for _, status := range errorPageStatuses {
+		names[status] = strconv.Itoa(status) + ".html"
+	}
+	for status, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(name).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		pages[status] = tmpl
+	}
+	return pages, nil
+}
+
+// serveError answers with status and message: JSON for API clients, an
+// error page in the request's language for browsers and plain text
+// otherwise. The message must not contain filesystem paths.
+func serveError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsJSON(r) {
+		writeJSONError(w, message, status)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Error(w, message, status)
+		return
+	}
+
+	lang := requestLanguage(r)
+	page := ErrorPage{
+		Status:     status,
+		StatusText: translate(lang, http.StatusText(status)),
+		Message:    translate(lang, message),
+		Path:       r.URL.Path,
+		Title:      title,
+	}
+	tmpl := errorPages[status]
+	if tmpl == nil {
+		tmpl = errorPages[0]
+	}
+	if tmpl != nil {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, page); err != nil {
+			slog.Error("Unable to render error page", "status", status, "err", err)
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(status)
+			buf.WriteTo(w)
+			return
+		}
+	}
+
+	serveDocument(w, r, r.URL.Path, Document{
+		Status:      status,
+		Content:     template.HTML(fmt.Sprintf("<h2>%d %s</h2><p>%s</p><p><a href=\"%s\">%s</a></p>", status, template.HTMLEscapeString(page.StatusText), template.HTMLEscapeString(page.Message), template.HTMLEscapeString(prefixURL("/")), template.HTMLEscapeString(translate(lang, "Back to the start")))),
+		Name:        page.StatusText,
+		Breadcrumbs: append(buildBreadcrumbs("/"), Crumb{Label: page.StatusText, URL: ""}),
+	})
+}
+
+// notFound is serveError for a missing path.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	serveError(w, r, http.StatusNotFound, "Not found")
+}
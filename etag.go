@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// listingETag returns a weak ETag for a listing of infos, which changes when
+// an entry is added, removed, resized or modified. variant tells apart the
+// renderings of the same directory, like HTML and JSON, and carries the
+// parts of the page that change on their own, such as the disk usage and
+// quota in the footer. Recursive directory sizes are left out, hence the
+// weak validator.
+func listingETag(infos []fs.FileInfo, variant ...string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", GitCommit)
+	for _, v := range variant {
+		fmt.Fprintf(h, "%s\x00", v)
+	}
+	for _, info := range infos {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00%d\x00", info.Name(), info.Size(), info.ModTime().UnixNano(), info.Mode())
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// listingNotModified sets the ETag of a listing and answers 304 when the
+// client's If-None-Match already holds it.
+func listingNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Add("Vary", "Accept")
+	w.Header().Set("ETag", etag)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether the If-None-Match header value lists etag,
+// using the weak comparison of RFC 9110.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Photo metadata parsed from EXIF
+type ExifInfo struct {
+	Make         string   `json:"make,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	Lens         string   `json:"lens,omitempty"`
+	Width        int      `json:"width,omitempty"`
+	Height       int      `json:"height,omitempty"`
+	Taken        string   `json:"taken,omitempty"`
+	ExposureTime string   `json:"exposureTime,omitempty"`
+	FNumber      float64  `json:"fNumber,omitempty"`
+	ISO          int      `json:"iso,omitempty"`
+	FocalLength  float64  `json:"focalLength,omitempty"`
+	Latitude     *float64 `json:"latitude,omitempty"`
+	Longitude    *float64 `json:"longitude,omitempty"`
+}
+
+// Camera combines make and model, skipping the make when the model
+// already starts with the brand, e.g. "NIKON CORPORATION" + "NIKON D2H".
+func (e *ExifInfo) Camera() string {
+	brand, _, _ := strings.Cut(e.Make, " ")
+	if brand != "" && strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(brand)) {
+		return e.Model
+	}
+	return strings.TrimSpace(e.Make + " " + e.Model)
+}
+
+func (e *ExifInfo) Coordinates() string {
+	if e.Latitude == nil || e.Longitude == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.5f, %.5f", *e.Latitude, *e.Longitude)
+}
+
+func hasExif(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".tif", ".tiff":
+		return true
+	}
+	return false
+}
+
+// readExif parses the EXIF block of an image. GPS coordinates are only
+// included when exifGPS is enabled.
+func readExif(fullPath string) (*ExifInfo, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	x, err := exif.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ExifInfo{
+		Make:  exifString(x, exif.Make),
+		Model: exifString(x, exif.Model),
+		Lens:  exifString(x, exif.LensModel),
+		ISO:   exifInt(x, exif.ISOSpeedRatings),
+	}
+	if taken, err := x.DateTime(); err == nil {
+		info.Taken = taken.Format(time.RFC3339)
+	}
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && den != 0 {
+			if num == 1 || num == 0 {
+				info.ExposureTime = fmt.Sprintf("%d/%d", num, den)
+			} else {
+				info.ExposureTime = fmt.Sprintf("%g", float64(num)/float64(den))
+			}
+		}
+	}
+	info.FNumber = exifFloat(x, exif.FNumber)
+	info.FocalLength = exifFloat(x, exif.FocalLength)
+	if exifGPS {
+		if lat, long, err := x.LatLong(); err == nil {
+			info.Latitude, info.Longitude = &lat, &long
+		}
+	}
+
+	if _, err := f.Seek(0, 0); err == nil {
+		if config, _, err := image.DecodeConfig(f); err == nil {
+			info.Width, info.Height = config.Width, config.Height
+		}
+	}
+	if info.Width == 0 {
+		info.Width = exifInt(x, exif.PixelXDimension)
+		info.Height = exifInt(x, exif.PixelYDimension)
+	}
+	return info, nil
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	value, _ := tag.StringVal()
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+func exifInt(x *exif.Exif, name exif.FieldName) int {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.IntVal {
+		return 0
+	}
+	value, _ := tag.Int(0)
+	return value
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.RatVal {
+		return 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
+
+// exifHandler serves GET /exif?path=..., the EXIF metadata of an image as JSON.
+func exifHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	urlPath, fullPath, ok := resolveTarget(r.URL.Query().Get("path"))
+	if !ok || !hasExif(fullPath) {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !checkAccess(r, filepath.Dir(fullPath)) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermRead) {
+		denyPermission(w, r)
+		return
+	}
+
+	info, err := readExif(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeJSONError(w, "Not found", http.StatusNotFound)
+		} else {
+			writeJSONError(w, "No EXIF data", http.StatusNotFound)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Allowed and blocked upload types. Extensions are compared case
+// insensitively with their leading dot; MIME patterns match the type sniffed
+// from the first bytes of the file and may end in "/*".
+type TypeFilter struct {
+	AllowExt  []string
+	DenyExt   []string
+	AllowMIME []string
+	DenyMIME  []string
+}
+
+var uploadTypes TypeFilter
+
+func parseExtList(value string) []string {
+	var exts []string
+	for _, ext := range splitList(strings.ToLower(value)) {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+	return exts
+}
+
+func (f TypeFilter) sniffs() bool {
+	return len(f.AllowMIME) > 0 || len(f.DenyMIME) > 0
+}
+
+// allowsName checks the file extension against the allow and deny lists.
+func (f TypeFilter) allowsName(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if slices.Contains(f.DenyExt, ext) {
+		return false
+	}
+	return len(f.AllowExt) == 0 || slices.Contains(f.AllowExt, ext)
+}
+
+// allowsType checks a sniffed content type against the MIME patterns.
+func (f TypeFilter) allowsType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	matches := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+				if strings.HasPrefix(mediaType, prefix+"/") {
+					return true
+				}
+			} else if mediaType == pattern {
+				return true
+			}
+		}
+		return false
+	}
+	if matches(f.DenyMIME) {
+		return false
+	}
+	return len(f.AllowMIME) == 0 || matches(f.AllowMIME)
+}
+
+// sniffUpload peeks at the start of src and reports whether its content type
+// is accepted, returning a reader that still yields the whole content.
+func (f TypeFilter) sniffUpload(src io.Reader) (io.Reader, bool) {
+	if !f.sniffs() {
+		return src, true
+	}
+	buffered := bufio.NewReaderSize(src, 512)
+	head, _ := buffered.Peek(512)
+	return buffered, f.allowsType(http.DetectContentType(head))
+}
+
+func (f TypeFilter) String() string {
+	var parts []string
+	add := func(label string, values []string) {
+		if len(values) > 0 {
+			parts = append(parts, label+" "+strings.Join(values, ","))
+		}
+	}
+	add("allow", f.AllowExt)
+	add("deny", f.DenyExt)
+	add("allow", f.AllowMIME)
+	add("deny", f.DenyMIME)
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// <meta> tag from HEAD_META
+type HeadMeta struct {
+	Name    string
+	Content string
+}
+
+// parseHeadMeta reads HEAD_META, semicolon separated name=content pairs,
+// since meta contents often hold commas.
+func parseHeadMeta(value string) ([]HeadMeta, error) {
+	var metas []HeadMeta
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, content, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid meta %q, expected name=content", entry)
+		}
+		metas = append(metas, HeadMeta{Name: strings.TrimSpace(name), Content: strings.TrimSpace(content)})
+	}
+	return metas, nil
+}
+
+// withSecurityHeaders sets the security related response headers on every
+// response. HSTS is only sent over HTTPS, where browsers honour it.
+func withSecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		if frameOptions != "" {
+			h.Set("X-Frame-Options", frameOptions)
+		}
+		if referrerPolicy != "" {
+			h.Set("Referrer-Policy", referrerPolicy)
+		}
+		if contentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", contentSecurityPolicy)
+		}
+		if hstsMaxAge > 0 && requestScheme(r) == "https" {
+			h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(hstsMaxAge)+"; includeSubDomains")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func formatSecurityHeaders() string {
+	parts := []string{"nosniff"}
+	if frameOptions != "" {
+		parts = append(parts, "frames "+frameOptions)
+	}
+	if referrerPolicy != "" {
+		parts = append(parts, "referrer "+referrerPolicy)
+	}
+	if contentSecurityPolicy != "" {
+		parts = append(parts, "CSP")
+	}
+	if hstsMaxAge > 0 {
+		parts = append(parts, "HSTS "+strconv.Itoa(hstsMaxAge)+"s")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	hexDefaultLimit = 4096
+	hexMaxLimit     = 64 << 10
+	hexBytesPerLine = 16
+)
+
+// serveHexView renders a hex and ASCII dump of limit bytes of the file
+// starting at offset, with links to the neighbouring pages.
+func serveHexView(w http.ResponseWriter, r *http.Request, fullPath, urlPath string, size int64) {
+	query := r.URL.Query()
+	offset, err := parseHexParam(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid offset", http.StatusBadRequest)
+		return
+	}
+	limit, err := parseHexParam(query.Get("limit"), hexDefaultLimit)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	limit = min(limit, hexMaxLimit)
+	offset -= offset % hexBytesPerLine
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	buf := make([]byte, limit)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	var dump strings.Builder
+	dump.WriteString(`<pre class="hexdump">`)
+	if n == 0 {
+		dump.WriteString("(no data at this offset)")
+	}
+	for line := 0; line < n; line += hexBytesPerLine {
+		writeHexLine(&dump, offset+int64(line), buf[line:min(line+hexBytesPerLine, n)])
+	}
+	dump.WriteString("</pre>")
+
+	name := filepath.Base(fullPath)
+	actions := []Crumb{}
+	if offset > 0 {
+		actions = append(actions, Crumb{Label: "‹ prev", URL: hexPageURL(max(offset-limit, 0), limit)})
+	}
+	actions = append(actions, Crumb{Label: fmt.Sprintf("%d-%d of %d", offset, offset+int64(n), size), URL: hexPageURL(offset, limit)})
+	if offset+int64(n) < size {
+		actions = append(actions, Crumb{Label: "next ›", URL: hexPageURL(offset+limit, limit)})
+	}
+	actions = append(actions, Crumb{Label: "open", URL: name})
+
+	serveDocument(w, r, urlPath, Document{Content: template.HTML(dump.String()), Actions: actions})
+}
+
+func parseHexParam(value string, fallback int64) (int64, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.ParseInt(value, 0, 64)
+}
+
+func hexPageURL(offset, limit int64) string {
+	return fmt.Sprintf("?view=hex&offset=%d&limit=%d", offset, limit)
+}
+
+// writeHexLine writes one "offset  hex bytes  |ascii|" line, HTML escaped.
+func writeHexLine(b *strings.Builder, offset int64, data []byte) {
+	fmt.Fprintf(b, "%08x  ", offset)
+	for i := 0; i < hexBytesPerLine; i++ {
+		if i < len(data) {
+			fmt.Fprintf(b, "%02x ", data[i])
+		} else {
+			b.WriteString("   ")
+		}
+		if i == hexBytesPerLine/2-1 {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(" |")
+	for _, c := range data {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		b.WriteString(template.HTMLEscapeString(string(c)))
+	}
+	b.WriteString("|\n")
+}
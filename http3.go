@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// serveHTTP3 starts an HTTP/3 server for handler on the UDP side of addr
+// and returns handler advertising it to HTTP/1.1 and HTTP/2 clients through
+// Alt-Svc, so browsers switch over on their next request.
+func serveHTTP3(addr string, handler http.Handler, tlsConfig *tls.Config) http.Handler {
+	server := &http3.Server{
+		Addr:           addr,
+		Handler:        handler,
+		TLSConfig:      http3.ConfigureTLSConfig(tlsConfig),
+		IdleTimeout:    idleTimeout,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+	go func() {
+		fatal("HTTP/3 server stopped", "err", server.ListenAndServe())
+	}()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SetQUICHeaders(w.Header())
+		handler.ServeHTTP(w, r)
+	})
+}
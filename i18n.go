@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Languages the pages can be shown in. English strings are the keys of the
+// other catalogs, so it needs none.
+var languages = []string{"en", "de", "es", "fr"}
+
+// Bundled translations of the page strings, keyed by language and then by
+// the English text. Strings missing from a catalog are shown in English.
+var translations = map[string]map[string]string{
+	"de": {
+		"selected":            "Auswahl",
+		"preview":             "Vorschau",
+		"Toggle preview pane": "Vorschau ein- oder ausblenden",
+		"play all":            "alle abspielen",
+		"gallery":             "Galerie",
+		"Filter by filename, Enter searches subdirectories...": "Nach Dateiname filtern, Enter durchsucht Unterordner...",
+		"Choose file...":               "Datei auswählen...",
+		"Uploads disabled":             "Hochladen deaktiviert",
+		"max %s":                       "max. %s",
+		"Upload":                       "Hochladen",
+		"Upload folder":                "Ordner hochladen",
+		"New folder":                   "Neuer Ordner",
+		"Select all":                   "Alle auswählen",
+		"Name":                         "Name",
+		"Size":                         "Größe",
+		"Last Modified":                "Geändert",
+		"Previous":                     "Zurück",
+		"Next":                         "Weiter",
+		"Page %d of %d (%d entries)":   "Seite %d von %d (%d Einträge)",
+		"Select a file to preview it.": "Datei auswählen, um eine Vorschau zu sehen.",
+		"Build":                        "Version",
+		"Disk: %s free of %s":          "Speicher: %s von %s frei",
+		"Quota %s: %s of %s used":      "Kontingent %s: %s von %s belegt",
+		"Switch theme":                 "Design wechseln",
+		"Symbolic link":                "Symbolischer Link",
+		"Link target is missing or outside the served directory": "Linkziel fehlt oder liegt außerhalb des freigegebenen Ordners",
+		"Preview":                     "Vorschau",
+		"Play":                        "Abspielen",
+		"Rename":                      "Umbenennen",
+		"1 item":                      "1 Eintrag",
+		"%d items":                    "%d Einträge",
+		"files selected":              "Dateien ausgewählt",
+		"Preview failed":              "Vorschau fehlgeschlagen",
+		"waiting":                     "wartet",
+		"Cancel":                      "Abbrechen",
+		"cancelled":                   "abgebrochen",
+		"failed":                      "fehlgeschlagen",
+		"larger than":                 "größer als",
+		"network error":               "Netzwerkfehler",
+		"done":                        "fertig",
+		"New folder name":             "Name des neuen Ordners",
+		"Drop to upload":              "Zum Hochladen ablegen",
+		"Back to the start":           "Zurück zum Anfang",
+		"Not found":                   "Nicht gefunden",
+		"Forbidden":                   "Verboten",
+		"Error reading directory":     "Fehler beim Lesen des Ordners",
+		"Files directory unavailable": "Dateiordner nicht verfügbar",
+		"Too many transfers in progress, try again later":              "Zu viele laufende Übertragungen, bitte später erneut versuchen",
+		"Missing or invalid CSRF token, reload the page and try again": "Fehlendes oder ungültiges CSRF-Token, Seite neu laden und erneut versuchen",
+		"Not Found":                           "Nicht gefunden",
+		"Internal Server Error":               "Interner Serverfehler",
+		"Service Unavailable":                 "Dienst nicht verfügbar",
+		"just now":                            "gerade eben",
+		"1 minute ago":                        "vor 1 Minute",
+		"%d minutes ago":                      "vor %d Minuten",
+		"1 hour ago":                          "vor 1 Stunde",
+		"%d hours ago":                        "vor %d Stunden",
+		"yesterday":                           "gestern",
+		"%d days ago":                         "vor %d Tagen",
+		"Switch size units":                   "Größeneinheiten wechseln",
+		"%s bytes":                            "%s Bytes",
+		"Sort by name":                        "Nach Name sortieren",
+		"Sort by size":                        "Nach Größe sortieren",
+		"Sort by last modified":               "Nach Änderungsdatum sortieren",
+		"Toggle grid view":                    "Rasteransicht ein- oder ausschalten",
+		"grid":                                "Raster",
+		"move":                                "verschieben",
+		"delete":                              "löschen",
+		"Delete the selected entries?":        "Ausgewählte Einträge löschen?",
+		"Move the selected entries to folder": "Ausgewählte Einträge verschieben in Ordner",
+		"Moved to":                            "Verschoben nach",
+		"Undo":                                "Rückgängig",
+		"Undo failed":                         "Rückgängig machen fehlgeschlagen",
+		"Move failed":                         "Verschieben fehlgeschlagen",
+		"Copy link":                           "Link kopieren",
+		"Link copied":                         "Link kopiert",
+		"QR code":                             "QR-Code",
+		"QR code of this folder's link":       "QR-Code des Links zu diesem Ordner",
+		"Download":                            "Herunterladen",
+		"Delete":                              "Löschen",
+		"Properties":                          "Eigenschaften",
+		"Toggle folder tree":                  "Ordnerbaum ein- oder ausblenden",
+		"tree":                                "Baum",
+		"Folders next to this one":            "Ordner auf derselben Ebene",
+		"Retry":                               "Wiederholen",
+		"Upload the dropped files?":           "Die abgelegten Dateien hochladen?",
+		"Upload failed":                       "Hochladen fehlgeschlagen",
+		"Deleted":                             "Gelöscht",
+		"Delete failed":                       "Löschen fehlgeschlagen",
+		"Renamed to":                          "Umbenannt in",
+		"Rename failed":                       "Umbenennen fehlgeschlagen",
+		"Created":                             "Erstellt",
+		"Could not create the folder":         "Ordner konnte nicht erstellt werden",
+		"Uploaded 1 file":                     "1 Datei hochgeladen",
+		"Uploaded":                            "Hochgeladen",
+		"Some uploads failed":                 "Einige Uploads sind fehlgeschlagen",
+		"History":                             "Verlauf",
+		"Share":                               "Teilen",
+		"Expires":                             "Läuft ab",
+		"in 1 hour":                           "in 1 Stunde",
+		"in 1 day":                            "in 1 Tag",
+		"in 7 days":                           "in 7 Tagen",
+		"in 30 days":                          "in 30 Tagen",
+		"never":                               "nie",
+		"Create link":                         "Link erstellen",
+		"Copy":                                "Kopieren",
+		"Manage shared links":                 "Geteilte Links verwalten",
+		"Close":                               "Schließen",
+		"Could not create the link":           "Link konnte nicht erstellt werden",
+		"Download limit":                      "Download-Limit",
+		"unlimited":                           "unbegrenzt",
+		"This folder is protected by a password.": "Dieser Ordner ist durch ein Passwort geschützt.",
+		"Password":          "Passwort",
+		"Unlock":            "Entsperren",
+		"Password required": "Passwort erforderlich",
+		"Wrong password":    "Falsches Passwort",
+	},
+	"es": {
+		"selected":            "selección",
+		"preview":             "vista previa",
+		"Toggle preview pane": "Mostrar u ocultar la vista previa",
+		"play all":            "reproducir todo",
+		"gallery":             "galería",
+		"Filter by filename, Enter searches subdirectories...": "Filtrar por nombre, Intro busca en subcarpetas...",
+		"Choose file...":               "Elegir archivo...",
+		"Uploads disabled":             "Subidas desactivadas",
+		"max %s":                       "máx. %s",
+		"Upload":                       "Subir",
+		"Upload folder":                "Subir carpeta",
+		"New folder":                   "Nueva carpeta",
+		"Select all":                   "Seleccionar todo",
+		"Name":                         "Nombre",
+		"Size":                         "Tamaño",
+		"Last Modified":                "Modificado",
+		"Previous":                     "Anterior",
+		"Next":                         "Siguiente",
+		"Page %d of %d (%d entries)":   "Página %d de %d (%d elementos)",
+		"Select a file to preview it.": "Selecciona un archivo para verlo.",
+		"Build":                        "Versión",
+		"Disk: %s free of %s":          "Disco: %s libres de %s",
+		"Quota %s: %s of %s used":      "Cuota %s: %s de %s usados",
+		"Switch theme":                 "Cambiar tema",
+		"Symbolic link":                "Enlace simbólico",
+		"Link target is missing or outside the served directory": "El destino del enlace no existe o está fuera del directorio servido",
+		"Preview":                     "Vista previa",
+		"Play":                        "Reproducir",
+		"Rename":                      "Renombrar",
+		"1 item":                      "1 elemento",
+		"%d items":                    "%d elementos",
+		"files selected":              "archivos seleccionados",
+		"Preview failed":              "Error en la vista previa",
+		"waiting":                     "en espera",
+		"Cancel":                      "Cancelar",
+		"cancelled":                   "cancelado",
+		"failed":                      "error",
+		"larger than":                 "mayor que",
+		"network error":               "error de red",
+		"done":                        "hecho",
+		"New folder name":             "Nombre de la nueva carpeta",
+		"Drop to upload":              "Suelta para subir",
+		"Back to the start":           "Volver al inicio",
+		"Not found":                   "No encontrado",
+		"Forbidden":                   "Prohibido",
+		"Error reading directory":     "Error al leer el directorio",
+		"Files directory unavailable": "Directorio de archivos no disponible",
+		"Too many transfers in progress, try again later":              "Demasiadas transferencias en curso, inténtalo más tarde",
+		"Missing or invalid CSRF token, reload the page and try again": "Token CSRF ausente o no válido, recarga la página e inténtalo de nuevo",
+		"Not Found":                           "No encontrado",
+		"Internal Server Error":               "Error interno del servidor",
+		"Service Unavailable":                 "Servicio no disponible",
+		"just now":                            "ahora mismo",
+		"1 minute ago":                        "hace 1 minuto",
+		"%d minutes ago":                      "hace %d minutos",
+		"1 hour ago":                          "hace 1 hora",
+		"%d hours ago":                        "hace %d horas",
+		"yesterday":                           "ayer",
+		"%d days ago":                         "hace %d días",
+		"Switch size units":                   "Cambiar unidades de tamaño",
+		"%s bytes":                            "%s bytes",
+		"Sort by name":                        "Ordenar por nombre",
+		"Sort by size":                        "Ordenar por tamaño",
+		"Sort by last modified":               "Ordenar por fecha de modificación",
+		"Toggle grid view":                    "Alternar vista de cuadrícula",
+		"grid":                                "cuadrícula",
+		"move":                                "mover",
+		"delete":                              "eliminar",
+		"Delete the selected entries?":        "¿Eliminar los elementos seleccionados?",
+		"Move the selected entries to folder": "Mover los elementos seleccionados a la carpeta",
+		"Moved to":                            "Movido a",
+		"Undo":                                "Deshacer",
+		"Undo failed":                         "Error al deshacer",
+		"Move failed":                         "Error al mover",
+		"Copy link":                           "Copiar enlace",
+		"Link copied":                         "Enlace copiado",
+		"QR code":                             "Código QR",
+		"QR code of this folder's link":       "Código QR del enlace a esta carpeta",
+		"Download":                            "Descargar",
+		"Delete":                              "Eliminar",
+		"Properties":                          "Propiedades",
+		"Toggle folder tree":                  "Mostrar u ocultar el árbol de carpetas",
+		"tree":                                "árbol",
+		"Folders next to this one":            "Carpetas al mismo nivel",
+		"Retry":                               "Reintentar",
+		"Upload the dropped files?":           "¿Subir los archivos soltados?",
+		"Upload failed":                       "Error al subir",
+		"Deleted":                             "Eliminado",
+		"Delete failed":                       "Error al eliminar",
+		"Renamed to":                          "Renombrado a",
+		"Rename failed":                       "Error al renombrar",
+		"Created":                             "Creado",
+		"Could not create the folder":         "No se pudo crear la carpeta",
+		"Uploaded 1 file":                     "1 archivo subido",
+		"Uploaded":                            "Subidos",
+		"Some uploads failed":                 "Algunas subidas fallaron",
+		"History":                             "Historial",
+		"Share":                               "Compartir",
+		"Expires":                             "Caduca",
+		"in 1 hour":                           "en 1 hora",
+		"in 1 day":                            "en 1 día",
+		"in 7 days":                           "en 7 días",
+		"in 30 days":                          "en 30 días",
+		"never":                               "nunca",
+		"Create link":                         "Crear enlace",
+		"Copy":                                "Copiar",
+		"Manage shared links":                 "Gestionar enlaces compartidos",
+		"Close":                               "Cerrar",
+		"Could not create the link":           "No se pudo crear el enlace",
+		"Download limit":                      "Límite de descargas",
+		"unlimited":                           "sin límite",
+		"This folder is protected by a password.": "Esta carpeta está protegida con una contraseña.",
+		"Password":          "Contraseña",
+		"Unlock":            "Desbloquear",
+		"Password required": "Contraseña necesaria",
+		"Wrong password":    "Contraseña incorrecta",
+	},
+	"fr": {
+		"selected":            "sélection",
+		"preview":             "aperçu",
+		"Toggle preview pane": "Afficher ou masquer l'aperçu",
+		"play all":            "tout lire",
+		"gallery":             "galerie",
+		"Filter by filename, Enter searches subdirectories...": "Filtrer par nom, Entrée cherche dans les sous-dossiers...",
+		"Choose file...":               "Choisir un fichier...",
+		"Uploads disabled":             "Envois désactivés",
+		"max %s":                       "max. %s",
+		"Upload":                       "Envoyer",
+		"Upload folder":                "Envoyer un dossier",
+		"New folder":                   "Nouveau dossier",
+		"Select all":                   "Tout sélectionner",
+		"Name":                         "Nom",
+		"Size":                         "Taille",
+		"Last Modified":                "Modifié",
+		"Previous":                     "Précédent",
+		"Next":                         "Suivant",
+		"Page %d of %d (%d entries)":   "Page %d sur %d (%d éléments)",
+		"Select a file to preview it.": "Sélectionnez un fichier pour l'afficher.",
+		"Build":                        "Version",
+		"Disk: %s free of %s":          "Disque : %s libres sur %s",
+		"Quota %s: %s of %s used":      "Quota %s : %s utilisés sur %s",
+		"Switch theme":                 "Changer de thème",
+		"Symbolic link":                "Lien symbolique",
+		"Link target is missing or outside the served directory": "La cible du lien est absente ou hors du dossier servi",
+		"Preview":                     "Aperçu",
+		"Play":                        "Lire",
+		"Rename":                      "Renommer",
+		"1 item":                      "1 élément",
+		"%d items":                    "%d éléments",
+		"files selected":              "fichiers sélectionnés",
+		"Preview failed":              "Échec de l'aperçu",
+		"waiting":                     "en attente",
+		"Cancel":                      "Annuler",
+		"cancelled":                   "annulé",
+		"failed":                      "échec",
+		"larger than":                 "plus grand que",
+		"network error":               "erreur réseau",
+		"done":                        "terminé",
+		"New folder name":             "Nom du nouveau dossier",
+		"Drop to upload":              "Déposer pour envoyer",
+		"Back to the start":           "Retour à l'accueil",
+		"Not found":                   "Introuvable",
+		"Forbidden":                   "Interdit",
+		"Error reading directory":     "Erreur de lecture du dossier",
+		"Files directory unavailable": "Dossier des fichiers indisponible",
+		"Too many transfers in progress, try again later":              "Trop de transferts en cours, réessayez plus tard",
+		"Missing or invalid CSRF token, reload the page and try again": "Jeton CSRF absent ou invalide, rechargez la page et réessayez",
+		"Not Found":                           "Introuvable",
+		"Internal Server Error":               "Erreur interne du serveur",
+		"Service Unavailable":                 "Service indisponible",
+		"just now":                            "à l'instant",
+		"1 minute ago":                        "il y a 1 minute",
+		"%d minutes ago":                      "il y a %d minutes",
+		"1 hour ago":                          "il y a 1 heure",
+		"%d hours ago":                        "il y a %d heures",
+		"yesterday":                           "hier",
+		"%d days ago":                         "il y a %d jours",
+		"Switch size units":                   "Changer d'unités de taille",
+		"%s bytes":                            "%s octets",
+		"Sort by name":                        "Trier par nom",
+		"Sort by size":                        "Trier par taille",
+		"Sort by last modified":               "Trier par date de modification",
+		"Toggle grid view":                    "Basculer la vue en grille",
+		"grid":                                "grille",
+		"move":                                "déplacer",
+		"delete":                              "supprimer",
+		"Delete the selected entries?":        "Supprimer les éléments sélectionnés ?",
+		"Move the selected entries to folder": "Déplacer les éléments sélectionnés vers le dossier",
+		"Moved to":                            "Déplacé vers",
+		"Undo":                                "Annuler",
+		"Undo failed":                         "Échec de l'annulation",
+		"Move failed":                         "Échec du déplacement",
+		"Copy link":                           "Copier le lien",
+		"Link copied":                         "Lien copié",
+		"QR code":                             "Code QR",
+		"QR code of this folder's link":       "Code QR du lien de ce dossier",
+		"Download":                            "Télécharger",
+		"Delete":                              "Supprimer",
+		"Properties":                          "Propriétés",
+		"Toggle folder tree":                  "Afficher ou masquer l'arborescence",
+		"tree":                                "arborescence",
+		"Folders next to this one":            "Dossiers au même niveau",
+		"Retry":                               "Réessayer",
+		"Upload the dropped files?":           "Envoyer les fichiers déposés ?",
+		"Upload failed":                       "Échec de l'envoi",
+		"Deleted":                             "Supprimé",
+		"Delete failed":                       "Échec de la suppression",
+		"Renamed to":                          "Renommé en",
+		"Rename failed":                       "Échec du renommage",
+		"Created":                             "Créé",
+		"Could not create the folder":         "Impossible de créer le dossier",
+		"Uploaded 1 file":                     "1 fichier envoyé",
+		"Uploaded":                            "Envoyés",
+		"Some uploads failed":                 "Certains envois ont échoué",
+		"History":                             "Historique",
+		"Share":                               "Partager",
+		"Expires":                             "Expire",
+		"in 1 hour":                           "dans 1 heure",
+		"in 1 day":                            "dans 1 jour",
+		"in 7 days":                           "dans 7 jours",
+		"in 30 days":                          "dans 30 jours",
+		"never":                               "jamais",
+		"Create link":                         "Créer le lien",
+		"Copy":                                "Copier",
+		"Manage shared links":                 "Gérer les liens partagés",
+		"Close":                               "Fermer",
+		"Could not create the link":           "Impossible de créer le lien",
+		"Download limit":                      "Limite de téléchargements",
+		"unlimited":                           "illimité",
+		"This folder is protected by a password.": "Ce dossier est protégé par un mot de passe.",
+		"Password":          "Mot de passe",
+		"Unlock":            "Déverrouiller",
+		"Password required": "Mot de passe requis",
+		"Wrong password":    "Mot de passe incorrect",
+	},
+}
+
+// parseLanguage validates the UI_LANGUAGE setting. Empty leaves the choice
+// to each request's Accept-Language header.
+func parseLanguage(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value != "" && !slices.Contains(languages, value) {
+		return "", fmt.Errorf("unknown language %q, expected one of %s", value, strings.Join(languages, ", "))
+	}
+	return value, nil
+}
+
+// requestLanguage returns the language to render a page for r in: UI_LANGUAGE
+// when set, else the most preferred of the request's Accept-Language ranges
+// with a catalog, matched on the primary subtag, and English otherwise.
+func requestLanguage(r *http.Request) string {
+	if uiLanguage != "" {
+		return uiLanguage
+	}
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		primary, _, _ := strings.Cut(tag, "-")
+		ranges = append(ranges, weighted{primary, q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, rg := range ranges {
+		if rg.q > 0 && slices.Contains(languages, rg.lang) {
+			return rg.lang
+		}
+	}
+	return "en"
+}
+
+// translate returns text in lang, formatted with args when there are any.
+func translate(lang, text string, args ...any) string {
+	if translated, ok := translations[lang][text]; ok {
+		text = translated
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// localeFuncs returns the template functions rendering strings in lang:
+// "t" for the markup, "messages" for the script's own catalog and "lang"
+// for the <html> element.
+func localeFuncs(lang string) template.FuncMap {
+	messages := translations[lang]
+	if messages == nil {
+		messages = map[string]string{}
+	}
+	return template.FuncMap{
+		"t":        func(text string, args ...any) string { return translate(lang, text, args...) },
+		"messages": func() map[string]string { return messages },
+		"lang":     func() string { return lang },
+	}
+}
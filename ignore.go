@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Name of the per-directory ignore file. It holds gitignore-style patterns
+// for entries below its directory that are left out of listings, searches
+// and archives, and with FBIGNORE_BLOCK are not served either.
+//
+//	# comments are allowed
+//	*.tmp
+//	/private/
+//	build/**/*.log
+//	!keep.tmp
+//
+// Patterns without a slash match names at any depth, others are anchored to
+// the file's directory. A trailing slash matches only directories, ** spans
+// directories and ! re-includes an earlier match. Later patterns and deeper
+// files take precedence.
+const ignoreFileName = ".fbignore"
+
+// One .fbignore pattern
+type ignorePattern struct {
+	// Slash separated directory of the .fbignore, relative to filesDir
+	base     string
+	segments []string
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+// Patterns of all .fbignore files from filesDir down to one directory
+type IgnoreRules []ignorePattern
+
+// loadIgnoreRules reads the .fbignore files from filesDir down to dir.
+func loadIgnoreRules(dir string) IgnoreRules {
+	rel, err := filepath.Rel(filesDir, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	var parts []string
+	if rel != "." {
+		parts = strings.Split(filepath.ToSlash(rel), "/")
+	}
+
+	var rules IgnoreRules
+	for i := 0; i <= len(parts); i++ {
+		base := strings.Join(parts[:i], "/")
+		patterns, err := readIgnoreFile(filepath.Join(filesDir, filepath.FromSlash(base)), base)
+		if err != nil {
+			slog.Warn("Unable to read ignore file", "file", ignoreFileName, "path", base, "err", err)
+			continue
+		}
+		rules = append(rules, patterns...)
+	}
+	return rules
+}
+
+func readIgnoreFile(dir, base string) ([]ignorePattern, error) {
+	f, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{base: base}
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		p.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		p.segments = strings.Split(line, "/")
+		patterns = append(patterns, p)
+	}
+	return patterns, scanner.Err()
+}
+
+// ignored reports whether the entry at rel, slash separated and relative to
+// filesDir, is matched by the rules. The last matching pattern wins.
+func (rules IgnoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range rules {
+		sub := rel
+		if p.base != "" {
+			if !strings.HasPrefix(rel, p.base+"/") {
+				continue
+			}
+			sub = rel[len(p.base)+1:]
+		}
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.matches(sub) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+func (p ignorePattern) matches(sub string) bool {
+	if !p.anchored {
+		ok, _ := path.Match(p.segments[0], path.Base(sub))
+		return ok
+	}
+	return matchSegments(p.segments, strings.Split(sub, "/"))
+}
+
+// matchSegments matches a path segment by segment, with ** standing for any
+// number of directories.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// filterIgnored drops the entries of dirPath matched by .fbignore files.
+func filterIgnored(entries []os.DirEntry, dirPath string) []os.DirEntry {
+	rules := loadIgnoreRules(dirPath)
+	if len(rules) == 0 {
+		return entries
+	}
+	rel, _ := filepath.Rel(filesDir, dirPath)
+	visible := make([]os.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !rules.ignored(path.Join(filepath.ToSlash(rel), entry.Name()), entry.IsDir()) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible
+}
+
+// isIgnored reports whether fullPath or one of its parent directories is
+// matched by a .fbignore file.
+func isIgnored(fullPath string) bool {
+	rel, err := filepath.Rel(filesDir, fullPath)
+	if err != nil || rel == "." {
+		return false
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	dir := filesDir
+	for i, part := range parts {
+		isDir := i < len(parts)-1
+		if !isDir {
+			if info, err := os.Stat(fullPath); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if loadIgnoreRules(dir).ignored(strings.Join(parts[:i+1], "/"), isDir) {
+			return true
+		}
+		dir = filepath.Join(dir, part)
+	}
+	return false
+}
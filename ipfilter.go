@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Client address rule from IP_ALLOW, IP_DENY or the IP rules file
+type IPRule struct {
+	Allow bool
+	Range netip.Prefix
+}
+
+var ipRules []IPRule
+
+// parseIPRules turns IP_DENY and IP_ALLOW into rules, denials first.
+func parseIPRules(allow, deny string) ([]IPRule, error) {
+	var rules []IPRule
+	for _, list := range []struct {
+		value string
+		allow bool
+	}{{deny, false}, {allow, true}} {
+		for _, entry := range splitList(list.value) {
+			prefix, err := parseAddrRange(entry)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, IPRule{Allow: list.allow, Range: prefix})
+		}
+	}
+	return rules, nil
+}
+
+// loadIPRules reads a file with one "allow RANGE" or "deny RANGE" rule per
+// line, where RANGE is an address or a CIDR range.
+func loadIPRules(file string) ([]IPRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []IPRule
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || (fields[0] != "allow" && fields[0] != "deny") {
+			return nil, fmt.Errorf("%s:%d: expected allow or deny and an address range", file, lineNo)
+		}
+		prefix, err := parseAddrRange(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, lineNo, err)
+		}
+		rules = append(rules, IPRule{Allow: fields[0] == "allow", Range: prefix})
+	}
+	return rules, scanner.Err()
+}
+
+// ipAllowed applies the rules to a client address: the first matching rule
+// decides. Unmatched clients are denied when there are allow rules and
+// allowed otherwise.
+func ipAllowed(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	hasAllow := false
+	for _, rule := range ipRules {
+		if rule.Range.Contains(addr) {
+			return rule.Allow
+		}
+		hasAllow = hasAllow || rule.Allow
+	}
+	return !hasAllow
+}
+
+// requireAllowedIP refuses clients rejected by the IP rules before any
+// other handler runs.
+func requireAllowedIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := clientIP(r); !ipAllowed(ip) {
+			slog.Info("Refused request from a denied address", "client", ip, "path", r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func formatIPRules() string {
+	if len(ipRules) == 0 {
+		return "(none)"
+	}
+	rules := make([]string, len(ipRules))
+	for i, rule := range ipRules {
+		action := "deny"
+		if rule.Allow {
+			action = "allow"
+		}
+		rules[i] = action + " " + rule.Range.String()
+	}
+	return strings.Join(rules, ", ")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPAllowed(t *testing.T) {
+	defer func(rules []IPRule) { ipRules = rules }(ipRules)
+
+	tests := []struct {
+		name        string
+		allow, deny string
+		host        string
+		want        bool
+	}{
+		{"no rules", "", "", "203.0.113.7", true},
+		{"allowed range", "10.0.0.0/8", "", "10.1.2.3", true},
+		{"outside allowed range", "10.0.0.0/8", "", "192.168.1.1", false},
+		{"denied address", "", "192.168.1.1", "192.168.1.1", false},
+		{"not denied", "", "192.168.1.1", "192.168.1.2", true},
+		{"deny wins over allow", "10.0.0.0/8", "10.0.0.5", "10.0.0.5", false},
+		{"allowed next to denied", "10.0.0.0/8", "10.0.0.5", "10.0.0.6", true},
+		{"ipv4-mapped ipv6", "10.0.0.0/8", "", "::ffff:10.0.0.1", true},
+		{"ipv6 range", "2001:db8::/32", "", "2001:db8::1", true},
+		{"ipv6 outside range", "2001:db8::/32", "", "2001:db9::1", false},
+		{"unparsable address", "", "", "not-an-ip", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := parseIPRules(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ipRules = rules
+			if got := ipAllowed(tt.host); got != tt.want {
+				t.Errorf("ipAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIPRulesInvalid(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "10.0.0", "example.com"} {
+		if _, err := parseIPRules(value, ""); err == nil {
+			t.Errorf("parseIPRules(%q) accepted an invalid range", value)
+		}
+	}
+}
+
+func TestLoadIPRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ip-rules")
+	content := "# office\nallow 10.0.0.0/8\n\ndeny 10.0.0.5\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadIPRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []IPRule{
+		{Allow: true, Range: netip.MustParsePrefix("10.0.0.0/8")},
+		{Allow: false, Range: netip.MustParsePrefix("10.0.0.5/32")},
+	}
+	if len(rules) != len(want) || rules[0] != want[0] || rules[1] != want[1] {
+		t.Errorf("loadIPRules = %v, want %v", rules, want)
+	}
+
+	if err := os.WriteFile(file, []byte("permit 10.0.0.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadIPRules(file); err == nil {
+		t.Error("loadIPRules accepted an unknown action")
+	}
+}
+
+func TestRequireAllowedIP(t *testing.T) {
+	defer func(rules []IPRule, proxies []netip.Prefix) {
+		ipRules, trustedProxies = rules, proxies
+	}(ipRules, trustedProxies)
+	ipRules = []IPRule{{Allow: true, Range: netip.MustParsePrefix("10.0.0.0/8")}}
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+
+	handler := requireAllowedIP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name        string
+		remote, xff string
+		want        int
+	}{
+		{"allowed client", "10.0.0.1:1234", "", http.StatusOK},
+		{"denied client", "192.168.1.1:1234", "", http.StatusForbidden},
+		{"allowed client behind trusted proxy", "127.0.0.1:1234", "10.0.0.1", http.StatusOK},
+		{"denied client behind trusted proxy", "127.0.0.1:1234", "192.168.1.1", http.StatusForbidden},
+		{"forwarded header from untrusted client", "192.168.1.1:1234", "10.0.0.1", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
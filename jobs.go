@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Background task reported on the admin dashboard
+type Job struct {
+	Name string
+
+	mu       sync.Mutex
+	running  bool
+	lastRun  time.Time
+	lastErr  error
+	runCount uint64
+}
+
+// Point-in-time view of a Job
+type JobStatus struct {
+	Name     string
+	Running  bool
+	LastRun  time.Time
+	LastErr  string
+	RunCount uint64
+}
+
+var jobs = struct {
+	sync.Mutex
+	list []*Job
+}{}
+
+func registerJob(name string) *Job {
+	job := &Job{Name: name}
+	jobs.Lock()
+	jobs.list = append(jobs.list, job)
+	jobs.Unlock()
+	return job
+}
+
+// Run executes fn and records its outcome.
+func (j *Job) Run(fn func() error) error {
+	j.mu.Lock()
+	j.running = true
+	j.mu.Unlock()
+
+	err := fn()
+
+	j.mu.Lock()
+	j.running = false
+	j.lastRun = time.Now()
+	j.lastErr = err
+	j.runCount++
+	j.mu.Unlock()
+	return err
+}
+
+func jobStatuses() []JobStatus {
+	jobs.Lock()
+	defer jobs.Unlock()
+	statuses := make([]JobStatus, 0, len(jobs.list))
+	for _, j := range jobs.list {
+		j.mu.Lock()
+		status := JobStatus{Name: j.Name, Running: j.running, LastRun: j.lastRun, RunCount: j.runCount}
+		if j.lastErr != nil {
+			status.LastErr = j.lastErr.Error()
+		}
+		j.mu.Unlock()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
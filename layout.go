@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+// Cookie set by the header button to keep the listing in the grid layout
+const layoutCookie = "filebrowser-layout"
+
+// gridLayout reports whether the request's listing is shown as a grid of
+// cards with larger icons and thumbnails instead of a table.
+func gridLayout(r *http.Request) bool {
+	cookie, err := r.Cookie(layoutCookie)
+	return err == nil && cookie.Value == "grid"
+}
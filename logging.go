@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Rotation settings for LOG_FILE and ACCESS_LOG files
+type LogRotation struct {
+	// Size in bytes a file grows to before it is rotated
+	MaxSize int64
+	// Days rotated files are kept, 0 to keep them regardless of age
+	MaxAge int
+	// Rotated files kept, 0 to keep them all
+	MaxBackups int
+	// Gzip rotated files
+	Compress bool
+}
+
+var logRotation LogRotation
+
+// parseLogRotation reads LOG_MAX_SIZE, LOG_MAX_AGE, LOG_MAX_BACKUPS and
+// LOG_COMPRESS.
+func parseLogRotation() (LogRotation, error) {
+	size, err := parseSize(getEnv("LOG_MAX_SIZE", "100M"))
+	if err != nil || size <= 0 {
+		return LogRotation{}, fmt.Errorf("invalid LOG_MAX_SIZE %q", getEnv("LOG_MAX_SIZE", "100M"))
+	}
+	age, err := strconv.Atoi(getEnv("LOG_MAX_AGE", "0"))
+	if err != nil || age < 0 {
+		return LogRotation{}, fmt.Errorf("invalid LOG_MAX_AGE %q, expected a number of days", getEnv("LOG_MAX_AGE", "0"))
+	}
+	backups, err := strconv.Atoi(getEnv("LOG_MAX_BACKUPS", "0"))
+	if err != nil || backups < 0 {
+		return LogRotation{}, fmt.Errorf("invalid LOG_MAX_BACKUPS %q", getEnv("LOG_MAX_BACKUPS", "0"))
+	}
+	return LogRotation{
+		MaxSize:    size,
+		MaxAge:     age,
+		MaxBackups: backups,
+		Compress:   getBoolEnv("LOG_COMPRESS", false),
+	}, nil
+}
+
+// openLogFile returns a writer appending to path and rotating it according
+// to logRotation. Rotated files are named after it with a timestamp.
+func openLogFile(path string) (io.Writer, error) {
+	// The rotating writer opens the file on the first write; fail early
+	// instead when it cannot be written
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	const megabyte = 1 << 20
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    int((logRotation.MaxSize + megabyte - 1) / megabyte),
+		MaxAge:     logRotation.MaxAge,
+		MaxBackups: logRotation.MaxBackups,
+		LocalTime:  true,
+		Compress:   logRotation.Compress,
+	}, nil
+}
+
+func formatLogRotation() string {
+	const megabyte = 1 << 20
+	summary := "rotate at " + formatSize((logRotation.MaxSize+megabyte-1)/megabyte*megabyte)
+	if logRotation.MaxAge > 0 {
+		summary += fmt.Sprintf(", keep %d days", logRotation.MaxAge)
+	}
+	if logRotation.MaxBackups > 0 {
+		summary += fmt.Sprintf(", keep %d files", logRotation.MaxBackups)
+	}
+	if logRotation.Compress {
+		summary += ", compressed"
+	}
+	return summary
+}
+
+// newLogger returns a logger writing to out at the given level, as text or
+// one JSON object per line for log collectors like Loki or Elasticsearch.
+func newLogger(out io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+	options := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
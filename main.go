@@ -5,22 +5,24 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"log"
-	"math"
+	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"path/filepath"
-	"runtime"
-	"sort"
+	"slices"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
-	port     = ":8000"
-	filesDir = "/files"
+	port = ":8000"
 )
 
 type FileInfo struct {
@@ -29,6 +31,19 @@ type FileInfo struct {
 	LastModified string
 	IsDir        bool
 	URL          string
+	Image        bool
+	Thumbnail    bool
+	Audio        bool
+	PDF          bool
+	Symlink      bool
+	// Symlink whose target is missing or outside the root
+	BrokenLink bool
+	// RFC 3339 modification time, and the absolute date when LastModified
+	// is relative
+	ModifiedISO   string
+	ModifiedExact string
+	// Exact byte count shown on hover, with EXACT_SIZES
+	SizeExact string
 }
 
 // Breadcrumb segment for the current path
@@ -38,55 +53,389 @@ type Crumb struct {
 }
 
 var (
+	filesDir      = getEnv("FILES_DIR", "/files")
 	title         = getEnv("TITLE", "File Server")
 	extraHeaders  = getEnv("EXTRA_HEADERS", "")
 	enableUpload  = getBoolEnv("ENABLE_UPLOAD", false)
 	enableMetrics = getBoolEnv("ENABLE_METRICS", false)
+	enableAPIDocs = getBoolEnv("ENABLE_API_DOCS", false)
+	// Top-level directories counted under their own path_group label in
+	// request metrics, all other paths under "other"
+	metricsPathGroupsEnv = getEnv("METRICS_PATH_GROUPS", "")
+	metricsPathGroups    []string
+	// Escaped alternatives to the raw HTML of EXTRA_HEADERS: <meta> tags from
+	// "name=content;..." and deferred script URLs
+	headMetaEnv = getEnv("HEAD_META", "")
+	headMeta    []HeadMeta
+	headScripts = splitList(getEnv("HEAD_SCRIPTS", ""))
+	// Security headers sent with every response; HSTS_MAX_AGE is in seconds
+	// and only applies over HTTPS
+	contentSecurityPolicy = getEnv("CONTENT_SECURITY_POLICY", "")
+	frameOptions          = getEnv("FRAME_OPTIONS", "SAMEORIGIN")
+	referrerPolicy        = getEnv("REFERRER_POLICY", "same-origin")
+	hstsMaxAge            int
+	// Require a per-session token for form submissions and other browser
+	// requests changing state
+	csrfProtection = getBoolEnv("CSRF_PROTECTION", true)
+	// Access log destination (stdout, stderr or a file) and format: common,
+	// combined or extended, which adds the duration
+	accessLog       = getEnv("ACCESS_LOG", "")
+	accessLogFormat = getEnv("ACCESS_LOG_FORMAT", "combined")
+	// Application log verbosity (debug, info, warn or error) and format:
+	// text or json
+	logLevel  = getEnv("LOG_LEVEL", "info")
+	logFormat = getEnv("LOG_FORMAT", "text")
+	// File the application log is written to instead of stderr, rotated
+	// according to LOG_MAX_SIZE, LOG_MAX_AGE and LOG_MAX_BACKUPS
+	logFile = getEnv("LOG_FILE", "")
+	// OTLP/HTTP collector endpoint spans are exported to, like
+	// http://localhost:4318, and the share of requests traced
+	otlpEndpoint     = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	traceSampleRatio float64
+	// Serve runtime profiles under /debug/pprof/, to admins on the main
+	// listeners or without auth on a separate loopback address
+	enablePprof = getBoolEnv("ENABLE_PPROF", false)
+	pprofAddr   = getEnv("PPROF_ADDR", "")
+	// Unicode normalization applied to uploaded file names: nfc, nfd or none
+	normalizeNames = getEnv("NORMALIZE_NAMES", "nfc")
+	// Directory holding in-progress uploads; defaults to the target directory
+	uploadTmpDir = getEnv("UPLOAD_TMP_DIR", "")
+	// Upload type filters: comma separated extensions and MIME patterns
+	uploadAllowExt  = getEnv("UPLOAD_ALLOW_EXT", "")
+	uploadDenyExt   = getEnv("UPLOAD_DENY_EXT", "")
+	uploadAllowMIME = getEnv("UPLOAD_ALLOW_MIME", "")
+	uploadDenyMIME  = getEnv("UPLOAD_DENY_MIME", "")
+	// Endpoints notified with a JSON payload after uploads and deletes
+	webhookURLs   = splitList(getEnv("WEBHOOK_URLS", ""))
+	webhookSecret = getEnv("WEBHOOK_SECRET", "")
+	// clamd used to scan uploads before they are moved into place
+	clamdAddress = getEnv("CLAMD_ADDRESS", "")
+	// Storage quotas as prefix=size pairs, e.g. 100G,/users/alice=5G
+	quotasEnv = getEnv("QUOTAS", "")
+	// Show recursive directory sizes computed in the background, cached for dirSizeTTL
+	enableDirSizes = getBoolEnv("DIR_SIZES", false)
+	dirSizeTTL     time.Duration
+	// Image thumbnails in listings, cached on disk up to thumbCacheSize
+	enableThumbnails = getBoolEnv("ENABLE_THUMBNAILS", false)
+	thumbCacheDir    = getEnv("THUMB_CACHE_DIR", filepath.Join(os.TempDir(), "filebrowser-thumbs"))
+	thumbCacheSize   int64
+	// Render .md files as HTML by default instead of only with ?render=1
+	renderMarkdownFiles = getBoolEnv("RENDER_MARKDOWN", false)
+	// Render README.md below directory listings
+	showReadme = getBoolEnv("SHOW_README", false)
+	// Include GPS coordinates in EXIF metadata
+	exifGPS = getBoolEnv("EXIF_GPS", false)
+	// Show a SHA-256 column, filled in by the browser from /checksum
+	showChecksums = getBoolEnv("SHOW_CHECKSUMS", false)
+	// Index text file contents for /search?content=1, persisted in indexDir
+	enableContentIndex = getBoolEnv("ENABLE_CONTENT_INDEX", false)
+	indexDir           = getEnv("INDEX_DIR", filepath.Join(os.TempDir(), "filebrowser-index"))
+	// Earlier contents kept per file when uploads replace it, in versionsDir;
+	// 0 disables versioning
+	keepVersions int
+	versionsDir  = getEnv("VERSIONS_DIR", filepath.Join(os.TempDir(), "filebrowser-versions"))
+	// Links under /s/ giving access to a file or directory without
+	// credentials, persisted in sharesFile when set
+	enableShares = getBoolEnv("ENABLE_SHARES", false)
+	sharesFile   = getEnv("SHARES_FILE", "")
+	// Deleted entries are moved here until purged from the admin dashboard;
+	// deletes are permanent when empty
+	trashDir = getEnv("TRASH_DIR", "")
+	// Secret signing temporary ?expires=&sig= links to files; empty disables them
+	urlSigningSecret = getEnv("URL_SIGNING_SECRET", "")
+	// Longest lifetime of a signed URL, from SIGNED_URL_MAX_TTL
+	signedURLMaxTTL time.Duration
+	// Largest accepted upload, e.g. 500M or 2G; 0 means unlimited
+	maxUploadSize int64
+	// Files the listing's upload queue sends at the same time
+	uploadConcurrency int
+	// Entries per listing page; 0 shows whole directories on one page
+	pageSize int
+	// Ask before uploading files dropped onto the listing
+	confirmDropUpload = getBoolEnv("CONFIRM_DROP_UPLOAD", false)
+	// Leave names starting with a dot out of listings unless toggled on
+	hideDotfiles = getBoolEnv("HIDE_DOTFILES", false)
+	// Return 404 for paths matched by .fbignore files instead of only hiding them
+	blockIgnored = getBoolEnv("FBIGNORE_BLOCK", false)
+	// Directories outside the root that symlinks may lead into, e.g. mounts
+	symlinkRootsEnv = getEnv("FOLLOW_SYMLINKS", "")
+	symlinkRoots    []string
+	// Serve a directory's index.html instead of its listing, unless ?listing=1
+	serveIndex = getBoolEnv("SERVE_INDEX", false)
+	// Stylesheet and footer HTML files added to every page for branding
+	customCSSFile    = getEnv("CUSTOM_CSS", "")
+	customFooterFile = getEnv("CUSTOM_FOOTER_HTML", "")
+	// Initial theme of the pages: classic, light, dark, compact,
+	// high-contrast or solarized
+	theme = getEnv("THEME", "classic")
+	// Language of the pages, negotiated from Accept-Language when empty
+	uiLanguage = getEnv("UI_LANGUAGE", "")
+	// Time zone and Go layout of the dates in the pages, and whether the
+	// listing shows them relative to now, like "2 hours ago"
+	timeZone      = getEnv("TZ", "")
+	dateFormat    = getEnv("DATE_FORMAT", defaultDateFormat)
+	relativeDates = getBoolEnv("RELATIVE_DATES", false)
+	// Units of the sizes in the pages, binary (KiB, MiB) or si (kB, MB), and
+	// whether the listing shows exact byte counts on hover
+	sizeUnits  = getEnv("SIZE_UNITS", "binary")
+	exactSizes = getBoolEnv("EXACT_SIZES", false)
+	// Images shown in the page header and as the favicon, served from /_assets/
+	logoFile    = getEnv("LOGO", "")
+	faviconFile = getEnv("FAVICON", "")
+	// Directory with index.html, document.html or block templates replacing
+	// the embedded ones
+	templatesDir = getEnv("TEMPLATES_DIR", "")
+	// Directory with 403.html, 404.html, 500.html and error.html templates
+	errorPagesDir = getEnv("ERROR_PAGES_DIR", "")
+	// Serve file.br or file.gz in place of file to clients accepting them
+	servePrecompressedFiles = getBoolEnv("SERVE_PRECOMPRESSED", false)
+	// Serve the root index.html for missing paths, for single-page apps
+	spaFallback = getBoolEnv("SPA_FALLBACK", false)
+	// Path prefix the app is mounted under behind a reverse proxy, like /files
+	baseURL = getEnv("BASE_URL", "")
+	// Proxies whose X-Forwarded-For/-Proto/-Host headers are trusted
+	trustedProxiesEnv = getEnv("TRUSTED_PROXIES", "")
+	trustedProxies    []netip.Prefix
+	// Listener addresses; plain HTTP defaults to :8000 without HTTPS
+	httpAddr  = getEnv("HTTP_ADDR", "")
+	httpsAddr = getEnv("HTTPS_ADDR", "")
+	// Certificate and key files for HTTPS, on :8443 by default
+	tlsCert = getEnv("TLS_CERT", "")
+	tlsKey  = getEnv("TLS_KEY", "")
+	// Domains to serve over HTTPS on :443 with certificates from Let's Encrypt
+	acmeDomainsEnv   = getEnv("ACME_DOMAINS", "")
+	acmeDomains      []string
+	acmeCacheDir     = getEnv("ACME_CACHE_DIR", filepath.Join(os.TempDir(), "filebrowser-acme"))
+	acmeEmail        = getEnv("ACME_EMAIL", "")
+	acmeDirectoryURL = getEnv("ACME_DIRECTORY_URL", "")
+	// Also serve HTTPS over QUIC on the same port, advertised with Alt-Svc
+	enableHTTP3 = getBoolEnv("ENABLE_HTTP3", false)
+	// Listener limits from READ_HEADER_TIMEOUT, IDLE_TIMEOUT, WRITE_TIMEOUT
+	// and MAX_HEADER_BYTES
+	readHeaderTimeout time.Duration
+	idleTimeout       time.Duration
+	writeTimeout      time.Duration
+	maxHeaderBytes    int
+	// Simultaneous uploads and downloads, 0 for unlimited; excess requests
+	// wait up to transferQueueTimeout for a slot before getting a 503
+	maxUploads           = getEnv("MAX_UPLOADS", "0")
+	maxDownloads         = getEnv("MAX_DOWNLOADS", "0")
+	transferQueueTimeout time.Duration
+	// Credentials for the /admin dashboard; the dashboard is disabled without a password
+	adminUser = getEnv("ADMIN_USER", "admin")
+	adminPass = getEnv("ADMIN_PASS", "")
+	// Basic auth for all handlers, from a single user and/or an htpasswd file
+	authUser     = getEnv("AUTH_USER", "")
+	authPass     = getEnv("AUTH_PASS", "")
+	authHtpasswd = getEnv("AUTH_HTPASSWD", "")
+	authRealm    = getEnv("AUTH_REALM", "")
+	// Bearer tokens for scripts, as name:token pairs and/or a tokens file
+	apiTokensEnv  = getEnv("API_TOKENS", "")
+	apiTokensFile = getEnv("API_TOKENS_FILE", "")
+	// Path prefix permissions per user, role or token
+	aclFile = getEnv("ACL_FILE", "")
+	// Client address rules: comma separated ranges and a file of
+	// "allow RANGE" / "deny RANGE" lines, checked before anything else
+	ipAllow     = getEnv("IP_ALLOW", "")
+	ipDeny      = getEnv("IP_DENY", "")
+	ipRulesFile = getEnv("IP_RULES_FILE", "")
+	// Cross-origin access to the API for other sites' JavaScript
+	corsOrigins     = splitList(getEnv("CORS_ORIGINS", ""))
+	corsMethods     = splitList(getEnv("CORS_METHODS", "GET,HEAD,POST,PUT,OPTIONS"))
+	corsHeaders     = splitList(getEnv("CORS_HEADERS", "Authorization,Content-Type,Accept"))
+	corsCredentials = getBoolEnv("CORS_CREDENTIALS", false)
+	// Rejects all modifications while set; toggled at runtime from /admin
+	readOnly atomic.Bool
 	// Build information - set via ldflags during build
 	GitCommit = "unknown"
 	BuildDate = "unknown"
-	// Metrics
-	startTime           = time.Now()
-	httpRequestsTotal   atomic.Uint64
-	httpRequestsSuccess atomic.Uint64
-	httpRequestsError   atomic.Uint64
-	uploadsTotal        atomic.Uint64
-	uploadsSuccess      atomic.Uint64
-	uploadsError        atomic.Uint64
-	directoryLists      atomic.Uint64
-	fileServes          atomic.Uint64
-
-	requestDurationBuckets = map[string]map[string]*atomic.Uint64{
-		"GET": {
-			"0.1":  &atomic.Uint64{},
-			"0.5":  &atomic.Uint64{},
-			"1.0":  &atomic.Uint64{},
-			"+Inf": &atomic.Uint64{},
-		},
-		"POST": {
-			"0.1":  &atomic.Uint64{},
-			"0.5":  &atomic.Uint64{},
-			"1.0":  &atomic.Uint64{},
-			"+Inf": &atomic.Uint64{},
-		},
-	}
-	requestDurationSum   = map[string]*atomic.Uint64{
-		"GET":  &atomic.Uint64{},
-		"POST": &atomic.Uint64{},
-	}
-	requestDurationCount = map[string]*atomic.Uint64{
-		"GET":  &atomic.Uint64{},
-		"POST": &atomic.Uint64{},
-	}
+	startTime = time.Now()
 )
 
 func main() {
 	var enableUploadFlag bool
 	var enableMetricsFlag bool
+	var enableAPIDocsFlag bool
+	var metricsPathGroupsFlag string
+	var rootFlag string
+	var normalizeNamesFlag string
+	var uploadTmpDirFlag string
+	var maxUploadSizeFlag string
+	var uploadConcurrencyFlag string
+	var pageSizeFlag string
+	var confirmDropUploadFlag bool
+	var hideDotfilesFlag bool
+	var blockIgnoredFlag bool
+	var followSymlinksFlag string
+	var serveIndexFlag bool
+	var precompressedFlag bool
+	var errorPagesFlag string
+	var templatesFlag string
+	var customCSSFlag string
+	var customFooterFlag string
+	var themeFlag string
+	var languageFlag string
+	var timeZoneFlag string
+	var dateFormatFlag string
+	var relativeDatesFlag bool
+	var sizeUnitsFlag string
+	var exactSizesFlag bool
+	var logoFlag string
+	var faviconFlag string
+	var spaFallbackFlag bool
+	var baseURLFlag string
+	var trustedProxiesFlag string
+	var accessLogFlag string
+	var logLevelFlag string
+	var logFormatFlag string
+	var logFileFlag string
+	var otlpEndpointFlag string
+	var enablePprofFlag bool
+	var pprofAddrFlag string
+	var maxUploadsFlag string
+	var maxDownloadsFlag string
+	var httpAddrFlag string
+	var httpsAddrFlag string
+	var tlsCertFlag string
+	var tlsKeyFlag string
+	var acmeDomainsFlag string
+	var acmeCacheDirFlag string
+	var enableHTTP3Flag bool
+	var quotasFlag string
+	var dirSizesFlag bool
+	var enableThumbnailsFlag bool
+	var renderMarkdownFlag bool
+	var showReadmeFlag bool
+	var exifGPSFlag bool
+	var showChecksumsFlag bool
+	var contentIndexFlag bool
+	var indexDirFlag string
+	var keepVersionsFlag string
+	var versionsDirFlag string
+	var enableSharesFlag bool
+	var sharesFileFlag string
+	var trashDirFlag string
+	var signingSecretFlag string
+	var signedMaxTTLFlag string
+	var readOnlyFlag bool
+	var htpasswdFlag string
+	var tokensFileFlag string
+	var generateTokenFlag string
+	var aclFlag string
+	var ipRulesFlag string
+	var corsOriginsFlag string
 	flag.BoolVar(&enableUploadFlag, "enable-upload", false, "Enable file uploads")
 	flag.BoolVar(&enableMetricsFlag, "enable-metrics", false, "Enable metrics endpoint")
+	flag.StringVar(&metricsPathGroupsFlag, "metrics-path-groups", "", "Comma separated top-level directories labeled separately in request metrics")
+	flag.BoolVar(&enableAPIDocsFlag, "enable-api-docs", false, "Enable the interactive API docs at /api/docs")
+	flag.StringVar(&rootFlag, "root", "", "Directory to serve (default /files)")
+	flag.StringVar(&normalizeNamesFlag, "normalize-names", "", "Unicode normalization for uploaded file names (nfc, nfd, none)")
+	flag.StringVar(&uploadTmpDirFlag, "upload-tmp-dir", "", "Staging directory for in-progress uploads")
+	flag.StringVar(&maxUploadSizeFlag, "max-upload-size", getEnv("MAX_UPLOAD_SIZE", "0"), "Largest accepted upload, e.g. 500M or 2G (0 for unlimited)")
+	flag.StringVar(&uploadConcurrencyFlag, "upload-concurrency", getEnv("UPLOAD_CONCURRENCY", "3"), "Files the browser uploads at the same time")
+	flag.StringVar(&pageSizeFlag, "page-size", getEnv("PAGE_SIZE", "1000"), "Entries per listing page (0 for unpaginated)")
+	flag.BoolVar(&confirmDropUploadFlag, "confirm-drop-upload", false, "Ask before uploading files dropped onto the listing")
+	flag.BoolVar(&hideDotfilesFlag, "hide-dotfiles", false, "Hide dotfiles in listings unless toggled on")
+	flag.BoolVar(&blockIgnoredFlag, "fbignore-block", false, "Refuse to serve paths matched by .fbignore files")
+	flag.StringVar(&followSymlinksFlag, "follow-symlinks", "", "Comma-separated directories outside the root that symlinks may point into")
+	flag.BoolVar(&serveIndexFlag, "serve-index", false, "Serve index.html instead of the listing for directories that have one")
+	flag.BoolVar(&precompressedFlag, "precompressed", false, "Serve file.br or file.gz siblings to clients accepting them")
+	flag.StringVar(&accessLogFlag, "access-log", "", "Write an access log to stdout, stderr or a file")
+	flag.StringVar(&logLevelFlag, "log-level", "", "Log verbosity: debug, info, warn or error")
+	flag.StringVar(&logFormatFlag, "log-format", "", "Log format: text or json")
+	flag.StringVar(&logFileFlag, "log-file", "", "Write the log to a rotated file instead of stderr")
+	flag.StringVar(&otlpEndpointFlag, "otlp-endpoint", "", "OTLP/HTTP endpoint to export traces to, like http://localhost:4318")
+	flag.BoolVar(&enablePprofFlag, "enable-pprof", false, "Serve runtime profiles under /debug/pprof/")
+	flag.StringVar(&pprofAddrFlag, "pprof-addr", "", "Serve runtime profiles on a separate loopback address, like localhost:6060")
+	flag.StringVar(&maxUploadsFlag, "max-uploads", "", "Simultaneous uploads, 0 for unlimited")
+	flag.StringVar(&maxDownloadsFlag, "max-downloads", "", "Simultaneous downloads and archives, 0 for unlimited")
+	flag.StringVar(&httpAddrFlag, "http-addr", "", "Plain HTTP listen address, :8000 by default unless HTTPS is configured")
+	flag.StringVar(&httpsAddrFlag, "https-addr", "", "HTTPS listen address, :8443 with --tls-cert or :443 with --acme-domains by default")
+	flag.StringVar(&tlsCertFlag, "tls-cert", "", "TLS certificate file for HTTPS")
+	flag.StringVar(&tlsKeyFlag, "tls-key", "", "TLS private key file for HTTPS")
+	flag.StringVar(&acmeDomainsFlag, "acme-domains", "", "Comma separated domains to serve over HTTPS with automatic certificates")
+	flag.StringVar(&acmeCacheDirFlag, "acme-cache-dir", "", "Directory storing ACME certificates and account keys")
+	flag.BoolVar(&enableHTTP3Flag, "http3", false, "Also serve HTTPS over HTTP/3 (QUIC), needs --tls-cert or --acme-domains")
+	flag.StringVar(&trustedProxiesFlag, "trusted-proxies", "", "Comma separated proxy addresses or CIDR ranges whose X-Forwarded-* headers are trusted")
+	flag.StringVar(&baseURLFlag, "base-url", "", "Path prefix the app is mounted under behind a reverse proxy, like /files")
+	flag.BoolVar(&spaFallbackFlag, "spa-fallback", false, "Serve the root index.html for missing paths, for single-page apps")
+	flag.StringVar(&customCSSFlag, "custom-css", "", "Stylesheet file added to every page")
+	flag.StringVar(&customFooterFlag, "custom-footer-html", "", "HTML file shown in every page's footer, sanitized")
+	flag.StringVar(&themeFlag, "theme", "", "Initial theme: classic, light, dark, compact, high-contrast or solarized")
+	flag.StringVar(&languageFlag, "language", "", "Language of the pages: en, de, es or fr (default: from Accept-Language)")
+	flag.StringVar(&timeZoneFlag, "tz", "", "Time zone of the dates in the pages, like Europe/Madrid or UTC (default: system zone)")
+	flag.StringVar(&dateFormatFlag, "date-format", "", "Go time layout of the dates in the pages (default: "+defaultDateFormat+")")
+	flag.BoolVar(&relativeDatesFlag, "relative-dates", false, "Show listing dates relative to now, like \"2 hours ago\"")
+	flag.StringVar(&sizeUnitsFlag, "size-units", "", "Units of the sizes in the pages: binary (KiB, MiB) or si (kB, MB)")
+	flag.BoolVar(&exactSizesFlag, "exact-sizes", false, "Show exact byte counts when hovering listing sizes")
+	flag.StringVar(&logoFlag, "logo", "", "Image file shown in the page header")
+	flag.StringVar(&faviconFlag, "favicon", "", "Icon file used as the favicon")
+	flag.StringVar(&templatesFlag, "templates", "", "Directory with templates overriding the embedded listing page")
+	flag.StringVar(&errorPagesFlag, "error-pages", "", "Directory with custom 403.html, 404.html, 500.html and error.html templates")
+	flag.StringVar(&quotasFlag, "quotas", "", "Storage quotas as prefix=size pairs, e.g. 100G,/users/alice=5G")
+	flag.BoolVar(&enableThumbnailsFlag, "enable-thumbnails", false, "Show image thumbnails in listings")
+	flag.BoolVar(&renderMarkdownFlag, "render-markdown", false, "Render .md files as HTML by default")
+	flag.BoolVar(&showReadmeFlag, "show-readme", false, "Render README.md below directory listings")
+	flag.BoolVar(&exifGPSFlag, "exif-gps", false, "Show GPS coordinates from image EXIF data")
+	flag.BoolVar(&showChecksumsFlag, "show-checksums", false, "Show a SHA-256 column in listings")
+	flag.BoolVar(&contentIndexFlag, "enable-content-index", false, "Index text file contents for full-text search")
+	flag.StringVar(&indexDirFlag, "index-dir", "", "Directory storing the content index")
+	flag.StringVar(&keepVersionsFlag, "keep-versions", getEnv("KEEP_VERSIONS", "0"), "Earlier versions kept per overwritten file (0 disables versioning)")
+	flag.StringVar(&versionsDirFlag, "versions-dir", "", "Directory storing earlier file versions")
+	flag.BoolVar(&enableSharesFlag, "enable-shares", false, "Enable shared links under /s/")
+	flag.StringVar(&sharesFileFlag, "shares-file", "", "File persisting shared links")
+	flag.StringVar(&trashDirFlag, "trash-dir", "", "Directory deleted entries are moved to until purged")
+	flag.StringVar(&signingSecretFlag, "url-signing-secret", "", "Secret signing temporary file URLs (enables /sign)")
+	flag.StringVar(&signedMaxTTLFlag, "signed-url-max-ttl", getEnv("SIGNED_URL_MAX_TTL", "24h"), "Longest lifetime of a signed URL")
+	flag.BoolVar(&dirSizesFlag, "dir-sizes", false, "Show recursive directory sizes instead of item counts")
+	flag.BoolVar(&readOnlyFlag, "read-only", false, "Start in read-only mode")
+	flag.StringVar(&htpasswdFlag, "htpasswd", "", "htpasswd file with users allowed to access the server")
+	flag.StringVar(&tokensFileFlag, "tokens-file", "", "File with API tokens (name token [roles] per line)")
+	flag.StringVar(&aclFlag, "acl", "", "ACL file with per-path permissions")
+	flag.StringVar(&corsOriginsFlag, "cors-origins", "", "Comma separated origins allowed to call the API from the browser, or *")
+	flag.StringVar(&ipRulesFlag, "ip-rules", "", "File with allow/deny client address rules")
+	flag.StringVar(&generateTokenFlag, "generate-token", "", "Print a new API token entry for the given name and exit")
 	flag.Parse()
 
+	if logLevelFlag != "" {
+		logLevel = logLevelFlag
+	}
+	if logFormatFlag != "" {
+		logFormat = logFormatFlag
+	}
+	if logFileFlag != "" {
+		logFile = logFileFlag
+	}
+	if rotation, err := parseLogRotation(); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	} else {
+		logRotation = rotation
+	}
+	var logOutput io.Writer = os.Stderr
+	if logFile != "" {
+		out, err := openLogFile(logFile)
+		if err != nil {
+			log.Fatalf("Unable to open log file: %v", err)
+		}
+		logOutput = out
+	}
+	if logger, err := newLogger(logOutput, logFormat, logLevel); err != nil {
+		log.Fatalf("Invalid logging configuration: %v", err)
+	} else {
+		slog.SetDefault(logger)
+	}
+
+	if generateTokenFlag != "" {
+		token, err := generateAPIToken()
+		if err != nil {
+			fatal("Unable to generate token", "err", err)
+		}
+		fmt.Printf("%s %s\n", generateTokenFlag, token)
+		return
+	}
+
+	readOnly.Store(readOnlyFlag || getBoolEnv("READ_ONLY", false))
+
 	if enableUploadFlag {
 		enableUpload = true
 	}
@@ -95,99 +444,893 @@ func main() {
 		enableMetrics = true
 	}
 
-	os.MkdirAll(filesDir, os.ModePerm)
+	if enableAPIDocsFlag {
+		enableAPIDocs = true
+	}
+
+	if metricsPathGroupsFlag != "" {
+		metricsPathGroupsEnv = metricsPathGroupsFlag
+	}
+	metricsPathGroups = parsePathGroups(metricsPathGroupsEnv)
+
+	if rootFlag != "" {
+		filesDir = rootFlag
+	}
+
+	if err := validateFilesDir(); err != nil {
+		fatal("Invalid files dir", "err", err)
+	}
+
+	if normalizeNamesFlag != "" {
+		normalizeNames = normalizeNamesFlag
+	}
+
+	switch strings.ToLower(normalizeNames) {
+	case "nfc", "nfd", "none":
+	default:
+		fatal("Invalid name normalization, expected nfc, nfd or none", "value", normalizeNames)
+	}
+
+	if uploadTmpDirFlag != "" {
+		uploadTmpDir = uploadTmpDirFlag
+	}
+
+	uploadTypes = TypeFilter{
+		AllowExt:  parseExtList(uploadAllowExt),
+		DenyExt:   parseExtList(uploadDenyExt),
+		AllowMIME: splitList(strings.ToLower(uploadAllowMIME)),
+		DenyMIME:  splitList(strings.ToLower(uploadDenyMIME)),
+	}
+
+	if size, err := parseSize(maxUploadSizeFlag); err != nil {
+		fatal("Invalid max upload size", "err", err)
+	} else {
+		maxUploadSize = size
+	}
+
+	if n, err := strconv.Atoi(uploadConcurrencyFlag); err != nil || n < 1 {
+		fatal("Invalid upload concurrency, expected at least 1", "value", uploadConcurrencyFlag)
+	} else {
+		uploadConcurrency = n
+	}
+
+	if n, err := strconv.Atoi(pageSizeFlag); err != nil || n < 0 || n > maxPerPage {
+		fatal(fmt.Sprintf("Invalid page size, expected 0 to %d", maxPerPage), "value", pageSizeFlag)
+	} else {
+		pageSize = n
+	}
+
+	if confirmDropUploadFlag {
+		confirmDropUpload = true
+	}
+	if hideDotfilesFlag {
+		hideDotfiles = true
+	}
+
+	if blockIgnoredFlag {
+		blockIgnored = true
+	}
+
+	if serveIndexFlag {
+		serveIndex = true
+	}
+
+	if precompressedFlag {
+		servePrecompressedFiles = true
+	}
+
+	if acmeDomainsFlag != "" {
+		acmeDomainsEnv = acmeDomainsFlag
+	}
+	acmeDomains = splitList(acmeDomainsEnv)
+	if acmeCacheDirFlag != "" {
+		acmeCacheDir = acmeCacheDirFlag
+	}
+
+	if enableHTTP3Flag {
+		enableHTTP3 = true
+	}
+	if httpAddrFlag != "" {
+		httpAddr = httpAddrFlag
+	}
+	if httpsAddrFlag != "" {
+		httpsAddr = httpsAddrFlag
+	}
+	if tlsCertFlag != "" {
+		tlsCert = tlsCertFlag
+	}
+	if tlsKeyFlag != "" {
+		tlsKey = tlsKeyFlag
+	}
+	if err := resolveListenAddrs(); err != nil {
+		fatal("Invalid listener configuration", "err", err)
+	}
+	if err := parseServerLimits(); err != nil {
+		fatal("Invalid listener configuration", "err", err)
+	}
+
+	if metas, err := parseHeadMeta(headMetaEnv); err != nil {
+		fatal("Invalid HEAD_META", "err", err)
+	} else {
+		headMeta = metas
+	}
+	if n, err := strconv.Atoi(getEnv("HSTS_MAX_AGE", "0")); err != nil || n < 0 {
+		fatal("Invalid HSTS_MAX_AGE", "value", getEnv("HSTS_MAX_AGE", "0"))
+	} else {
+		hstsMaxAge = n
+	}
+
+	if accessLogFlag != "" {
+		accessLog = accessLogFlag
+	}
+	switch accessLogFormat {
+	case "common", "combined", "extended":
+	default:
+		fatal("Invalid ACCESS_LOG_FORMAT, expected common, combined or extended", "value", accessLogFormat)
+	}
+
+	if otlpEndpointFlag != "" {
+		otlpEndpoint = otlpEndpointFlag
+	}
+	if ratio, err := strconv.ParseFloat(getEnv("TRACE_SAMPLE_RATIO", "1"), 64); err != nil || ratio < 0 || ratio > 1 {
+		fatal("Invalid TRACE_SAMPLE_RATIO, expected 0 to 1", "value", getEnv("TRACE_SAMPLE_RATIO", "1"))
+	} else {
+		traceSampleRatio = ratio
+	}
+
+	if enablePprofFlag {
+		enablePprof = true
+	}
+	if pprofAddrFlag != "" {
+		pprofAddr = pprofAddrFlag
+	}
+	if enablePprof && pprofAddr != "" {
+		if err := checkLoopbackAddr(pprofAddr); err != nil {
+			fatal("Invalid PPROF_ADDR", "err", err)
+		}
+	}
+
+	if maxUploadsFlag != "" {
+		maxUploads = maxUploadsFlag
+	}
+	if maxDownloadsFlag != "" {
+		maxDownloads = maxDownloadsFlag
+	}
+	if n, err := strconv.Atoi(maxUploads); err != nil || n < 0 {
+		fatal("Invalid MAX_UPLOADS", "value", maxUploads)
+	} else {
+		uploadSlots = newTransferSlots(n)
+	}
+	if n, err := strconv.Atoi(maxDownloads); err != nil || n < 0 {
+		fatal("Invalid MAX_DOWNLOADS", "value", maxDownloads)
+	} else {
+		downloadSlots = newTransferSlots(n)
+	}
+	if timeout, err := time.ParseDuration(getEnv("TRANSFER_QUEUE_TIMEOUT", "30s")); err != nil || timeout < 0 {
+		fatal("Invalid TRANSFER_QUEUE_TIMEOUT", "value", getEnv("TRANSFER_QUEUE_TIMEOUT", "30s"))
+	} else {
+		transferQueueTimeout = timeout
+	}
+
+	if trustedProxiesFlag != "" {
+		trustedProxiesEnv = trustedProxiesFlag
+	}
+	if proxies, err := parseTrustedProxies(trustedProxiesEnv); err != nil {
+		fatal("Invalid TRUSTED_PROXIES", "err", err)
+	} else {
+		trustedProxies = proxies
+	}
+
+	if baseURLFlag != "" {
+		baseURL = baseURLFlag
+	}
+	if prefix, err := parseBaseURL(baseURL); err != nil {
+		fatal("Invalid BASE_URL", "err", err)
+	} else {
+		baseURL = prefix
+	}
+
+	if spaFallbackFlag {
+		spaFallback = true
+	}
+
+	if customCSSFlag != "" {
+		customCSSFile = customCSSFlag
+	}
+	if customCSSFile != "" {
+		css, err := loadCustomCSS(customCSSFile)
+		if err != nil {
+			fatal("Unable to load custom CSS", "err", err)
+		}
+		customCSS = css
+	}
+	if customFooterFlag != "" {
+		customFooterFile = customFooterFlag
+	}
+	if customFooterFile != "" {
+		footer, err := loadCustomFooter(customFooterFile)
+		if err != nil {
+			fatal("Unable to load custom footer", "err", err)
+		}
+		customFooter = footer
+	}
+
+	if themeFlag != "" {
+		theme = themeFlag
+	}
+	if name, err := parseTheme(theme); err != nil {
+		fatal("Invalid THEME", "err", err)
+	} else {
+		theme = name
+	}
+
+	if languageFlag != "" {
+		uiLanguage = languageFlag
+	}
+	if lang, err := parseLanguage(uiLanguage); err != nil {
+		fatal("Invalid UI_LANGUAGE", "err", err)
+	} else {
+		uiLanguage = lang
+	}
+
+	if timeZoneFlag != "" {
+		timeZone = timeZoneFlag
+	}
+	if location, err := loadTimeZone(timeZone); err != nil {
+		fatal("Invalid TZ", "err", err)
+	} else {
+		displayLocation = location
+	}
+	if dateFormatFlag != "" {
+		dateFormat = dateFormatFlag
+	}
+	if err := checkDateFormat(dateFormat); err != nil {
+		fatal("Invalid DATE_FORMAT", "err", err)
+	}
+	if relativeDatesFlag {
+		relativeDates = true
+	}
+
+	if sizeUnitsFlag != "" {
+		sizeUnits = sizeUnitsFlag
+	}
+	if units, err := parseSizeUnits(sizeUnits); err != nil {
+		fatal("Invalid SIZE_UNITS", "err", err)
+	} else {
+		sizeUnits = units
+	}
+	if exactSizesFlag {
+		exactSizes = true
+	}
+
+	if logoFlag != "" {
+		logoFile = logoFlag
+	}
+	if faviconFlag != "" {
+		faviconFile = faviconFlag
+	}
+	for _, file := range []string{logoFile, faviconFile} {
+		if file == "" {
+			continue
+		}
+		if err := checkAssetFile(file); err != nil {
+			fatal("Invalid LOGO or FAVICON", "err", err)
+		}
+	}
+
+	if templatesFlag != "" {
+		templatesDir = templatesFlag
+	}
+
+	if templatesDir != "" {
+		overrides, err := loadTemplateOverrides(templatesDir)
+		if err != nil {
+			fatal("Unable to load templates", "err", err)
+		}
+		templateOverrides = overrides
+		if _, err := parseTemplates("en", sizeUnits); err != nil {
+			fatal("Invalid templates", "dir", templatesDir, "err", err)
+		}
+		slog.Info("Loaded template overrides", "dir", templatesDir, "count", len(overrides))
+	}
+
+	if errorPagesFlag != "" {
+		errorPagesDir = errorPagesFlag
+	}
+
+	if errorPagesDir != "" {
+		pages, err := loadErrorPages(errorPagesDir)
+		if err != nil {
+			fatal("Unable to load error pages", "err", err)
+		}
+		errorPages = pages
+	}
+
+	if followSymlinksFlag != "" {
+		symlinkRootsEnv = followSymlinksFlag
+	}
+
+	if roots, err := parseSymlinkRoots(symlinkRootsEnv); err != nil {
+		fatal("Invalid FOLLOW_SYMLINKS", "err", err)
+	} else {
+		symlinkRoots = roots
+	}
+
+	if quotasFlag != "" {
+		quotasEnv = quotasFlag
+	}
+
+	if list, err := parseQuotas(quotasEnv); err != nil {
+		fatal("Invalid quotas", "err", err)
+	} else {
+		quotas = list
+	}
+
+	if enableThumbnailsFlag {
+		enableThumbnails = true
+	}
+
+	if size, err := parseSize(getEnv("THUMB_CACHE_SIZE", "256M")); err != nil {
+		fatal("Invalid THUMB_CACHE_SIZE", "err", err)
+	} else {
+		thumbCacheSize = size
+	}
+
+	if renderMarkdownFlag {
+		renderMarkdownFiles = true
+	}
+
+	if showReadmeFlag {
+		showReadme = true
+	}
+
+	if exifGPSFlag {
+		exifGPS = true
+	}
+
+	if showChecksumsFlag {
+		showChecksums = true
+	}
+
+	if contentIndexFlag {
+		enableContentIndex = true
+	}
+
+	if indexDirFlag != "" {
+		indexDir = indexDirFlag
+	}
+
+	if n, err := strconv.Atoi(keepVersionsFlag); err != nil || n < 0 {
+		fatal("Invalid KEEP_VERSIONS", "value", keepVersionsFlag)
+	} else {
+		keepVersions = n
+	}
+	if versionsDirFlag != "" {
+		versionsDir = versionsDirFlag
+	}
+	if trashDirFlag != "" {
+		trashDir = trashDirFlag
+	}
+
+	if enableSharesFlag {
+		enableShares = true
+	}
+	if sharesFileFlag != "" {
+		sharesFile = sharesFileFlag
+	}
+	if enableShares && sharesFile != "" {
+		if err := loadShares(sharesFile); err != nil {
+			fatal("Unable to load shares", "err", err)
+		}
+	}
+
+	if signingSecretFlag != "" {
+		urlSigningSecret = signingSecretFlag
+	}
+	if key, err := parseSigningSecret(urlSigningSecret); err != nil {
+		fatal("Invalid URL_SIGNING_SECRET", "err", err)
+	} else {
+		urlSigningKey = key
+	}
+	if ttl, err := time.ParseDuration(signedMaxTTLFlag); err != nil || ttl <= 0 {
+		fatal("Invalid SIGNED_URL_MAX_TTL", "value", signedMaxTTLFlag)
+	} else {
+		signedURLMaxTTL = ttl
+	}
+
+	if dirSizesFlag {
+		enableDirSizes = true
+	}
+
+	if ttl, err := time.ParseDuration(getEnv("DIR_SIZE_TTL", "10m")); err != nil {
+		fatal("Invalid DIR_SIZE_TTL", "err", err)
+	} else {
+		dirSizeTTL = ttl
+	}
+
+	// An empty AUTH_PASS would let AUTH_USER log in without a password
+	if authUser != "" && authPass == "" {
+		fatal("AUTH_USER is set without AUTH_PASS")
+	}
+
+	if htpasswdFlag != "" {
+		authHtpasswd = htpasswdFlag
+	}
+
+	if authHtpasswd != "" {
+		users, err := loadHtpasswd(authHtpasswd)
+		if err != nil {
+			fatal("Unable to load htpasswd file", "err", err)
+		}
+		htpasswdUsers = users
+	}
+
+	if tokensFileFlag != "" {
+		apiTokensFile = tokensFileFlag
+	}
+
+	if err := parseAPITokens(apiTokensEnv); err != nil {
+		fatal("Invalid API_TOKENS", "err", err)
+	}
+
+	if apiTokensFile != "" {
+		if err := loadAPITokens(apiTokensFile); err != nil {
+			fatal("Unable to load API tokens", "err", err)
+		}
+	}
+
+	if aclFlag != "" {
+		aclFile = aclFlag
+	}
+
+	if aclFile != "" {
+		rules, err := loadACL(aclFile)
+		if err != nil {
+			fatal("Unable to load ACL", "err", err)
+		}
+		aclRules = rules
+	}
+
+	if corsOriginsFlag != "" {
+		corsOrigins = splitList(corsOriginsFlag)
+	}
+	if corsCredentials && slices.Contains(corsOrigins, "*") {
+		fatal("CORS_CREDENTIALS cannot be used with CORS_ORIGINS=*, which would let any site act as logged in users")
+	}
+
+	if ipRulesFlag != "" {
+		ipRulesFile = ipRulesFlag
+	}
+	if rules, err := parseIPRules(ipAllow, ipDeny); err != nil {
+		fatal("Invalid IP_ALLOW or IP_DENY", "err", err)
+	} else {
+		ipRules = rules
+	}
+	if ipRulesFile != "" {
+		rules, err := loadIPRules(ipRulesFile)
+		if err != nil {
+			fatal("Unable to load IP rules", "err", err)
+		}
+		ipRules = append(ipRules, rules...)
+	}
+
+	if authRealm == "" {
+		authRealm = title
+	}
+
+	if uploadTmpDir != "" {
+		if err := os.MkdirAll(uploadTmpDir, 0o700); err != nil {
+			fatal("Unable to create upload staging directory", "path", uploadTmpDir, "err", err)
+		}
+	}
+
+	if keepVersions > 0 {
+		if err := os.MkdirAll(versionsDir, 0o700); err != nil {
+			fatal("Unable to create versions directory", "path", versionsDir, "err", err)
+		}
+		// Versions inside the files dir would be listed and served directly
+		root, rootErr := realPath(filesDir)
+		store, storeErr := realPath(versionsDir)
+		if rootErr == nil && storeErr == nil && isUnder(store, root) {
+			fatal("VERSIONS_DIR must be outside the files dir", "path", versionsDir)
+		}
+	}
+
+	if trashDir != "" {
+		if err := os.MkdirAll(trashDir, 0o700); err != nil {
+			fatal("Unable to create trash directory", "path", trashDir, "err", err)
+		}
+		// Deleted entries must not stay reachable in the files dir
+		root, rootErr := realPath(filesDir)
+		trash, trashErr := realPath(trashDir)
+		if rootErr == nil && trashErr == nil && isUnder(trash, root) {
+			fatal("TRASH_DIR must be outside the files dir", "path", trashDir)
+		}
+	}
+
+	registerMetrics()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", pathHandler)
+	mux.HandleFunc("/upload", uploadHandler)
+	mux.HandleFunc("/upload/chunk", chunkUploadHandler)
+	mux.HandleFunc("/archive", archiveHandler)
+	mux.HandleFunc("/unlock", unlockHandler)
+	mux.HandleFunc("/rename", renameHandler)
+	mux.HandleFunc("/mkdir", mkdirHandler)
+	mux.HandleFunc("/delete", deleteHandler)
+	mux.HandleFunc("/move", moveHandler)
+	mux.HandleFunc("/thumb/", thumbHandler)
+	mux.HandleFunc("/preview", previewHandler)
+	mux.HandleFunc("/exif", exifHandler)
+	mux.HandleFunc("/checksum", checksumHandler)
+	mux.HandleFunc("/qr", qrHandler)
+	mux.HandleFunc("/search", searchHandler)
+	mux.HandleFunc("/tree", treeHandler)
+	mux.HandleFunc("/versions", versionsHandler)
+	mux.HandleFunc("/versions/restore", restoreVersionHandler)
+	mux.HandleFunc("/share", shareHandler)
+	mux.HandleFunc("/shares", sharesHandler)
+	mux.HandleFunc("/shares/revoke", revokeShareHandler)
+	mux.HandleFunc("/sign", signHandler)
+	mux.HandleFunc(sharePrefix, sharedHandler)
+	mux.HandleFunc("/metrics", metricsHandler)
+	mux.HandleFunc("/admin", adminHandler)
+	mux.HandleFunc("/admin/readonly", adminReadOnlyHandler)
+	mux.HandleFunc("/admin/trash/purge", adminPurgeTrashHandler)
+	mux.HandleFunc("/api/openapi.json", openAPIHandler)
+	mux.HandleFunc("/api/docs", apiDocsHandler)
+	mux.HandleFunc("/api/docs/", apiDocsAssetsHandler)
+	mux.HandleFunc(assetsPrefix, assetsHandler)
+	if enablePprof && pprofAddr == "" {
+		mux.Handle("/debug/pprof/", pprofHandler())
+	}
+
+	slog.Info("Serving files", "root", filesDir)
+	if len(symlinkRoots) > 0 {
+		slog.Info("Following symlinks", "roots", symlinkRoots)
+	}
+
+	if clamdAddress != "" {
+		slog.Info("Scanning uploads with clamd", "address", clamdAddress)
+	}
 
-	http.HandleFunc("/", pathHandler)
-	http.HandleFunc("/upload", uploadHandler)
-	http.HandleFunc("/metrics", metricsHandler)
+	if len(webhookURLs) > 0 {
+		go deliverWebhooks()
+		slog.Info("Sending webhooks", "urls", len(webhookURLs))
+	}
+
+	if len(quotas) > 0 {
+		go refreshQuotaUsage()
+		slog.Info("Storage quotas are enabled", "quotas", quotaSummary())
+	}
 
-	log.Printf("Server running at http://localhost%s", port)
+	if enableThumbnails {
+		go pruneThumbnails()
+		slog.Info("Thumbnails are enabled", "cache", thumbCacheDir)
+	}
+
+	if enableDirSizes {
+		go walkDirSizes()
+		slog.Info("Directory sizes are enabled", "ttl", dirSizeTTL)
+	}
+
+	if enableContentIndex {
+		go indexContents()
+		slog.Info("Content search is enabled", "index", indexDir)
+	}
+
+	if keepVersions > 0 {
+		slog.Info("File versioning is enabled", "keep", keepVersions, "dir", versionsDir)
+	}
+
+	if enableShares {
+		slog.Info("Shared links are enabled", "file", orDefault(sharesFile, "(memory only)"))
+	}
+
+	if len(urlSigningKey) > 0 {
+		slog.Info("Signed URLs are enabled", "path", "/sign")
+	}
 
 	if enableUpload {
-		log.Printf("File uploads are enabled")
+		go sweepChunks()
+		slog.Info("File uploads are enabled")
 	} else {
-		log.Printf("File uploads are disabled")
+		slog.Info("File uploads are disabled")
+	}
+
+	if adminPass != "" {
+		slog.Info("Admin dashboard available", "path", "/admin")
+	}
+
+	if enableMetrics || adminPass != "" {
+		go refreshDiskUsage()
+	}
+
+	if enableAPIDocs {
+		slog.Info("API docs available", "path", "/api/docs")
 	}
 
 	if enableMetrics {
-		log.Printf("Metrics endpoint available at /metrics")
+		slog.Info("Metrics endpoint available", "path", "/metrics")
 	} else {
-		log.Printf("Metrics endpoint is disabled")
+		slog.Info("Metrics endpoint is disabled")
 	}
 
-	log.Fatal(http.ListenAndServe(port, nil))
-}
-
-func pathHandler(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		if r.URL.Path != "/metrics" {
-			duration := time.Since(start).Seconds()
-			recordRequestDuration(r.Method, duration)
+	if enablePprof {
+		if pprofAddr != "" {
+			go servePprof(pprofAddr)
+		} else {
+			slog.Info("Profiling endpoints available to admins", "path", "/debug/pprof/")
 		}
-	}()
+	}
+
+	var handler http.Handler = mux
+	if csrfProtection {
+		handler = requireCSRF(handler)
+	}
+	if authEnabled() || len(apiTokens) > 0 {
+		handler = requireAuth(handler, mux)
+	}
+	if len(urlSigningKey) > 0 {
+		handler = withSignedURLs(handler)
+	}
+	if len(corsOrigins) > 0 {
+		handler = withCORS(handler)
+		slog.Info("CORS is enabled", "origins", corsOrigins)
+	}
+	if len(ipRules) > 0 {
+		handler = requireAllowedIP(handler)
+		slog.Info("Loaded IP rules", "count", len(ipRules))
+	}
+	handler = withSecurityHeaders(handler)
 
-	if r.URL.Path != "/metrics" {
-		httpRequestsTotal.Add(1)
+	if len(aclRules) > 0 {
+		slog.Info("Loaded ACL rules", "count", len(aclRules))
 	}
 
-	urlPath := r.URL.Path
-	fullPath := filepath.Join(filesDir, urlPath)
+	if authEnabled() {
+		slog.Info("Basic auth is enabled")
+	}
 
-	absFilesDir, _ := filepath.Abs(filesDir)
-	absPath, _ := filepath.Abs(fullPath)
-	if !strings.HasPrefix(absPath, absFilesDir) {
-		if r.URL.Path != "/metrics" {
-			httpRequestsError.Add(1)
+	if len(apiTokens) > 0 {
+		slog.Info("Loaded API tokens", "count", len(apiTokens))
+	}
+
+	handler = withRequestMetrics(handler)
+
+	if baseURL != "" {
+		handler = withBaseURL(handler)
+		slog.Info("Serving under a base URL", "base_url", baseURL+"/")
+	}
+
+	if accessLog != "" {
+		out, err := openAccessLog(accessLog)
+		if err != nil {
+			fatal("Unable to open access log", "err", err)
 		}
-		http.NotFound(w, r)
+		accessLogger = log.New(out, "", 0)
+		handler = withAccessLog(handler)
+		slog.Info("Writing access log", "format", accessLogFormat, "destination", accessLog)
+	}
+
+	if otlpEndpoint != "" {
+		if err := setupTracing(); err != nil {
+			fatal("Unable to set up tracing", "err", err)
+		}
+		handler = withTracing(handler)
+		slog.Info("Exporting traces", "endpoint", otlpEndpoint, "sample_ratio", traceSampleRatio)
+	}
+
+	fatal("Server stopped", "err", serve(handler))
+}
+
+func pathHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		putHandler(w, r)
 		return
 	}
 
+	urlPath := r.URL.Path
+	fullPath := resolvePath(urlPath)
+
 	if _, err := os.Stat(filesDir); os.IsNotExist(err) {
-		if r.URL.Path != "/metrics" {
-			httpRequestsError.Add(1)
-		}
-		http.Error(w, fmt.Sprintf("files dir %s: no such directory", filesDir), http.StatusInternalServerError)
+		slog.Error("Files dir does not exist", "path", filesDir)
+		serveError(w, r, http.StatusInternalServerError, "Files directory unavailable")
+		return
+	}
+
+	if !withinRoot(fullPath) {
+		notFound(w, r)
+		return
+	}
+
+	if filepath.Base(fullPath) == accessFileName || (blockIgnored && isIgnored(fullPath)) {
+		notFound(w, r)
 		return
 	}
 
+	// Checked before looking at the path, so clients without any access
+	// can't tell which files exist; the exact permission follows below
+	if !permitted(r, urlPath, PermRead|PermList) {
+		denyPermission(w, r)
+		return
+	}
+
+	_, span := startSpan(r, "stat", attribute.String("path", urlPath))
 	info, err := os.Stat(fullPath)
-	if err != nil {
-		if r.URL.Path != "/metrics" {
-			httpRequestsError.Add(1)
+	endSpan(span, err)
+	if os.IsNotExist(err) && urlPath != "/" {
+		if indexPath, ok := spaFallbackIndex(r); ok {
+			fileServes.Inc()
+			http.ServeFile(w, r, indexPath)
+			return
 		}
+	}
+	if err != nil {
 		if urlPath == "/" {
-			http.Error(w, fmt.Sprintf("files dir %s: inaccessible or bad perms", filesDir), http.StatusInternalServerError)
+			slog.Error("Files dir is inaccessible", "path", filesDir, "err", err)
+			serveError(w, r, http.StatusInternalServerError, "Files directory unavailable")
 		} else {
-			http.Error(w, fmt.Sprintf("%s: no such file or directory", fullPath), http.StatusNotFound)
+			serveError(w, r, http.StatusNotFound, fmt.Sprintf("%s: no such file or directory", urlPath))
 		}
 		return
 	}
 
+	accessDir := fullPath
+	if !info.IsDir() {
+		accessDir = filepath.Dir(fullPath)
+	}
+	if !checkAccess(r, accessDir) {
+		denyAccess(w, r)
+		return
+	}
+
+	perm := PermRead
+	if info.IsDir() {
+		perm = PermList
+	}
+	if !permitted(r, urlPath, perm) {
+		denyPermission(w, r)
+		return
+	}
+
 	if info.IsDir() {
 		if !strings.HasSuffix(urlPath, "/") {
-			http.Redirect(w, r, urlPath+"/", http.StatusFound)
+			target := urlPath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusFound)
 			return
 		}
-		directoryLists.Add(1)
-		listDirectory(w, fullPath, urlPath)
+		if r.URL.Query().Get("download") == "" && !wantsJSON(r) {
+			if indexPath, ok := directoryIndex(r, fullPath, urlPath); ok {
+				http.ServeFile(w, r, indexPath)
+				return
+			}
+		}
+		directoryLists.Inc()
+		switch download := r.URL.Query().Get("download"); {
+		case download == "targz":
+			serveTarGz(w, r, fullPath, urlPath)
+		case download == "zip":
+			serveZip(w, r, fullPath, urlPath)
+		case wantsJSON(r):
+			serveJSONListing(w, r, fullPath, urlPath)
+		default:
+			listDirectory(w, r, fullPath, urlPath)
+		}
+	} else if r.URL.Query().Get("format") == "json" {
+		serveJSONMetadata(w, info, urlPath)
+	} else if r.URL.Query().Get("tail") == "1" {
+		fileServes.Inc()
+		serveTail(w, r, fullPath, urlPath)
+	} else if r.URL.Query().Get("view") == "hex" {
+		fileServes.Inc()
+		serveHexView(w, r, fullPath, urlPath, info.Size())
+	} else if isMarkdown(fullPath) && wantsRenderedMarkdown(r) && info.Size() <= markdownMaxSize {
+		fileServes.Inc()
+		serveMarkdown(w, r, fullPath, urlPath)
+	} else if isPDF(fullPath) && r.URL.Query().Get("preview") == "1" {
+		name := filepath.Base(fullPath)
+		serveDocument(w, r, urlPath, Document{Frame: name, Actions: []Crumb{{Label: "open", URL: name}}})
+	} else if isPDF(fullPath) {
+		fileServes.Inc()
+		servePDF(w, r, fullPath)
 	} else {
-		fileServes.Add(1)
+		fileServes.Inc()
+		release, ok := acquireTransfer(w, r, downloadSlots)
+		if !ok {
+			return
+		}
+		defer release()
+		w, done := countDownload(w)
+		defer done()
+		allowLongWrite(w)
+		if servePrecompressedFiles && servePrecompressed(w, r, fullPath) {
+			return
+		}
 		http.ServeFile(w, r, fullPath)
 	}
+}
 
-	if r.URL.Path != "/metrics" {
-		httpRequestsSuccess.Add(1)
+// readDirectory returns the entries of dirPath that are shown to clients,
+// leaving out internal files such as staged uploads and access files.
+func readDirectory(dirPath string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
 	}
+	visible := entries[:0]
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), stagingPrefix) || entry.Name() == accessFileName {
+			continue
+		}
+		visible = append(visible, entry)
+	}
+	return visible, nil
 }
 
-func listDirectory(w http.ResponseWriter, dirPath string, urlPath string) {
-	entries, err := os.ReadDir(dirPath)
+func listDirectory(w http.ResponseWriter, r *http.Request, dirPath string, urlPath string) {
+	r, span := startSpan(r, "listing", attribute.String("path", urlPath))
+	defer span.End()
+	order, err := parseListingSort(r)
 	if err != nil {
-		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePagination(r, pageSize, order)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := readDirectory(dirPath)
+	if err != nil {
+		slog.Error("Unable to read directory", "path", dirPath, "err", err)
+		serveError(w, r, http.StatusInternalServerError, "Error reading directory")
+		return
+	}
+	entries = filterIgnored(filterDotfiles(r, entries), dirPath)
+	sorted := sortedInfos(entries, dirPath, order)
+	lang := requestLanguage(r)
+	if uiLanguage == "" {
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	units := requestSizeUnits(r)
+	grid := gridLayout(r)
+	siteURL := externalURL(r)
+	variant := []string{"html", csrfToken(w, r), requestTheme(r), lang, units, strconv.FormatBool(grid), siteURL, strconv.FormatBool(readOnly.Load())}
+	if relativeDates {
+		// "2 hours ago" goes stale even when the directory does not change
+		variant = append(variant, time.Now().Truncate(time.Minute).String())
+	}
+	// The footer's disk and quota figures change with writes anywhere
+	var disk *DiskUsage
+	if usage, err := statDisk(filesDir); err == nil {
+		lastDiskUsage.Store(&usage)
+		disk = &usage
+		variant = append(variant, formatSizeIn(units, int64(usage.AvailBytes)), formatSizeIn(units, int64(usage.TotalBytes)))
+	}
+	quota := tightestQuota(urlPath)
+	if quota != nil {
+		variant = append(variant, quota.Prefix, formatSizeIn(units, quota.Used()), formatSizeIn(units, quota.Limit))
+	}
+	if listingNotModified(w, r, listingETag(sorted, variant...)) {
 		return
 	}
+	// Over the whole directory so the gallery and player exist for later pages
+	hasImages := false
+	hasAudio := false
+	for _, info := range sorted {
+		if !info.IsDir() {
+			hasImages = hasImages || hasThumbnail(info.Name())
+			hasAudio = hasAudio || isAudio(info.Name())
+		}
+	}
+	// Only the shown page is inspected further, keeping huge directories cheap
+	infos := page.slice(sorted)
 
 	parentURL := "/"
 	if urlPath != "/" {
@@ -199,58 +1342,65 @@ func listDirectory(w http.ResponseWriter, dirPath string, urlPath string) {
 		}
 	}
 
-	fileInfos := make([]FileInfo, 0, len(entries))
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		entryURL := entry.Name()
-		var size string
-		if entry.IsDir() {
+	now := time.Now()
+	fileInfos := make([]FileInfo, 0, len(infos))
+	for _, info := range infos {
+		entryURL := info.Name()
+		var size, sizeExact string
+		if info.IsDir() {
 			entryURL += "/"
-			subDirPath := filepath.Join(dirPath, entry.Name())
-			if subEntries, err := os.ReadDir(subDirPath); err == nil {
+			subDirPath := filepath.Join(dirPath, info.Name())
+			var dirSize int64
+			sized := false
+			if enableDirSizes {
+				dirSize, sized = cachedDirSize(subDirPath)
+			}
+			if sized {
+				size = formatSizeIn(units, dirSize)
+				if exactSizes {
+					sizeExact = formatExactSize(lang, dirSize)
+				}
+			} else if subEntries, err := os.ReadDir(subDirPath); err == nil {
 				itemCount := len(subEntries)
 				if itemCount == 1 {
-					size = "1 item"
+					size = translate(lang, "1 item")
 				} else {
-					size = fmt.Sprintf("%d items", itemCount)
+					size = translate(lang, "%d items", itemCount)
 				}
 			} else {
 				size = "-"
 			}
 		} else {
-			size = formatSize(info.Size())
+			size = formatSizeIn(units, info.Size())
+			if exactSizes {
+				sizeExact = formatExactSize(lang, info.Size())
+			}
+		}
+
+		lastModified, modifiedExact := formatDate(info.ModTime()), ""
+		if relativeDates {
+			lastModified, modifiedExact = formatRelativeDate(lang, info.ModTime(), now), lastModified
 		}
 
 		fileInfos = append(fileInfos, FileInfo{
-			Name:         entry.Name(),
-			Size:         size,
-			LastModified: info.ModTime().Format("2006-01-02 15:04-07:00"),
-			IsDir:        entry.IsDir(),
-			URL:          entryURL,
+			Name:          info.Name(),
+			Size:          size,
+			LastModified:  lastModified,
+			ModifiedISO:   info.ModTime().UTC().Format(time.RFC3339),
+			ModifiedExact: modifiedExact,
+			IsDir:         info.IsDir(),
+			URL:           entryURL,
+			Image:         !info.IsDir() && hasThumbnail(info.Name()),
+			Thumbnail:     enableThumbnails && !info.IsDir() && hasThumbnail(info.Name()),
+			Audio:         !info.IsDir() && isAudio(info.Name()),
+			PDF:           !info.IsDir() && isPDF(info.Name()),
+			Symlink:       info.Mode()&fs.ModeSymlink != 0,
+			BrokenLink:    isBrokenLink(info),
+			SizeExact:     sizeExact,
 		})
 	}
 
-	sort.Slice(fileInfos, func(i, j int) bool {
-		if fileInfos[i].IsDir && !fileInfos[j].IsDir {
-			return true
-		}
-		if !fileInfos[i].IsDir && fileInfos[j].IsDir {
-			return false
-		}
-		return fileInfos[i].Name < fileInfos[j].Name
-	})
-
-	tmpl := template.New("index").Funcs(template.FuncMap{
-		"safeHTML": func(s string) template.HTML {
-			return template.HTML(s)
-		},
-	})
-
-	tmpl, err = tmpl.Parse(htmlTemplate)
+	tmpl, err := parseTemplates(lang, units)
 	if err != nil {
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
 		return
@@ -258,6 +1408,11 @@ func listDirectory(w http.ResponseWriter, dirPath string, urlPath string) {
 
 	breadcrumbs := buildBreadcrumbs(urlPath)
 
+	var readme template.HTML
+	if showReadme && r.URL.Query().Get("rows") != "1" {
+		readme = directoryReadme(r, entries, dirPath, urlPath)
+	}
+
 	data := struct {
 		CurrentPath   string
 		ParentURL     string
@@ -267,204 +1422,143 @@ func listDirectory(w http.ResponseWriter, dirPath string, urlPath string) {
 		GitCommit     string
 		BuildDate     string
 		DisableUpload bool
+		MaxUploadSize int64
+		Concurrency   int
+		ConfirmDrop   bool
+		Versions      bool
+		Shares        bool
+		Quota         *Quota
+		Disk          *DiskUsage
+		HasImages     bool
+		HasAudio      bool
+		Readme        template.HTML
+		ShowChecksums bool
 		Breadcrumbs   []Crumb
+		Sort          ListingSort
+		Page          Pagination
+		HideDotfiles  bool
+		ShowDotfiles  bool
+		CSRFToken     string
+		Theme         string
+		Grid          bool
+		SiteURL       string
 	}{
 		CurrentPath:   urlPath,
-		ParentURL:     parentURL,
+		ParentURL:     prefixURL(parentURL),
 		Files:         fileInfos,
 		Title:         title,
 		ExtraHeaders:  extraHeaders,
 		GitCommit:     GitCommit,
 		BuildDate:     BuildDate,
-		DisableUpload: !enableUpload,
+		DisableUpload: !enableUpload || readOnly.Load(),
+		MaxUploadSize: maxUploadSize,
+		Concurrency:   uploadConcurrency,
+		ConfirmDrop:   confirmDropUpload,
+		Versions:      keepVersions > 0,
+		Shares:        enableShares,
+		Quota:         quota,
+		Disk:          disk,
+		HasImages:     hasImages,
+		HasAudio:      hasAudio,
+		Readme:        readme,
+		ShowChecksums: showChecksums,
 		Breadcrumbs:   breadcrumbs,
+		Sort:          order,
+		Page:          page,
+		HideDotfiles:  hideDotfiles,
+		ShowDotfiles:  showDotfiles(r),
+		CSRFToken:     csrfToken(w, r),
+		Theme:         requestTheme(r),
+		Grid:          grid,
+		SiteURL:       siteURL,
 	}
 
-	tmpl.Execute(w, data)
-}
-
-func uploadHandler(w http.ResponseWriter, r *http.Request) {
-	start := time.Now()
-	defer func() {
-		duration := time.Since(start).Seconds()
-		recordRequestDuration(r.Method, duration)
-	}()
-
-	uploadsTotal.Add(1)
-
-	if !enableUpload {
-		uploadsError.Add(1)
-		http.Error(w, "File uploads are disabled", http.StatusForbidden)
-		return
-	}
-
-	if r.Method != "POST" {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-
-	targetDir := r.FormValue("dir")
-	if targetDir == "" {
-		targetDir = "/"
-	}
-
-	fullPath := filepath.Join(filesDir, filepath.Clean(targetDir))
-	os.MkdirAll(fullPath, os.ModePerm)
-
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		uploadsError.Add(1)
-		http.Error(w, "Invalid upload", http.StatusBadRequest)
-		return
-	}
-	defer file.Close()
-
-	filename := strings.ReplaceAll(header.Filename, "/", "_")
-	finalPath := filepath.Join(fullPath, filename)
-
-	absFilesDir, _ := filepath.Abs(filesDir)
-	absFinalPath, _ := filepath.Abs(finalPath)
-	if !strings.HasPrefix(absFinalPath, absFilesDir) {
-		uploadsError.Add(1)
-		http.Error(w, "Invalid file path", http.StatusForbidden)
+	if r.URL.Query().Get("rows") == "1" {
+		serveListingChunk(w, tmpl, page, data)
 		return
 	}
-
-	dst, err := os.Create(finalPath)
-	if err != nil {
-		uploadsError.Add(1)
-		http.Error(w, "Unable to save file", http.StatusInternalServerError)
-		return
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
-	if err != nil {
-		uploadsError.Add(1)
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
-		return
-	}
-
-	uploadsSuccess.Add(1)
-	http.Redirect(w, r, targetDir, http.StatusSeeOther)
+	tmpl.Execute(w, data)
 }
 
-func recordRequestDuration(method string, duration float64) {
-	buckets, exists := requestDurationBuckets[method]
-	if !exists {
-		return
-	}
-
-	requestDurationCount[method].Add(1)
-	durationMicros := uint64(duration * 1_000_000)
-	requestDurationSum[method].Add(durationMicros)
-
-	bucketThresholds := []string{"0.1", "0.5", "1.0", "+Inf"}
-	thresholds := []float64{0.1, 0.5, 1.0, math.Inf(1)}
-
-	for i, threshold := range thresholds {
-		if duration <= threshold {
-			buckets[bucketThresholds[i]].Add(1)
-		}
+// parseTemplates parses the listing page together with the other pages,
+// which reuse its "style" block, with their strings in lang and sizes in
+// units. Files from TEMPLATES_DIR replace the embedded pages or redefine
+// single blocks.
+func parseTemplates(lang, units string) (*template.Template, error) {
+	tmpl := template.New("index").Funcs(template.FuncMap{
+		"safeHTML": func(s string) template.HTML {
+			return template.HTML(s)
+		},
+		"formatSize":   func(bytes int64) string { return formatSizeIn(units, bytes) },
+		"sizeUnits":    func() string { return units },
+		"url":          prefixURL,
+		"headMeta":     func() []HeadMeta { return headMeta },
+		"headScripts":  func() []string { return headScripts },
+		"customCSS":    func() template.CSS { return customCSS },
+		"customFooter": func() template.HTML { return customFooter },
+		"logoURL":      logoURL,
+		"faviconURL":   faviconURL,
+		"themes":       func() []string { return themes },
+		"formatDiskSize": func(bytes uint64) string {
+			return formatSizeIn(units, int64(bytes))
+		},
+	}).Funcs(localeFuncs(lang))
+	if _, err := tmpl.Parse(orDefault(templateOverrides[listingTemplateFile], htmlTemplate)); err != nil {
+		return nil, err
 	}
-}
-
-func metricsHandler(w http.ResponseWriter, r *http.Request) {
-	if !enableMetrics {
-		http.Error(w, "Metrics are disabled", http.StatusForbidden)
-		return
+	if _, err := tmpl.New("document").Parse(orDefault(templateOverrides[documentTemplateFile], documentTemplate)); err != nil {
+		return nil, err
 	}
-
-	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
-
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	uptime := time.Since(startTime).Seconds()
-
-	fmt.Fprintf(w, "# HELP filebrowser_info Information about the file browser\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_info gauge\n")
-	fmt.Fprintf(w, "filebrowser_info{version=\"%s\",build_date=\"%s\"} 1\n", GitCommit, BuildDate)
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_uptime_seconds Total uptime in seconds\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_uptime_seconds gauge\n")
-	fmt.Fprintf(w, "filebrowser_uptime_seconds %.2f\n", uptime)
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_http_requests_total Total number of HTTP requests\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_http_requests_total counter\n")
-	fmt.Fprintf(w, "filebrowser_http_requests_total{status=\"total\"} %d\n", httpRequestsTotal.Load())
-	fmt.Fprintf(w, "filebrowser_http_requests_total{status=\"success\"} %d\n", httpRequestsSuccess.Load())
-	fmt.Fprintf(w, "filebrowser_http_requests_total{status=\"error\"} %d\n", httpRequestsError.Load())
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_uploads_total Total number of file uploads\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_uploads_total counter\n")
-	fmt.Fprintf(w, "filebrowser_uploads_total{status=\"total\"} %d\n", uploadsTotal.Load())
-	fmt.Fprintf(w, "filebrowser_uploads_total{status=\"success\"} %d\n", uploadsSuccess.Load())
-	fmt.Fprintf(w, "filebrowser_uploads_total{status=\"error\"} %d\n", uploadsError.Load())
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_operations_total Total number of file operations\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_operations_total counter\n")
-	fmt.Fprintf(w, "filebrowser_operations_total{type=\"directory_list\"} %d\n", directoryLists.Load())
-	fmt.Fprintf(w, "filebrowser_operations_total{type=\"file_serve\"} %d\n", fileServes.Load())
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_http_request_duration_seconds HTTP request duration in seconds\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_http_request_duration_seconds histogram\n")
-
-	for method, buckets := range requestDurationBuckets {
-		for bucket, count := range buckets {
-			fmt.Fprintf(w, "filebrowser_http_request_duration_seconds_bucket{le=\"%s\",method=\"%s\"} %d\n", bucket, method, count.Load())
-		}
-
-		sumMicros := requestDurationSum[method].Load()
-		sumSeconds := float64(sumMicros) / 1_000_000
-		fmt.Fprintf(w, "filebrowser_http_request_duration_seconds_sum{method=\"%s\"} %.6f\n", method, sumSeconds)
-		fmt.Fprintf(w, "filebrowser_http_request_duration_seconds_count{method=\"%s\"} %d\n", method, requestDurationCount[method].Load())
+	if err := parseBlockOverrides(tmpl); err != nil {
+		return nil, err
 	}
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_memory_bytes Memory usage in bytes\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_memory_bytes gauge\n")
-	fmt.Fprintf(w, "filebrowser_memory_bytes{type=\"alloc\"} %d\n", m.Alloc)
-	fmt.Fprintf(w, "filebrowser_memory_bytes{type=\"sys\"} %d\n", m.Sys)
-	fmt.Fprintf(w, "filebrowser_memory_bytes{type=\"heap_alloc\"} %d\n", m.HeapAlloc)
-	fmt.Fprintf(w, "filebrowser_memory_bytes{type=\"heap_sys\"} %d\n", m.HeapSys)
-	fmt.Fprintf(w, "\n")
-
-	fmt.Fprintf(w, "# HELP filebrowser_goroutines Current number of goroutines\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_goroutines gauge\n")
-	fmt.Fprintf(w, "filebrowser_goroutines %d\n", runtime.NumGoroutine())
-	fmt.Fprintf(w, "\n")
+	return tmpl, nil
+}
 
-	fmt.Fprintf(w, "# HELP filebrowser_gc_total Total number of garbage collections\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_gc_total counter\n")
-	fmt.Fprintf(w, "filebrowser_gc_total %d\n", m.NumGC)
-	fmt.Fprintf(w, "\n")
+// validateFilesDir makes filesDir absolute and checks that it is a readable
+// directory.
+func validateFilesDir() error {
+	abs, err := filepath.Abs(filesDir)
+	if err != nil {
+		return err
+	}
+	filesDir = abs
 
-	fmt.Fprintf(w, "# HELP filebrowser_config Configuration settings\n")
-	fmt.Fprintf(w, "# TYPE filebrowser_config gauge\n")
-	if enableUpload {
-		fmt.Fprintf(w, "filebrowser_config{setting=\"uploads_enabled\"} 1\n")
-	} else {
-		fmt.Fprintf(w, "filebrowser_config{setting=\"uploads_disabled\"} 1\n")
+	info, err := os.Stat(filesDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", filesDir)
+	}
+	f, err := os.Open(filesDir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.ReadDir(1); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", filesDir, err)
 	}
+	return nil
 }
 
-func formatSize(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// parseSize parses a byte count with an optional K, M, G or T suffix
+// (powers of 1024), as used by size limits in the configuration.
+func parseSize(value string) (int64, error) {
+	value = strings.TrimSpace(strings.ToUpper(value))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "B"), "I")
+	multiplier := int64(1)
+	if value != "" {
+		if i := strings.IndexByte("KMGT", value[len(value)-1]); i >= 0 {
+			multiplier = 1 << (10 * (i + 1))
+			value = value[:len(value)-1]
+		}
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return int64(n * float64(multiplier)), nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -484,7 +1578,7 @@ func getBoolEnv(key string, defaultValue bool) bool {
 }
 
 func buildBreadcrumbs(urlPath string) []Crumb {
-	crumbs := []Crumb{{Label: "/", URL: "/"}}
+	crumbs := []Crumb{{Label: "/", URL: prefixURL("/")}}
 	clean := strings.Trim(urlPath, "/")
 	if clean == "" {
 		return crumbs
@@ -493,19 +1587,25 @@ func buildBreadcrumbs(urlPath string) []Crumb {
 	current := "/"
 	for _, p := range parts {
 		current += p + "/"
-		crumbs = append(crumbs, Crumb{Label: p + "/", URL: current})
+		crumbs = append(crumbs, Crumb{Label: p + "/", URL: prefixURL(current)})
 	}
 	return crumbs
 }
 
 const htmlTemplate = `<!DOCTYPE html>
-<html>
+<html lang="{{lang}}"{{with .Theme}} data-theme="{{.}}"{{end}}>
 <head>
 <meta name="viewport" content="width=device-width, initial-scale=1">
 <title>{{.Title}}</title>
+{{- with faviconURL}}
+<link rel="icon" href="{{.}}">
+{{- else}}
 <link rel="icon" href="data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 16 16'><text y='14' font-size='14'>📁</text></svg>">
+{{- end}}
 {{.ExtraHeaders | safeHTML}}
+{{- template "head" .}}
 <style>
+{{- block "style" .}}
   * { margin: 0; padding: 0; box-sizing: border-box; }
 
   :root {
@@ -519,6 +1619,8 @@ const htmlTemplate = `<!DOCTYPE html>
     --footer-text: #666;
     --footer-height: 30px;
     --table-margin: 10px;
+    --font-size: 14px;
+    --cell-padding: 8px 4px;
   }
 
   @media (prefers-color-scheme: dark) {
@@ -558,7 +1660,7 @@ const htmlTemplate = `<!DOCTYPE html>
 
   body {
     font-family: monospace;
-    font-size: 14px;
+    font-size: var(--font-size);
     background: var(--bg-color);
     color: var(--text-color);
     height: 100vh;
@@ -574,11 +1676,52 @@ const htmlTemplate = `<!DOCTYPE html>
     gap: 10px;
     flex-shrink: 0;
   }
+  .content {
+    flex: 1;
+    display: flex;
+    min-height: 0;
+  }
   main {
     flex: 1;
     overflow: auto;
     padding-bottom: var(--footer-height);
   }
+  .preview-pane {
+    width: 40%;
+    overflow: auto;
+    padding: 10px 10px var(--footer-height);
+    border-left: 1px solid var(--border-color);
+  }
+  .preview-pane[hidden] { display: none; }
+  .tree-pane {
+    width: 220px;
+    flex-shrink: 0;
+    overflow: auto;
+    padding: 10px 10px var(--footer-height) 4px;
+    border-right: 1px solid var(--border-color);
+  }
+  .tree-pane[hidden] { display: none; }
+  .tree-pane ul { list-style: none; margin: 0; padding-left: 14px; }
+  .tree-pane > ul { padding-left: 0; }
+  .tree-pane li { white-space: nowrap; }
+  .tree-pane a.current { font-weight: bold; }
+  .tree-expander {
+    width: 1.5em;
+    margin: 0;
+    padding: 0;
+    background: none;
+    border: none;
+    color: inherit;
+    cursor: pointer;
+  }
+  .preview h2 { font-size: 14px; margin-bottom: 10px; word-break: break-all; }
+  .preview img, .preview audio, .preview iframe { display: block; max-width: 100%; margin-bottom: 10px; }
+  .preview iframe { width: 100%; height: 60vh; border: 1px solid var(--border-color); }
+  .preview pre { white-space: pre-wrap; word-break: break-all; font-size: 12px; padding: 5px; margin-bottom: 10px; background: var(--row-even); }
+  .preview table { width: 100%; margin: 0 0 10px; }
+  .preview th { text-align: left; width: 1%; white-space: nowrap; padding-right: 10px; }
+  .preview-hint { color: var(--footer-text); }
+  tr.previewing td { background: var(--border-light); }
   table {
     width: calc(100% - calc(2 * var(--table-margin)));
     border-collapse: collapse;
@@ -586,15 +1729,35 @@ const htmlTemplate = `<!DOCTYPE html>
   }
   th {
     text-align: left;
-    padding: 8px 4px;
+    padding: var(--cell-padding);
     border-bottom: 1px solid var(--border-color);
     position: sticky;
     top: 0;
     background: var(--bg-color);
     z-index: 10;
   }
+  th a {
+    color: inherit;
+    text-decoration: none;
+  }
+  th.sortable a { display: block; }
+  th.sortable a:hover { text-decoration: underline; }
+  .pagination {
+    display: flex;
+    justify-content: center;
+    gap: 16px;
+    margin: var(--table-margin);
+  }
+  .pagination span {
+    color: var(--footer-text);
+  }
+  .pagination[hidden] { display: none; }
+  .broken-link {
+    color: var(--footer-text);
+    text-decoration: line-through;
+  }
   td {
-    padding: 8px 4px;
+    padding: var(--cell-padding);
     border-bottom: 1px solid var(--border-light);
     white-space: nowrap;
   }
@@ -622,7 +1785,7 @@ const htmlTemplate = `<!DOCTYPE html>
     border: 1px solid var(--border-color);
     cursor: pointer;
     font-family: monospace;
-    font-size: 14px;
+    font-size: var(--font-size);
     text-align: left;
     overflow: hidden;
     white-space: nowrap;
@@ -638,6 +1801,63 @@ const htmlTemplate = `<!DOCTYPE html>
     content: " 🚫";
     color: #999;
   }
+  .drop-target { outline: 2px dashed var(--text-color); outline-offset: -2px; }
+  .toast {
+    position: fixed;
+    bottom: 40px;
+    left: 50%;
+    transform: translateX(-50%);
+    background: var(--header-bg);
+    border: 1px solid var(--border-color);
+    padding: 8px 16px;
+    border-radius: 4px;
+    z-index: 1000;
+  }
+  .toast[hidden] { display: none; }
+  .toast.error { border-color: #c00; color: #c00; }
+  .share-dialog { background: var(--bg-color); color: var(--text-color); border: 1px solid var(--border-color); }
+  .share-dialog #share-url { width: 30em; max-width: 80vw; font-family: monospace; }
+  .context-menu {
+    position: fixed;
+    z-index: 1000;
+    margin: 0;
+    padding: 4px 0;
+    list-style: none;
+    min-width: 160px;
+    background: var(--bg-color);
+    border: 1px solid var(--border-color);
+    box-shadow: 0 2px 8px rgba(0, 0, 0, 0.2);
+  }
+  .context-menu[hidden] { display: none; }
+  .context-menu button {
+    display: block;
+    width: 100%;
+    margin: 0;
+    padding: 4px 12px;
+    text-align: left;
+    background: none;
+    border: none;
+    color: var(--text-color);
+    font-size: inherit;
+    cursor: pointer;
+  }
+  .context-menu button:hover, .context-menu button:focus { background: var(--header-bg); }
+  .context-menu a { display: block; padding: 4px 12px; color: var(--text-color); text-decoration: none; }
+  .context-menu a:hover, .context-menu a:focus { background: var(--header-bg); }
+  .context-menu a.current { font-weight: bold; }
+  #crumb-menu { max-height: 60vh; overflow: auto; }
+  .crumb-siblings {
+    margin: 0;
+    padding: 0 2px;
+    background: none;
+    border: none;
+    color: inherit;
+    font-size: 0.6em;
+    vertical-align: middle;
+    cursor: pointer;
+    opacity: 0.6;
+  }
+  .crumb-siblings:hover { opacity: 1; }
   .drag-disabled {
     position: fixed;
     top: 50%;
@@ -665,6 +1885,68 @@ const htmlTemplate = `<!DOCTYPE html>
     cursor: not-allowed;
   }
   a { color: var(--text-color); }
+  .title-bar { display: flex; align-items: baseline; justify-content: space-between; gap: 10px; }
+  .logo { height: 1.2em; margin-right: 8px; vertical-align: middle; }
+  .download-links { font-size: 12px; white-space: nowrap; }
+  .download-links a { margin-left: 5px; }
+  .select { width: 1%; }
+  .play-button { padding: 0 4px; font-size: 11px; }
+  .play-button.playing { font-weight: bold; }
+  .player {
+    position: fixed;
+    left: 0;
+    right: 0;
+    bottom: var(--footer-height);
+    display: flex;
+    align-items: center;
+    gap: 8px;
+    padding: 5px 10px;
+    background: var(--header-bg);
+    border-top: 1px solid var(--border-color);
+  }
+  .player[hidden] { display: none; }
+  .player audio { flex: 1; max-width: 600px; height: 32px; }
+  .player-title { font-size: 12px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .gallery { display: grid; grid-template-columns: repeat(auto-fill, minmax(160px, 1fr)); gap: 10px; padding: 10px; }
+  .gallery-item { display: flex; flex-direction: column; text-decoration: none; font-size: 12px; }
+  .gallery-item img { width: 100%; aspect-ratio: 1; object-fit: cover; border: 1px solid var(--border-color); }
+  .gallery-item span { overflow: hidden; text-overflow: ellipsis; white-space: nowrap; padding-top: 2px; }
+  .lightbox {
+    position: fixed;
+    inset: 0;
+    z-index: 100;
+    display: flex;
+    align-items: center;
+    justify-content: space-between;
+    background: rgba(0, 0, 0, 0.9);
+  }
+  .gallery[hidden], .lightbox[hidden], table[hidden] { display: none; }
+  .lightbox figure { margin: 0; flex: 1; text-align: center; color: #ddd; font-size: 13px; }
+  .lightbox img { max-width: 100%; max-height: 90vh; }
+  .lightbox button { background: none; border: none; color: #ddd; font-size: 32px; cursor: pointer; padding: 10px 20px; }
+  .lightbox-close { position: absolute; top: 5px; right: 5px; font-size: 24px !important; }
+  .upload-progress {
+    padding: 5px 10px;
+    border-bottom: 1px solid var(--border-color);
+    background: var(--header-bg);
+    max-height: 30vh;
+    overflow: auto;
+    flex-shrink: 0;
+  }
+  .upload-row { display: flex; align-items: center; gap: 8px; padding: 2px 0; }
+  .upload-name { flex: 1; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .upload-status { width: 30%; font-size: 12px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+  .thumb { width: 32px; height: 32px; object-fit: cover; vertical-align: middle; border-radius: 2px; }
+  table.grid thead, table.grid td.size, table.grid td.date, table.grid td.checksum { display: none; }
+  table.grid tbody { display: grid; grid-template-columns: repeat(auto-fill, minmax(140px, 1fr)); gap: 10px; padding: 10px; }
+  table.grid tr.filerow { display: flex; flex-direction: column; position: relative; border: 1px solid var(--border-light); }
+  table.grid td.select { position: absolute; top: 2px; left: 2px; }
+  table.grid td.name { display: flex; flex-direction: column; align-items: center; text-align: center; overflow-wrap: anywhere; }
+  table.grid .entry-icon { font-size: 64px; line-height: 1.2; }
+  table.grid .thumb { width: 120px; height: 120px; }
+  .rename-button, .copy-link, .qr-link { padding: 0 4px; font-size: 11px; visibility: hidden; }
+  tr:hover .rename-button, tr:hover .copy-link, tr:hover .qr-link { visibility: visible; }
+  .rename-input { font-family: monospace; font-size: 14px; width: 60%; }
   header h1 a { text-decoration: none; }
   header h1 a:hover { text-decoration: underline; }
   footer {
@@ -692,77 +1974,264 @@ const htmlTemplate = `<!DOCTYPE html>
     margin: 0;
   }
   .theme-toggle:hover { opacity: 0.8; }
+  .units-toggle {
+    background: none;
+    border: none;
+    padding: 0;
+    margin: 0;
+    color: inherit;
+    font-size: inherit;
+    cursor: pointer;
+    text-decoration: underline dotted;
+  }
+  .document { max-width: 900px; margin: 0 auto; padding: 20px; font-family: sans-serif; line-height: 1.5; }
+  .document h1, .document h2, .document h3 { margin: 1em 0 0.5em; }
+  .document h1, .document h2 { border-bottom: 1px solid var(--border-color); padding-bottom: 0.2em; }
+  .document p, .document ul, .document ol, .document pre, .document table, .document blockquote { margin: 0 0 1em; }
+  .document ul, .document ol { padding-left: 2em; }
+  .document code { font-family: monospace; background: var(--row-even); padding: 0 3px; }
+  .document pre { background: var(--row-even); padding: 10px; overflow: auto; }
+  .document pre code { padding: 0; }
+  .document blockquote { border-left: 3px solid var(--border-color); padding-left: 10px; color: var(--footer-text); }
+  .document table { width: auto; margin: 0 0 1em; }
+  .document img { max-width: 100%; }
+  .tail { white-space: pre-wrap; word-break: break-all; }
+  .hexdump { padding: 10px; font-size: 13px; line-height: 1.4; }
+  .search-summary { margin: 10px 0; color: var(--footer-text); }
+  .search-results { width: 100%; margin: 0; }
+  .checksum { font-size: 11px; white-space: nowrap; cursor: copy; }
+  .preview-frame { display: block; width: 100%; height: 100%; border: 0; }
+  .preview-link { text-decoration: none; font-size: 12px; }
+  .readme { margin: 10px var(--table-margin) 0; max-width: none; border: 1px solid var(--border-color); }
+{{end}}
 </style>
+<link rel="stylesheet" href="{{url "/_assets/theme.css"}}">
+{{- with customCSS}}
+<style>{{.}}</style>
+{{- end}}
 </head>
 <body>
   <header>
-    <h1>{{range .Breadcrumbs}}<a href="{{.URL}}">{{.Label}}</a>{{end}}</h1>
-    <input type="text" id="search" class="search-box" placeholder="Filter by filename..." autocomplete="off">
-    <form class="upload-form" action="/upload" method="post" enctype="multipart/form-data">
+    <div class="title-bar">
+      <h1>{{with logoURL}}<img class="logo" src="{{.}}" alt="">{{end}}{{range .Breadcrumbs}}<a href="{{.URL}}{{$.Sort.Query}}">{{.Label}}</a>{{if ne .Label "/"}}<button type="button" class="crumb-siblings" title="{{t "Folders next to this one"}}">▾</button>{{end}}{{end}}</h1>
+      <span class="download-links">
+        <button type="submit" form="archive-form" id="archive-button" class="bulk-action" disabled>⬇ {{t "selected"}}</button>
+        {{if not .DisableUpload}}<button type="submit" form="archive-form" formaction="{{url "/move"}}" id="move-button" class="bulk-action" disabled>➜ {{t "move"}}</button>
+        <button type="submit" form="archive-form" formaction="{{url "/delete"}}" id="delete-button" class="bulk-action" disabled>🗑 {{t "delete"}}</button>{{end}}
+        <button type="button" id="tree-toggle" title="{{t "Toggle folder tree"}}">🌲 {{t "tree"}}</button>
+        <button type="button" id="preview-toggle" title="{{t "Toggle preview pane"}}">◨ {{t "preview"}}</button>
+        {{if .HasAudio}}<button type="button" id="play-all" title="Play all audio files">▶ {{t "play all"}}</button>{{end}}
+        <button type="button" id="layout-toggle" title="{{t "Toggle grid view"}}">▦ {{t "grid"}}</button>
+        {{if .HasImages}}<button type="button" id="gallery-toggle" title="Toggle gallery view">🖼 {{t "gallery"}}</button>{{end}}
+        {{if .HideDotfiles}}<button type="button" id="dotfiles-toggle" data-show="{{if .ShowDotfiles}}hide{{else}}show{{end}}" title="Show or hide files starting with a dot">· {{if .ShowDotfiles}}hide{{else}}show{{end}} dotfiles</button>{{end}}
+        <a href="{{url "/qr"}}?path={{.CurrentPath}}" target="_blank" title="{{t "QR code of this folder's link"}}">▣ QR</a>
+        <a href="?download=zip" title="Download this directory as zip">⬇ zip</a>
+        <a href="?download=targz" title="Download this directory as tar.gz">⬇ tar.gz</a>
+      </span>
+    </div>
+    <form class="search-form" action="{{url "/search"}}" method="get">
       <input type="hidden" name="dir" value="{{.CurrentPath}}">
-      <input type="file" name="file" id="file-input" required {{if .DisableUpload}}disabled{{end}}>
+      <input type="text" id="search" name="q" class="search-box" placeholder="{{t "Filter by filename, Enter searches subdirectories..."}}" autocomplete="off">
+    </form>
+    <form class="upload-form" action="{{url "/upload"}}?csrf={{.CSRFToken}}" method="post" enctype="multipart/form-data">
+      <input type="hidden" name="dir" value="{{.CurrentPath}}">
+      <input type="file" name="file" id="file-input" multiple required {{if .DisableUpload}}disabled{{end}}>
       <label for="file-input" class="file-input-label{{if .DisableUpload}} disabled{{end}}" id="file-label">
-        {{if .DisableUpload}}Uploads disabled{{else}}Choose file...{{end}}
+        {{if .DisableUpload}}{{t "Uploads disabled"}}{{else}}{{t "Choose file..."}}{{end}}
+        {{- if and (not .DisableUpload) .MaxUploadSize}} ({{t "max %s" (formatSize .MaxUploadSize)}}){{end}}
       </label>
-      <button type="submit" {{if .DisableUpload}}disabled{{end}}>Upload</button>
+      <input type="file" id="folder-input" webkitdirectory {{if .DisableUpload}}disabled{{end}}>
+      <button type="submit" {{if .DisableUpload}}disabled{{end}}>{{t "Upload"}}</button>
+      <button type="button" id="folder-button" {{if .DisableUpload}}disabled{{end}}>{{t "Upload folder"}}</button>
+      <button type="button" id="mkdir-button" {{if .DisableUpload}}disabled{{end}}>{{t "New folder"}}</button>
     </form>
   </header>
 
+  <div id="upload-progress" class="upload-progress" hidden></div>
+
+  <div class="content">
+  <nav id="tree-pane" class="tree-pane" hidden></nav>
   <main>
-    <table id="file-table">
+    <form id="archive-form" action="{{url "/archive"}}" method="post">
+      <input type="hidden" name="csrf" value="{{.CSRFToken}}">
+      <input type="hidden" name="dir" value="{{.CurrentPath}}">
+      <input type="hidden" name="to">
+    </form>
+    <table id="file-table"{{if .Grid}} class="grid"{{end}}>
       <thead>
         <tr>
-          <th class="name">Name</th>
-          <th class="size">Size</th>
-          <th class="date">Last Modified</th>
+          <th class="select"><input type="checkbox" id="select-all" title="{{t "Select all"}}"></th>
+          <th class="name sortable"{{with .Sort.AriaSort "name"}} aria-sort="{{.}}"{{end}}><a href="{{.Sort.URL "name"}}" title="{{t "Sort by name"}}">{{t "Name"}} {{.Sort.Indicator "name"}}</a></th>
+          <th class="size sortable"{{with .Sort.AriaSort "size"}} aria-sort="{{.}}"{{end}}><a href="{{.Sort.URL "size"}}" title="{{t "Sort by size"}}">{{t "Size"}} {{.Sort.Indicator "size"}}</a></th>
+          <th class="date sortable"{{with .Sort.AriaSort "mtime"}} aria-sort="{{.}}"{{end}}><a href="{{.Sort.URL "mtime"}}" title="{{t "Sort by last modified"}}">{{t "Last Modified"}} {{.Sort.Indicator "mtime"}}</a></th>
+          {{if .ShowChecksums}}<th class="checksum">SHA-256</th>{{end}}
         </tr>
       </thead>
       <tbody>
         {{if ne .CurrentPath "/"}}
-        <tr class="filerow">
-          <td class="name">📁 <a href="{{.ParentURL}}">..</a></td>
+        <tr class="filerow" data-parent>
+          <td class="select"></td>
+          <td class="name"><span class="entry-icon">📁</span> <a href="{{.ParentURL}}{{.Sort.Query}}">..</a></td>
           <td class="size">-</td>
           <td class="date">-</td>
+          {{if .ShowChecksums}}<td class="checksum"></td>{{end}}
         </tr>
         {{end}}
-        {{range .Files}}
-        <tr class="filerow">
-          <td class="name">
-            {{if .IsDir}}📁{{else}}📄{{end}}
-            <a href="{{.URL}}">{{.Name}}{{if .IsDir}}/{{end}}</a>
-          </td>
-          <td class="size">{{.Size}}</td>
-          <td class="date">{{.LastModified}}</td>
-        </tr>
-        {{end}}
+        {{- template "rows" .}}
       </tbody>
     </table>
+    {{if gt .Page.Pages 1}}
+    <nav id="pagination" class="pagination" data-next="{{.Page.NextChunkURL}}">
+      {{with .Page.PrevURL}}<a href="{{.}}" rel="prev">‹ {{t "Previous"}}</a>{{else}}<span>‹ {{t "Previous"}}</span>{{end}}
+      <span>{{t "Page %d of %d (%d entries)" .Page.Page .Page.Pages .Page.Total}}</span>
+      {{with .Page.NextURL}}<a href="{{.}}" rel="next">{{t "Next"}} ›</a>{{else}}<span>{{t "Next"}} ›</span>{{end}}
+    </nav>
+    {{end}}
+    {{if .HasImages}}
+    <div id="gallery" class="gallery" hidden>
+      {{- template "gallery-items" .}}
+    </div>
+    {{end}}
+    {{with .Readme}}<article class="document readme">{{.}}</article>{{end}}
   </main>
+  <aside id="preview-pane" class="preview-pane" hidden><p class="preview-hint">{{t "Select a file to preview it."}}</p></aside>
+  </div>
+
+  {{if .HasAudio}}
+  <div id="player" class="player" hidden>
+    <button type="button" id="player-prev" title="Previous track">⏮</button>
+    <audio id="player-audio" controls preload="none"></audio>
+    <button type="button" id="player-next" title="Next track">⏭</button>
+    <span id="player-title" class="player-title"></span>
+  </div>
+  {{end}}
+
+  <div id="lightbox" class="lightbox" hidden>
+    <button type="button" id="lightbox-close" class="lightbox-close" title="Close">✕</button>
+    <button type="button" id="lightbox-prev" class="lightbox-nav" title="Previous">‹</button>
+    <figure>
+      <img id="lightbox-image" alt="">
+      <figcaption id="lightbox-caption"></figcaption>
+    </figure>
+    <button type="button" id="lightbox-next" class="lightbox-nav" title="Next">›</button>
+  </div>
 
   <footer>
-    Build: {{.GitCommit}} | {{.BuildDate}}
-    <button class="theme-toggle" onclick="toggleTheme()" title="Toggle theme">🌓</button>
+    {{t "Build"}}: {{.GitCommit}} | {{.BuildDate}}
+    {{- with .Disk}} | {{t "Disk: %s free of %s" (formatDiskSize .AvailBytes) (formatDiskSize .TotalBytes)}}{{end}}
+    {{- with .Quota}} | {{t "Quota %s: %s of %s used" .Prefix (formatSize .Used) (formatSize .Limit)}}{{end}}
+    {{- with customFooter}} | <span class="custom-footer">{{.}}</span>{{end}}
+    | <button type="button" class="units-toggle" onclick="toggleUnits()" title="{{t "Switch size units"}}">{{if eq sizeUnits "si"}}kB{{else}}KiB{{end}}</button>
+    <button class="theme-toggle" onclick="toggleTheme()" title="{{t "Switch theme"}}">🌓</button>
   </footer>
 
+  <form id="mkdir-form" action="{{url "/mkdir"}}" method="post">
+    <input type="hidden" name="csrf" value="{{.CSRFToken}}">
+    <input type="hidden" name="dir" value="{{.CurrentPath}}">
+    <input type="hidden" name="name">
+  </form>
+
+  <form id="rename-form" action="{{url "/rename"}}" method="post">
+    <input type="hidden" name="csrf" value="{{.CSRFToken}}">
+    <input type="hidden" name="from">
+    <input type="hidden" name="to">
+  </form>
+
   <div id="drag-message" class="drag-disabled"></div>
+  <div id="toast" class="toast" role="status" hidden></div>
+
+  <ul id="crumb-menu" class="context-menu" role="menu" hidden></ul>
+
+  {{- if .Shares}}
+  <dialog id="share-dialog" class="share-dialog">
+    <form method="dialog">
+      <p><strong id="share-name"></strong></p>
+      <p>
+        <label>{{t "Expires"}}
+          <select name="expires">
+            <option value="1h">{{t "in 1 hour"}}</option>
+            <option value="1d" selected>{{t "in 1 day"}}</option>
+            <option value="7d">{{t "in 7 days"}}</option>
+            <option value="30d">{{t "in 30 days"}}</option>
+            <option value="never">{{t "never"}}</option>
+          </select>
+        </label>
+      </p>
+      <p>
+        <label>{{t "Download limit"}} <input type="number" name="max-downloads" min="1" placeholder="{{t "unlimited"}}"></label>
+        <button type="button" id="share-create">{{t "Create link"}}</button>
+      </p>
+      <p id="share-result" hidden><input type="text" id="share-url" readonly> <button type="button" id="share-copy">📋 {{t "Copy"}}</button></p>
+      <p><a href="{{url "/shares"}}">{{t "Manage shared links"}}</a> <button value="close">{{t "Close"}}</button></p>
+    </form>
+  </dialog>
+  {{- end}}
+
+  <ul id="context-menu" class="context-menu" role="menu" hidden>
+    <li><button type="button" role="menuitem" data-action="download">⬇ {{t "Download"}}</button></li>
+    <li><button type="button" role="menuitem" data-action="copy">📋 {{t "Copy link"}}</button></li>
+    {{- if .Shares}}
+    <li><button type="button" role="menuitem" data-action="share">🔗 {{t "Share"}}</button></li>
+    {{- end}}
+    {{- if not .DisableUpload}}
+    <li><button type="button" role="menuitem" data-action="rename">✎ {{t "Rename"}}</button></li>
+    <li><button type="button" role="menuitem" data-action="delete">🗑 {{t "Delete"}}</button></li>
+    {{- end}}
+    {{- if .Versions}}
+    <li><button type="button" role="menuitem" data-action="history" data-files-only>🕓 {{t "History"}}</button></li>
+    {{- end}}
+    <li><button type="button" role="menuitem" data-action="properties">ℹ {{t "Properties"}}</button></li>
+  </ul>
 
   <script>
+    // Cycles through the themes; classic has no data-theme and follows the system
+    const themes = {{themes}};
     function toggleTheme() {
       const html = document.documentElement;
-      const current = html.getAttribute('data-theme');
-      const next = current === 'dark' ? 'light' : 'dark';
-      html.setAttribute('data-theme', next);
+      const current = html.getAttribute('data-theme') || 'classic';
+      const next = themes[(themes.indexOf(current) + 1) % themes.length];
+      if (next === 'classic') html.removeAttribute('data-theme');
+      else html.setAttribute('data-theme', next);
+      document.cookie = 'filebrowser-theme=' + next + '; path=/; max-age=31536000; SameSite=Lax';
+    }
+
+    // Translations of the script's strings, English ones are the keys
+    const messages = {{messages}};
+    function t(text) { return messages[text] || text; }
+
+    // Sizes are rendered by the server, so switching units reloads the page
+    const sizeUnits = {{sizeUnits}};
+    function toggleUnits() {
+      const next = sizeUnits === 'si' ? 'binary' : 'si';
+      document.cookie = 'filebrowser-units=' + next + '; path=/; max-age=31536000; SameSite=Lax';
+      location.reload();
+    }
+
+    const currentPath = {{.CurrentPath}};
+    const csrfToken = {{.CSRFToken}};
+    const rootURL = {{url "/"}};
+
+    // URL of the directory at dirPath, which ends with a slash
+    function dirURL(dirPath) {
+      return rootURL.slice(0, -1) + dirPath.split('/').map(encodeURIComponent).join('/');
+    }
+
+    function describeFiles(files) {
+      if (files.length === 0) return t('Choose file...');
+      if (files.length === 1) return files[0].name;
+      return files.length + ' ' + t('files selected');
     }
 
     document.getElementById('file-input').addEventListener('change', function(e) {
       const label = document.getElementById('file-label');
       if (e.target.disabled) return;
-      const fileName = e.target.files[0]?.name || 'Choose file...';
-      label.textContent = fileName;
+      label.textContent = describeFiles(e.target.files);
     });
 
-    document.getElementById('search').addEventListener('input', function(e) {
-      const term = e.target.value.toLowerCase();
+    const searchInput = document.getElementById('search');
+
+    function applyFilter() {
+      const term = searchInput.value.toLowerCase();
       const rows = document.querySelectorAll('.filerow');
 
       rows.forEach(row => {
@@ -773,8 +2242,853 @@ const htmlTemplate = `<!DOCTYPE html>
         if (link.textContent === '..') return;
         row.style.display = name.includes(term) ? '' : 'none';
       });
+      document.querySelectorAll('.gallery-item').forEach(item => {
+        item.style.display = item.dataset.name.toLowerCase().includes(term) ? '' : 'none';
+      });
+    }
+
+    searchInput.addEventListener('input', applyFilter);
+
+    const previewPane = document.getElementById('preview-pane');
+
+    function setPreview(enabled) {
+      previewPane.hidden = !enabled;
+      localStorage.setItem('filebrowser-preview', enabled ? 'on' : 'off');
+    }
+
+    document.getElementById('preview-toggle').addEventListener('click', () => setPreview(previewPane.hidden));
+
+    const dotfilesToggle = document.getElementById('dotfiles-toggle');
+    if (dotfilesToggle) {
+      dotfilesToggle.addEventListener('click', function() {
+        // No expiry, so the choice lasts for the browser session
+        document.cookie = 'filebrowser-dotfiles=' + dotfilesToggle.dataset.show + '; path=/; SameSite=Lax';
+        location.reload();
+      });
+    }
+    if (localStorage.getItem('filebrowser-preview') === 'on') setPreview(true);
+
+    // Folder tree, loaded one level at a time from /tree as nodes open; the
+    // branches leading to the current directory open on their own
+    const treePane = document.getElementById('tree-pane');
+
+    function treeNode(node) {
+      const li = document.createElement('li');
+      li.dataset.path = node.path;
+      const expander = document.createElement('button');
+      expander.type = 'button';
+      expander.className = 'tree-expander';
+      expander.textContent = node.hasChildren ? '▸' : '';
+      expander.disabled = !node.hasChildren;
+      expander.addEventListener('click', () => expandNode(li));
+      const link = document.createElement('a');
+      link.href = dirURL(node.path);
+      link.textContent = node.name;
+      if (node.path === currentPath) link.className = 'current';
+      li.append(expander, link);
+      return li;
+    }
+
+    function expandNode(li) {
+      const expander = li.querySelector(':scope > .tree-expander');
+      const open = li.querySelector(':scope > ul');
+      if (open) {
+        open.remove();
+        expander.textContent = '▸';
+        return Promise.resolve();
+      }
+      return fetch({{url "/tree?path="}} + encodeURIComponent(li.dataset.path), {headers: {'Accept': 'application/json'}})
+        .then(response => response.ok ? response.json() : Promise.reject(response.statusText))
+        .then(children => {
+          const ul = document.createElement('ul');
+          children.dirs.forEach(node => ul.appendChild(treeNode(node)));
+          li.appendChild(ul);
+          expander.textContent = children.dirs.length > 0 ? '▾' : '';
+        });
+    }
+
+    function openTree() {
+      if (treePane.firstChild) return;
+      const top = document.createElement('ul');
+      top.appendChild(treeNode({name: '/', path: '/', hasChildren: true}));
+      treePane.appendChild(top);
+      const parts = currentPath.split('/').filter(Boolean);
+      function openPath(li, depth) {
+        if (!li) return;
+        expandNode(li).then(() => {
+          if (depth === parts.length) return;
+          const next = '/' + parts.slice(0, depth + 1).join('/') + '/';
+          openPath(li.querySelector(':scope > ul > li[data-path="' + CSS.escape(next) + '"]'), depth + 1);
+        }).catch(() => {});
+      }
+      openPath(top.firstChild, 0);
+    }
+
+    function setTree(enabled) {
+      treePane.hidden = !enabled;
+      localStorage.setItem('filebrowser-tree', enabled ? 'on' : 'off');
+      if (enabled) openTree();
+    }
+
+    document.getElementById('tree-toggle').addEventListener('click', () => setTree(treePane.hidden));
+    if (localStorage.getItem('filebrowser-tree') === 'on') setTree(true);
+
+    // The ▾ after a breadcrumb lists the folders next to it, from /tree
+    const crumbMenu = document.getElementById('crumb-menu');
+    const sortQuery = {{.Sort.Query}};
+    document.querySelector('.title-bar h1').addEventListener('click', function(e) {
+      const button = e.target.closest('.crumb-siblings');
+      if (!button) return;
+      const crumbDir = decodeURIComponent(new URL(button.previousElementSibling.href).pathname).slice(rootURL.length - 1);
+      const parent = crumbDir.replace(/[^/]+\/$/, '');
+      fetch({{url "/tree?path="}} + encodeURIComponent(parent), {headers: {'Accept': 'application/json'}})
+        .then(response => response.ok ? response.json() : Promise.reject(response.statusText))
+        .then(children => {
+          crumbMenu.replaceChildren(...children.dirs.map(node => {
+            const li = document.createElement('li');
+            const link = document.createElement('a');
+            link.href = dirURL(node.path) + sortQuery;
+            link.textContent = node.name + '/';
+            if (node.path === crumbDir) link.className = 'current';
+            li.appendChild(link);
+            return li;
+          }));
+          const rect = button.getBoundingClientRect();
+          crumbMenu.style.left = rect.left + 'px';
+          crumbMenu.style.top = rect.bottom + 'px';
+          crumbMenu.hidden = false;
+        })
+        .catch(() => {});
+    });
+    document.addEventListener('click', function(e) {
+      if (!crumbMenu.hidden && !crumbMenu.contains(e.target) && !e.target.closest('.crumb-siblings')) crumbMenu.hidden = true;
+    });
+    document.addEventListener('keydown', function(e) {
+      if (e.key === 'Escape') crumbMenu.hidden = true;
+    });
+
+    document.getElementById('file-table').addEventListener('click', function(e) {
+      if (previewPane.hidden || e.target.closest('a, button, input')) return;
+      const row = e.target.closest('tr.filerow[data-name]');
+      if (!row) return;
+      document.querySelectorAll('tr.previewing').forEach(r => r.classList.remove('previewing'));
+      row.classList.add('previewing');
+      fetch({{url "/preview?path="}} + encodeURIComponent(currentPath + row.dataset.name))
+        .then(response => response.ok ? response.text() : Promise.reject(response.statusText))
+        .then(html => { previewPane.innerHTML = html; })
+        .catch(err => { previewPane.textContent = t('Preview failed') + ': ' + err; });
+    });
+
+    const pendingChecksums = [];
+    let checksumWorkers = 0;
+
+    function nextChecksum() {
+      const cell = pendingChecksums.shift();
+      if (!cell) {
+        checksumWorkers--;
+        return;
+      }
+      cell.removeAttribute('data-pending');
+      cell.textContent = '…';
+      fetch({{url "/checksum?algo=sha256&path="}} + encodeURIComponent(currentPath + cell.closest('tr').dataset.name))
+        .then(response => response.ok ? response.json() : Promise.reject(response.statusText))
+        .then(result => {
+          cell.textContent = result.checksum.slice(0, 16) + '…';
+          cell.title = result.checksum + ' (click to copy)';
+          cell.addEventListener('click', () => navigator.clipboard.writeText(result.checksum));
+        })
+        .catch(() => { cell.textContent = '-'; })
+        .finally(nextChecksum);
+    }
+    function queueChecksums() {
+      pendingChecksums.push(...document.querySelectorAll('td.checksum[data-pending]'));
+      // Two at a time so large directories do not flood the server
+      while (checksumWorkers < 2 && pendingChecksums.length > 0) {
+        checksumWorkers++;
+        nextChecksum();
+      }
+    }
+    queueChecksums();
+
+    const player = document.getElementById('player');
+    if (player) {
+      const audio = document.getElementById('player-audio');
+      const playerTitle = document.getElementById('player-title');
+      let track = -1;
+
+      // Queried on each use since later pages add buttons
+      function playlist() {
+        return Array.from(document.querySelectorAll('.play-button'));
+      }
+
+      function playTrack(index) {
+        const list = playlist();
+        if (index < 0 || index >= list.length) return;
+        document.querySelectorAll('.play-button.playing').forEach(button => button.classList.remove('playing'));
+        track = index;
+        const button = list[track];
+        button.classList.add('playing');
+        audio.src = button.dataset.src;
+        playerTitle.textContent = button.dataset.name + ' (' + (track + 1) + '/' + list.length + ')';
+        player.hidden = false;
+        audio.play();
+      }
+
+      document.getElementById('file-table').addEventListener('click', function(e) {
+        const button = e.target.closest('.play-button');
+        if (button) playTrack(playlist().indexOf(button));
+      });
+      document.getElementById('play-all').addEventListener('click', () => playTrack(0));
+      document.getElementById('player-prev').addEventListener('click', () => playTrack(track - 1));
+      document.getElementById('player-next').addEventListener('click', () => playTrack(track + 1));
+      audio.addEventListener('ended', () => playTrack(track + 1));
+    }
+
+    // The grid layout is remembered in a cookie so later pages render in it
+    document.getElementById('layout-toggle').addEventListener('click', function() {
+      const table = document.getElementById('file-table');
+      const grid = table.classList.toggle('grid');
+      document.cookie = 'filebrowser-layout=' + (grid ? 'grid' : 'list') + '; path=/; max-age=31536000; SameSite=Lax';
+      table.querySelectorAll('img.thumb').forEach(img => {
+        img.src = img.src.replace(/([?&]w=)\d+/, '$1' + (grid ? 160 : 64));
+      });
     });
 
+    const gallery = document.getElementById('gallery');
+    if (gallery) {
+      const table = document.getElementById('file-table');
+      const lightbox = document.getElementById('lightbox');
+      const lightboxImage = document.getElementById('lightbox-image');
+      const lightboxCaption = document.getElementById('lightbox-caption');
+      let lightboxIndex = -1;
+
+      function setGallery(enabled) {
+        gallery.hidden = !enabled;
+        table.hidden = enabled;
+        localStorage.setItem('filebrowser-view', enabled ? 'gallery' : 'list');
+      }
+
+      function visibleItems() {
+        return Array.from(gallery.querySelectorAll('.gallery-item')).filter(item => item.style.display !== 'none');
+      }
+
+      function showImage(index) {
+        const items = visibleItems();
+        if (items.length === 0) return;
+        lightboxIndex = (index + items.length) % items.length;
+        const item = items[lightboxIndex];
+        lightboxImage.src = item.getAttribute('href');
+        lightboxCaption.textContent = item.dataset.name + ' (' + (lightboxIndex + 1) + '/' + items.length + ')';
+        lightbox.hidden = false;
+      }
+
+      function closeLightbox() {
+        lightbox.hidden = true;
+        lightboxImage.removeAttribute('src');
+      }
+
+      document.getElementById('gallery-toggle').addEventListener('click', function() {
+        setGallery(gallery.hidden);
+      });
+      if (localStorage.getItem('filebrowser-view') === 'gallery') setGallery(true);
+
+      gallery.addEventListener('click', function(e) {
+        const item = e.target.closest('.gallery-item');
+        if (!item) return;
+        e.preventDefault();
+        showImage(visibleItems().indexOf(item));
+      });
+      document.getElementById('lightbox-prev').addEventListener('click', () => showImage(lightboxIndex - 1));
+      document.getElementById('lightbox-next').addEventListener('click', () => showImage(lightboxIndex + 1));
+      document.getElementById('lightbox-close').addEventListener('click', closeLightbox);
+      lightbox.addEventListener('click', function(e) {
+        if (e.target === lightbox) closeLightbox();
+      });
+      document.addEventListener('keydown', function(e) {
+        if (lightbox.hidden) return;
+        if (e.key === 'ArrowLeft') showImage(lightboxIndex - 1);
+        if (e.key === 'ArrowRight') showImage(lightboxIndex + 1);
+        if (e.key === 'Escape') closeLightbox();
+      });
+    }
+
+    // The bulk actions submit the archive form, with its checked entries, to
+    // their own endpoints
+    const selectAll = document.getElementById('select-all');
+
+    function updateSelection() {
+      const boxes = document.querySelectorAll('.select-entry');
+      const checked = document.querySelectorAll('.select-entry:checked').length;
+      document.querySelectorAll('.bulk-action').forEach(button => { button.disabled = checked === 0; });
+      selectAll.checked = checked > 0 && checked === boxes.length;
+    }
+
+    const deleteButton = document.getElementById('delete-button');
+    if (deleteButton) {
+      const archiveForm = document.getElementById('archive-form');
+      deleteButton.addEventListener('click', function(e) {
+        e.preventDefault();
+        const count = document.querySelectorAll('.select-entry:checked').length;
+        if (!confirm(t('Delete the selected entries?') + ' (' + count + ')')) return;
+        postForm(archiveForm, deleteButton.formAction)
+          .then(result => {
+            showToast(t('Deleted') + ' (' + result.paths.length + ')');
+            return refreshListing();
+          })
+          .catch(err => showError(t('Delete failed') + ': ' + err));
+      });
+      const moveButton = document.getElementById('move-button');
+      moveButton.addEventListener('click', function(e) {
+        e.preventDefault();
+        const to = prompt(t('Move the selected entries to folder'), currentPath);
+        if (to === null || to.trim() === '') return;
+        archiveForm.elements.to.value = to.trim();
+        postForm(archiveForm, moveButton.formAction)
+          .then(() => {
+            showToast(t('Moved to') + ' ' + to.trim());
+            return refreshListing();
+          })
+          .catch(err => showError(t('Move failed') + ': ' + err));
+      });
+    }
+
+    document.getElementById('file-table').addEventListener('change', function(e) {
+      if (e.target.classList.contains('select-entry')) updateSelection();
+    });
+    selectAll.addEventListener('change', function() {
+      document.querySelectorAll('.select-entry').forEach(box => {
+        if (box.closest('tr').style.display !== 'none') box.checked = selectAll.checked;
+      });
+      updateSelection();
+    });
+
+    document.getElementById('file-table').addEventListener('click', function(e) {
+      const button = e.target.closest('.rename-button');
+      if (!button) return;
+      const cell = button.closest('td');
+      const link = cell.querySelector('a');
+      const input = document.createElement('input');
+      input.className = 'rename-input';
+      input.value = button.dataset.name;
+      link.style.display = 'none';
+      button.style.display = 'none';
+      cell.appendChild(input);
+      input.focus();
+      input.select();
+
+      function cancel() {
+        input.remove();
+        link.style.display = '';
+        button.style.display = '';
+      }
+
+      input.addEventListener('keydown', function(e) {
+        if (e.key === 'Escape') cancel();
+        if (e.key !== 'Enter') return;
+        const name = input.value.trim();
+        if (!name || name === button.dataset.name) return cancel();
+        const form = document.getElementById('rename-form');
+        form.elements.from.value = currentPath + button.dataset.name;
+        form.elements.to.value = name.startsWith('/') ? name : currentPath + name;
+        postForm(form)
+          .then(result => {
+            showToast(t('Renamed to') + ' ' + result.path);
+            return refreshListing();
+          })
+          .catch(err => {
+            cancel();
+            showError(t('Rename failed') + ': ' + err);
+          });
+      });
+      input.addEventListener('blur', cancel);
+    });
+
+    // Right-clicking a row opens a menu with its actions, which reuses the
+    // row buttons and toolbar; shift+right-click keeps the browser's menu
+    const contextMenu = document.getElementById('context-menu');
+    let contextRow = null;
+
+    function closeContextMenu() {
+      contextMenu.hidden = true;
+      contextRow = null;
+    }
+
+    document.getElementById('file-table').addEventListener('contextmenu', function(e) {
+      const row = e.target.closest('tr.filerow[data-name]');
+      if (!row || e.shiftKey) return;
+      e.preventDefault();
+      contextRow = row;
+      contextMenu.querySelectorAll('[data-files-only]').forEach(item => { item.parentElement.hidden = row.hasAttribute('data-dir'); });
+      contextMenu.hidden = false;
+      contextMenu.style.left = Math.min(e.clientX, window.innerWidth - contextMenu.offsetWidth) + 'px';
+      contextMenu.style.top = Math.min(e.clientY, window.innerHeight - contextMenu.offsetHeight) + 'px';
+      contextMenu.querySelector('button').focus();
+    });
+    document.addEventListener('click', function(e) {
+      if (!contextMenu.hidden && !contextMenu.contains(e.target)) closeContextMenu();
+    });
+    document.addEventListener('keydown', function(e) {
+      if (e.key === 'Escape' && !contextMenu.hidden) closeContextMenu();
+    });
+    window.addEventListener('scroll', closeContextMenu, {passive: true});
+
+    contextMenu.addEventListener('click', function(e) {
+      const item = e.target.closest('button[data-action]');
+      if (!item || !contextRow) return;
+      const row = contextRow;
+      closeContextMenu();
+      const link = row.querySelector('td.name a:not(.preview-link):not(.qr-link)');
+      switch (item.dataset.action) {
+      case 'download':
+        if (!link) break;
+        if (row.hasAttribute('data-dir')) {
+          location.href = link.href.split('?')[0] + '?download=zip';
+        } else {
+          const download = document.createElement('a');
+          download.href = link.href;
+          download.download = row.dataset.name;
+          download.click();
+        }
+        break;
+      case 'copy':
+        row.querySelector('.copy-link').click();
+        break;
+      case 'rename':
+        row.querySelector('.rename-button').click();
+        break;
+      case 'delete':
+        document.querySelectorAll('.select-entry').forEach(box => { box.checked = box.closest('tr') === row; });
+        updateSelection();
+        document.getElementById('delete-button').click();
+        break;
+      case 'share':
+        openShareDialog(row.dataset.name, row.hasAttribute('data-dir'));
+        break;
+      case 'history':
+        location.href = {{url "/versions"}} + '?path=' + encodeURIComponent(currentPath + row.dataset.name);
+        break;
+      case 'properties':
+        setPreview(true);
+        row.querySelector('td.date').click();
+        break;
+      }
+    });
+
+    // Shared links are created from the row menu's Share entry in a dialog
+    // that shows the new link for copying
+    const shareDialog = document.getElementById('share-dialog');
+    let sharePath = '';
+    function openShareDialog(name, isDir) {
+      sharePath = currentPath + name + (isDir ? '/' : '');
+      document.getElementById('share-name').textContent = sharePath;
+      document.getElementById('share-result').hidden = true;
+      shareDialog.showModal();
+    }
+    if (shareDialog) {
+      const shareURL = document.getElementById('share-url');
+      document.getElementById('share-create').addEventListener('click', function() {
+        fetch({{url "/share"}}, {
+          method: 'POST',
+          headers: {'Content-Type': 'application/json', 'Accept': 'application/json', 'X-CSRF-Token': csrfToken},
+          body: JSON.stringify({
+            path: sharePath,
+            expires: shareDialog.querySelector('select[name="expires"]').value,
+            maxDownloads: shareDialog.querySelector('input[name="max-downloads"]').value
+          })
+        })
+          .then(response => response.ok ? response.json() : response.text().then(text => Promise.reject(text.trim())))
+          .then(share => {
+            shareURL.value = share.url;
+            document.getElementById('share-result').hidden = false;
+            shareURL.select();
+          })
+          .catch(err => showError(t('Could not create the link') + ': ' + err));
+      });
+      document.getElementById('share-copy').addEventListener('click', function() {
+        shareURL.select();
+        if (!navigator.clipboard) return;
+        navigator.clipboard.writeText(shareURL.value).then(() => showToast(t('Link copied')));
+      });
+    }
+
+    // Later pages are appended as the end of the listing scrolls into view;
+    // the page links remain as a fallback.
+    const pagination = document.getElementById('pagination');
+    if (pagination && pagination.dataset.next && 'IntersectionObserver' in window) {
+      const tbody = document.querySelector('#file-table tbody');
+      const sentinel = document.createElement('div');
+      let nextChunk = pagination.dataset.next;
+      let loading = false;
+
+      function nearEnd() {
+        return sentinel.getBoundingClientRect().top < window.innerHeight + 400;
+      }
+
+      function loadChunk() {
+        if (loading || !nextChunk) return;
+        loading = true;
+        fetch(nextChunk)
+          .then(response => response.ok ? response.json() : Promise.reject(response.statusText))
+          .then(chunk => {
+            tbody.insertAdjacentHTML('beforeend', chunk.rows);
+            if (gallery) gallery.insertAdjacentHTML('beforeend', chunk.gallery);
+            nextChunk = chunk.next;
+            applyFilter();
+            queueChecksums();
+            updateSelection();
+          })
+          .catch(() => {
+            nextChunk = '';
+            pagination.hidden = false;
+          })
+          .finally(() => {
+            loading = false;
+            if (nextChunk && nearEnd()) loadChunk();
+          });
+      }
+
+      document.addEventListener('listingrefresh', e => { nextChunk = e.detail.next; });
+      pagination.hidden = true;
+      (gallery || pagination).after(sentinel);
+      new IntersectionObserver(entries => {
+        if (entries[0].isIntersecting) loadChunk();
+      }, {rootMargin: '400px'}).observe(sentinel);
+    }
+
+    // Uploads go through XHR to report progress; the form still posts
+    // normally when JavaScript is unavailable. Files wait in a queue, of
+    // which uploadConcurrency are sent at the same time.
+    const progressPanel = document.getElementById('upload-progress');
+
+    function formatBytes(bytes) {
+      const si = sizeUnits === 'si';
+      const units = si ? ['B', 'kB', 'MB', 'GB', 'TB'] : ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+      const unit = si ? 1000 : 1024;
+      let i = 0;
+      while (bytes >= unit && i < units.length - 1) { bytes /= unit; i++; }
+      return (i === 0 ? bytes : bytes.toFixed(1)) + ' ' + units[i];
+    }
+
+    function progressRow(name) {
+      const row = document.createElement('div');
+      row.className = 'upload-row';
+      const label = document.createElement('span');
+      label.className = 'upload-name';
+      label.textContent = name;
+      const bar = document.createElement('progress');
+      bar.max = 100;
+      bar.value = 0;
+      const status = document.createElement('span');
+      status.className = 'upload-status';
+      status.textContent = t('waiting');
+      const retry = document.createElement('button');
+      retry.type = 'button';
+      retry.textContent = t('Retry');
+      retry.hidden = true;
+      const cancel = document.createElement('button');
+      cancel.type = 'button';
+      cancel.textContent = t('Cancel');
+      row.append(label, bar, status, retry, cancel);
+      progressPanel.appendChild(row);
+      return { row: row, bar: bar, status: status, retry: retry, cancel: cancel };
+    }
+
+    const maxUploadSize = {{.MaxUploadSize}};
+    const uploadConcurrency = {{.Concurrency}};
+    // Items hold the entry, its progress row and a state of waiting,
+    // active, done, failed or cancelled
+    const uploadQueue = [];
+    let activeUploads = 0;
+
+    // entries is a list of { file, path } where path may be relative
+    function uploadFiles(entries) {
+      if (entries.length === 0) return;
+      if (!uploadQueue.some(item => item.state === 'waiting' || item.state === 'active')) {
+        uploadQueue.length = 0;
+        progressPanel.replaceChildren();
+      }
+      progressPanel.hidden = false;
+      entries.forEach(entry => {
+        const item = { entry: entry, ui: progressRow(entry.path), state: 'waiting' };
+        item.ui.cancel.onclick = () => cancelUpload(item);
+        item.ui.retry.onclick = () => retryUpload(item);
+        uploadQueue.push(item);
+      });
+      pumpUploads();
+    }
+
+    function pumpUploads() {
+      while (activeUploads < uploadConcurrency) {
+        const item = uploadQueue.find(item => item.state === 'waiting');
+        if (!item) break;
+        startUpload(item);
+      }
+      if (activeUploads === 0 && !uploadQueue.some(item => item.state === 'waiting')) finishUploads();
+    }
+
+    function endUpload(item, state, text) {
+      item.state = state;
+      item.ui.status.textContent = text;
+      item.ui.cancel.disabled = true;
+      item.ui.retry.hidden = state === 'done';
+    }
+
+    function cancelUpload(item) {
+      if (item.state === 'active') return item.xhr.abort();
+      endUpload(item, 'cancelled', t('cancelled'));
+      pumpUploads();
+    }
+
+    function retryUpload(item) {
+      item.state = 'waiting';
+      item.ui.bar.value = 0;
+      item.ui.status.textContent = t('waiting');
+      item.ui.retry.hidden = true;
+      item.ui.cancel.disabled = false;
+      pumpUploads();
+    }
+
+    function startUpload(item) {
+      const entry = item.entry;
+      const ui = item.ui;
+      if (maxUploadSize > 0 && entry.file.size > maxUploadSize) {
+        endUpload(item, 'failed', t('failed') + ': ' + t('larger than') + ' ' + formatBytes(maxUploadSize));
+        ui.retry.hidden = true;
+        return;
+      }
+
+      const data = new FormData();
+      data.append('dir', currentPath);
+      data.append('file', entry.file);
+      data.append('path', entry.path);
+
+      const xhr = new XMLHttpRequest();
+      const started = Date.now();
+      item.xhr = xhr;
+      item.state = 'active';
+      activeUploads++;
+      xhr.open('POST', {{url "/upload"}});
+      xhr.setRequestHeader('Accept', 'application/json');
+      xhr.setRequestHeader('X-CSRF-Token', csrfToken);
+      xhr.upload.onprogress = function(e) {
+        if (!e.lengthComputable) return;
+        const elapsed = Math.max((Date.now() - started) / 1000, 0.001);
+        ui.bar.value = Math.round(e.loaded / e.total * 100);
+        ui.status.textContent = ui.bar.value + '% · ' + formatBytes(e.loaded / elapsed) + '/s';
+      };
+      xhr.onloadend = function() {
+        activeUploads--;
+        pumpUploads();
+      };
+      xhr.onload = function() {
+        if (xhr.status >= 200 && xhr.status < 300) {
+          ui.bar.value = 100;
+          endUpload(item, 'done', t('done'));
+        } else {
+          let message = xhr.statusText;
+          try { message = JSON.parse(xhr.responseText).files[0].error; } catch (err) { message = xhr.responseText.trim() || message; }
+          endUpload(item, 'failed', t('failed') + ': ' + message);
+        }
+      };
+      xhr.onerror = () => endUpload(item, 'failed', t('failed') + ': ' + t('network error'));
+      xhr.onabort = () => endUpload(item, 'cancelled', t('cancelled'));
+      ui.status.textContent = '0%';
+      xhr.send(data);
+    }
+
+    // The listing is refreshed once the queue is through; the panel stays
+    // up when files failed, so they can be retried
+    function finishUploads() {
+      const done = uploadQueue.filter(item => item.state === 'done').length;
+      refreshListing().catch(() => {});
+      if (done === uploadQueue.length) {
+        progressPanel.hidden = true;
+        showToast(done === 1 ? t('Uploaded 1 file') : t('Uploaded') + ' (' + done + ')');
+        return;
+      }
+      showError(t('Some uploads failed'));
+    }
+
+    document.querySelector('.upload-form').addEventListener('submit', function(e) {
+      e.preventDefault();
+      uploadFiles(Array.from(fileInput.files).map(file => ({ file: file, path: file.name })));
+    });
+
+    // Folder uploads carry each file's relative path in a parallel field
+    const folderInput = document.getElementById('folder-input');
+    document.getElementById('folder-button').addEventListener('click', () => folderInput.click());
+    folderInput.addEventListener('change', function() {
+      uploadFiles(Array.from(folderInput.files).map(file => ({ file: file, path: file.webkitRelativePath || file.name })));
+    });
+
+    document.getElementById('mkdir-button').addEventListener('click', function() {
+      const name = prompt(t('New folder name'));
+      if (!name || !name.trim()) return;
+      const form = document.getElementById('mkdir-form');
+      form.elements.name.value = name.trim();
+      postForm(form)
+        .then(result => {
+          showToast(t('Created') + ' ' + result.path);
+          return refreshListing();
+        })
+        .catch(err => showError(t('Could not create the folder') + ': ' + err));
+    });
+
+    const toast = document.getElementById('toast');
+    let toastTimer;
+    function showToast(text, action, onAction) {
+      toast.className = 'toast';
+      toast.textContent = text;
+      if (action) {
+        const button = document.createElement('button');
+        button.type = 'button';
+        button.textContent = action;
+        button.addEventListener('click', () => { toast.hidden = true; onAction(); });
+        toast.append(' ', button);
+      }
+      toast.hidden = false;
+      clearTimeout(toastTimer);
+      toastTimer = setTimeout(() => { toast.hidden = true; }, 8000);
+    }
+
+    function showError(text) {
+      showToast(text);
+      toast.classList.add('error');
+    }
+
+    // Forms of the listing are posted with fetch and answered with JSON,
+    // instead of the redirect a browser without JavaScript follows
+    function postForm(form, action) {
+      return fetch(action || form.action, {
+        method: 'POST',
+        headers: {'Accept': 'application/json', 'X-CSRF-Token': csrfToken},
+        body: new URLSearchParams(new FormData(form))
+      }).then(response => response.ok ? response.json() : response.text().then(text => Promise.reject(text.trim() || response.statusText)));
+    }
+
+    // refreshListing replaces the rows with the directory's current ones,
+    // fetched like the pages infinite scrolling appends
+    function refreshListing() {
+      const url = new URL(location.href);
+      url.searchParams.set('rows', '1');
+      return fetch(url, {cache: 'no-cache', headers: {'Accept': 'application/json'}})
+        .then(response => response.ok ? response.json() : Promise.reject(response.statusText))
+        .then(chunk => {
+          const tbody = document.querySelector('#file-table tbody');
+          tbody.querySelectorAll('tr.filerow:not([data-parent])').forEach(row => row.remove());
+          tbody.insertAdjacentHTML('beforeend', chunk.rows);
+          if (gallery) gallery.innerHTML = chunk.gallery;
+          applyFilter();
+          queueChecksums();
+          updateSelection();
+          document.dispatchEvent(new CustomEvent('listingrefresh', {detail: chunk}));
+        });
+    }
+
+    function moveEntries(dir, names, to) {
+      return fetch({{url "/move"}}, {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json', 'Accept': 'application/json', 'X-CSRF-Token': csrfToken},
+        body: JSON.stringify({dir: dir, paths: names, to: to})
+      }).then(response => response.ok ? response.json() : response.text().then(text => Promise.reject(text.trim())));
+    }
+
+    // Links are built from the address the server is reached at, which
+    // honors the base URL and the scheme and host of trusted proxies
+    const siteURL = {{.SiteURL}};
+    function entryURL(name) {
+      return siteURL + (currentPath + name).split('/').map(encodeURIComponent).join('/');
+    }
+
+    document.getElementById('file-table').addEventListener('click', function(e) {
+      const button = e.target.closest('.copy-link');
+      if (!button) return;
+      const row = button.closest('tr');
+      const url = entryURL(row.dataset.name + (row.hasAttribute('data-dir') ? '/' : ''));
+      if (!navigator.clipboard) {
+        prompt(t('Copy link'), url);
+        return;
+      }
+      navigator.clipboard.writeText(url)
+        .then(() => showToast(t('Link copied')))
+        .catch(() => prompt(t('Copy link'), url));
+    });
+
+    // Rows dragged onto a directory row, the parent row or a breadcrumb are
+    // moved there, together with the other checked entries when the dragged
+    // row is checked too
+    let dragged = null;
+    if (!document.getElementById('file-input').disabled) {
+      const table = document.getElementById('file-table');
+
+      function dropTarget(e) {
+        const row = e.target.closest('tr.filerow[data-dir], tr.filerow[data-parent]');
+        if (row) {
+          const target = row.hasAttribute('data-parent') ? currentPath.replace(/[^/]+\/$/, '') : currentPath + row.dataset.name + '/';
+          return {el: row, path: target};
+        }
+        const crumb = e.target.closest('.title-bar h1 a');
+        if (crumb) return {el: crumb, path: decodeURIComponent(new URL(crumb.href).pathname).slice(rootURL.length - 1)};
+        return null;
+      }
+
+      function validTarget(target) {
+        return target && target.path !== currentPath && !dragged.some(name => target.path.startsWith(currentPath + name + '/'));
+      }
+
+      function clearDropTargets() {
+        document.querySelectorAll('.drop-target').forEach(el => el.classList.remove('drop-target'));
+      }
+
+      table.addEventListener('dragstart', function(e) {
+        const row = e.target.closest('tr.filerow[data-name]');
+        if (!row) return;
+        const box = row.querySelector('.select-entry');
+        dragged = box && box.checked
+          ? Array.from(document.querySelectorAll('.select-entry:checked')).map(b => b.value)
+          : [row.dataset.name];
+        e.dataTransfer.effectAllowed = 'move';
+        e.dataTransfer.setData('text/plain', dragged.join('\n'));
+      });
+      table.addEventListener('dragend', function() {
+        dragged = null;
+        clearDropTargets();
+      });
+
+      document.addEventListener('dragover', function(e) {
+        if (!dragged) return;
+        clearDropTargets();
+        const target = dropTarget(e);
+        if (validTarget(target)) {
+          target.el.classList.add('drop-target');
+          e.dataTransfer.dropEffect = 'move';
+        } else {
+          e.dataTransfer.dropEffect = 'none';
+        }
+      });
+
+      document.addEventListener('drop', function(e) {
+        if (!dragged) return;
+        const names = dragged;
+        const target = dropTarget(e);
+        dragged = null;
+        clearDropTargets();
+        if (!validTarget(target)) return;
+        moveEntries(currentPath, names, target.path).then(() => {
+          names.forEach(name => {
+            const row = table.querySelector('tr.filerow[data-name="' + CSS.escape(name) + '"]');
+            if (row) row.remove();
+          });
+          updateSelection();
+          showToast(t('Moved to') + ' ' + target.path, t('Undo'), () => {
+            moveEntries(target.path, names, currentPath)
+              .then(() => refreshListing())
+              .catch(err => showError(t('Undo failed') + ': ' + err));
+          });
+        }).catch(err => showError(t('Move failed') + ': ' + err));
+      });
+    }
+
     // Drag and drop functionality
     const fileInput = document.getElementById('file-input');
     const dragMessage = document.getElementById('drag-message');
@@ -791,7 +3105,8 @@ const htmlTemplate = `<!DOCTYPE html>
 
     document.addEventListener('dragover', function(e) {
       e.preventDefault();
-      const text = fileInput.disabled ? '🚫 Uploads disabled' : '📁 Drop to upload';
+      if (!e.dataTransfer.types.includes('Files')) return;
+      const text = fileInput.disabled ? '🚫 ' + t('Uploads disabled') : '📁 ' + t('Drop to upload');
       showDragMessage(text);
     });
 
@@ -799,15 +3114,107 @@ const htmlTemplate = `<!DOCTYPE html>
       if (!e.relatedTarget) hideDragMessage();
     });
 
+    // Dropped files and folders are uploaded right away, after asking when
+    // CONFIRM_DROP_UPLOAD is set. Folders are walked so their files keep
+    // their relative paths.
+    const confirmDrop = {{.ConfirmDrop}};
+
+    // readAllEntries reads a directory in the batches readEntries returns
+    function readAllEntries(reader, found) {
+      return new Promise((resolve, reject) => reader.readEntries(resolve, reject))
+        .then(batch => batch.length === 0 ? found : readAllEntries(reader, found.concat(batch)));
+    }
+
+    function collectEntry(entry, prefix) {
+      if (entry.isFile) {
+        return new Promise((resolve, reject) => entry.file(resolve, reject))
+          .then(file => [{ file: file, path: prefix + file.name }]);
+      }
+      return readAllEntries(entry.createReader(), [])
+        .then(children => Promise.all(children.map(child => collectEntry(child, prefix + entry.name + '/'))))
+        .then(lists => lists.flat());
+    }
+
+    // droppedFiles resolves to the { file, path } entries of a drop; the
+    // entries are taken synchronously, while the drop's data is readable
+    function droppedFiles(dataTransfer) {
+      const entries = Array.from(dataTransfer.items || [])
+        .filter(item => item.kind === 'file')
+        .map(item => item.webkitGetAsEntry ? item.webkitGetAsEntry() : null);
+      if (entries.length === 0 || entries.includes(null)) {
+        return Promise.resolve(Array.from(dataTransfer.files).map(file => ({ file: file, path: file.name })));
+      }
+      return Promise.all(entries.map(entry => collectEntry(entry, ''))).then(lists => lists.flat());
+    }
+
     document.addEventListener('drop', function(e) {
       e.preventDefault();
       hideDragMessage();
-      if (!fileInput.disabled && e.dataTransfer.files.length > 0) {
-        fileInput.files = e.dataTransfer.files;
-        const label = document.getElementById('file-label');
-        label.textContent = e.dataTransfer.files[0].name;
-      }
+      if (fileInput.disabled || !e.dataTransfer.types.includes('Files')) return;
+      droppedFiles(e.dataTransfer).then(entries => {
+        if (entries.length === 0) return;
+        if (confirmDrop && !confirm(t('Upload the dropped files?') + ' (' + entries.length + ')')) return;
+        uploadFiles(entries);
+      }).catch(err => showToast(t('Upload failed') + ': ' + err));
+    });
+
+    // Files pasted outside text fields are uploaded too. Screenshots come
+    // from the clipboard as a bare image.png, so they get a timestamped name.
+    function pastedName(file) {
+      if (file.name && !/^image\.\w+$/.test(file.name)) return file.name;
+      const ext = (file.type.split('/')[1] || 'bin').replace('jpeg', 'jpg').replace(/\W.*/, '');
+      const now = new Date();
+      const pad = n => String(n).padStart(2, '0');
+      return 'pasted-' + now.getFullYear() + pad(now.getMonth() + 1) + pad(now.getDate()) +
+        '-' + pad(now.getHours()) + pad(now.getMinutes()) + pad(now.getSeconds()) + '.' + ext;
+    }
+
+    document.addEventListener('paste', function(e) {
+      if (fileInput.disabled || e.target.closest('input, textarea, [contenteditable]')) return;
+      const files = Array.from(e.clipboardData.files);
+      if (files.length === 0) return;
+      e.preventDefault();
+      uploadFiles(files.map(file => {
+        const name = pastedName(file);
+        return { file: name === file.name ? file : new File([file], name, { type: file.type }), path: name };
+      }));
     });
   </script>
 </body>
-</html>`
+</html>
+{{- define "rows"}}
+{{range .Files}}
+<tr class="filerow" data-name="{{.Name}}"{{if .IsDir}} data-dir{{end}}{{if not $.DisableUpload}} draggable="true"{{end}}>
+  <td class="select"><input type="checkbox" class="select-entry" name="path" value="{{.Name}}" form="archive-form"></td>
+  <td class="name">
+    <span class="entry-icon">{{if .IsDir}}📁{{else if .Thumbnail}}<img class="thumb" src="{{url "/thumb"}}{{$.CurrentPath}}{{.URL}}?w={{if $.Grid}}160{{else}}64{{end}}" loading="lazy" alt="">{{else}}📄{{end}}</span>
+    {{if .BrokenLink}}<span class="broken-link" title="{{t "Link target is missing or outside the served directory"}}">{{.Name}}</span> ⚠
+    {{else}}<a href="{{.URL}}{{if .IsDir}}{{$.Sort.Query}}{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a>{{if .Symlink}} <span class="symlink" title="{{t "Symbolic link"}}">🔗</span>{{end}}{{end}}
+    {{if .PDF}}<a class="preview-link" href="{{.URL}}?preview=1" title="{{t "Preview"}}">👁</a>{{end}}
+    {{if .Audio}}<button type="button" class="play-button" data-src="{{.URL}}" data-name="{{.Name}}" title="{{t "Play"}}">▶</button>{{end}}
+    {{if not $.DisableUpload}}<button type="button" class="rename-button" data-name="{{.Name}}" title="{{t "Rename"}}">✎</button>{{end}}
+    <button type="button" class="copy-link" title="{{t "Copy link"}}">📋</button>
+    <a class="qr-link" href="{{url "/qr"}}?path={{$.CurrentPath}}{{.URL}}" target="_blank" title="{{t "QR code"}}">▣</a>
+  </td>
+  <td class="size"{{with .SizeExact}} title="{{.}}"{{end}}>{{.Size}}</td>
+  <td class="date"><time datetime="{{.ModifiedISO}}"{{with .ModifiedExact}} title="{{.}}"{{end}}>{{.LastModified}}</time></td>
+  {{if $.ShowChecksums}}<td class="checksum"{{if not .IsDir}} data-pending{{end}}></td>{{end}}
+</tr>
+{{end}}
+{{- end}}
+{{- define "gallery-items"}}
+{{range .Files}}{{if .Image}}
+<a class="gallery-item" href="{{.URL}}" data-name="{{.Name}}">
+  <img src="{{if .Thumbnail}}{{url "/thumb"}}{{$.CurrentPath}}{{.URL}}?w=300{{else}}{{.URL}}{{end}}" loading="lazy" alt="{{.Name}}">
+  <span>{{.Name}}</span>
+</a>
+{{end}}{{end}}
+{{- end}}
+{{- define "head"}}
+{{- range headMeta}}
+<meta name="{{.Name}}" content="{{.Content}}">
+{{- end}}
+{{- range headScripts}}
+<script src="{{.}}" defer></script>
+{{- end}}
+{{- end}}`
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// Larger markdown files are served as plain text
+const markdownMaxSize = 5 << 20
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+	// Raw HTML is allowed in the source and stripped down to safe markup here
+	markdownPolicy = bluemonday.UGCPolicy()
+)
+
+func isMarkdown(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// wantsRenderedMarkdown reports whether a markdown file should be rendered:
+// ?render=1 and ?render=0 override the configured default.
+func wantsRenderedMarkdown(r *http.Request) bool {
+	switch r.URL.Query().Get("render") {
+	case "1", "true":
+		return true
+	case "0", "false":
+		return false
+	}
+	return renderMarkdownFiles
+}
+
+// renderMarkdown converts markdown source to sanitized HTML.
+func renderMarkdown(source []byte) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert(source, &buf); err != nil {
+		return "", err
+	}
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// directoryReadme renders the README.md among entries, if any.
+func directoryReadme(r *http.Request, entries []os.DirEntry, dirPath, urlPath string) template.HTML {
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(entry.Name(), "README.md") {
+			continue
+		}
+		if !permitted(r, path.Join(urlPath, entry.Name()), PermRead) {
+			return ""
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > markdownMaxSize {
+			return ""
+		}
+		source, err := os.ReadFile(filepath.Join(dirPath, entry.Name()))
+		if err != nil {
+			return ""
+		}
+		content, err := renderMarkdown(source)
+		if err != nil {
+			slog.Error("Unable to render README", "path", dirPath, "err", err)
+			return ""
+		}
+		return content
+	}
+	return ""
+}
+
+// serveMarkdown renders the markdown file at fullPath inside the page chrome.
+func serveMarkdown(w http.ResponseWriter, r *http.Request, fullPath, urlPath string) {
+	source, err := os.ReadFile(fullPath)
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	content, err := renderMarkdown(source)
+	if err != nil {
+		slog.Error("Unable to render Markdown", "path", fullPath, "err", err)
+		http.Error(w, "Error rendering file", http.StatusInternalServerError)
+		return
+	}
+
+	serveDocument(w, r, urlPath, Document{
+		Content: content,
+		Actions: []Crumb{{Label: "raw", URL: "?render=0"}},
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Audio formats browsers can play with the <audio> element
+var audioExtensions = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+	".wav":  true,
+	".m4a":  true,
+}
+
+func isAudio(name string) bool {
+	return audioExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+func isPDF(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".pdf")
+}
+
+// servePDF serves a PDF for display in the browser rather than as a download.
+func servePDF(w http.ResponseWriter, r *http.Request, fullPath string) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filepath.Base(fullPath)}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	release, ok := acquireTransfer(w, r, downloadSlots)
+	if !ok {
+		return
+	}
+	defer release()
+	w, done := countDownload(w)
+	defer done()
+	allowLongWrite(w)
+	http.ServeFile(w, r, fullPath)
+}
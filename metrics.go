@@ -0,0 +1,314 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Registry served at /metrics; collectors depending on the configuration
+// are added by registerMetrics
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	// Created by registerMetrics, with a path_group label when
+	// METRICS_PATH_GROUPS is set
+	httpRequests    *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+
+	uploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filebrowser_uploads_total",
+		Help: "Total number of file uploads",
+	}, []string{"status"})
+	uploadsTotal   = uploads.WithLabelValues("total")
+	uploadsSuccess = uploads.WithLabelValues("success")
+	uploadsError   = uploads.WithLabelValues("error")
+
+	operations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filebrowser_operations_total",
+		Help: "Total number of file operations",
+	}, []string{"type"})
+	directoryLists = operations.WithLabelValues("directory_list")
+	fileServes     = operations.WithLabelValues("file_serve")
+
+	// Files and archives sent, and completed uploads; sizes range from 1K
+	// to 16G
+	downloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filebrowser_download_bytes_total",
+		Help: "Total bytes sent for file downloads and archives",
+	})
+	downloadSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "filebrowser_download_size_bytes",
+		Help:    "Bytes sent per file download or archive",
+		Buckets: prometheus.ExponentialBuckets(1<<10, 4, 13),
+	})
+	uploadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filebrowser_upload_bytes_total",
+		Help: "Total bytes received in completed uploads",
+	})
+	uploadSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "filebrowser_upload_size_bytes",
+		Help:    "Size of completed uploads in bytes",
+		Buckets: prometheus.ExponentialBuckets(1<<10, 4, 13),
+	})
+
+	transfersRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "filebrowser_transfers_rejected_total",
+		Help: "Transfers refused because no slot freed up in time",
+	})
+
+	virusScans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filebrowser_virus_scans_total",
+		Help: "Total number of virus scans of uploads",
+	}, []string{"result"})
+	virusScansClean    = virusScans.WithLabelValues("clean")
+	virusScansInfected = virusScans.WithLabelValues("infected")
+	virusScansError    = virusScans.WithLabelValues("error")
+)
+
+var metricsHTTPHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// registerMetrics adds the collectors to metricsRegistry, leaving out those
+// of disabled features. It runs once the configuration is parsed.
+func registerMetrics() {
+	labels := []string{"method", "code"}
+	if len(metricsPathGroups) > 0 {
+		labels = append(labels, "path_group")
+	}
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "filebrowser_http_requests_total",
+		Help: "Total number of HTTP requests by method and status code",
+	}, labels)
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "filebrowser_http_request_duration_seconds",
+		Help:    "HTTP request duration in seconds",
+		Buckets: prometheus.DefBuckets,
+	}, labels)
+
+	info := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        "filebrowser_info",
+		Help:        "Information about the file browser",
+		ConstLabels: prometheus.Labels{"version": GitCommit, "build_date": BuildDate},
+	})
+	info.Set(1)
+	metricsRegistry.MustRegister(
+		info,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "filebrowser_uptime_seconds",
+			Help: "Total uptime in seconds",
+		}, func() float64 { return time.Since(startTime).Seconds() }),
+		httpRequests,
+		uploads,
+		operations,
+		requestDuration,
+		downloadBytes,
+		downloadSize,
+		uploadBytes,
+		uploadSize,
+		stateCollector{},
+	)
+	if uploadSlots != nil || downloadSlots != nil {
+		metricsRegistry.MustRegister(transfersRejected)
+	}
+	if clamdAddress != "" {
+		metricsRegistry.MustRegister(virusScans)
+	}
+}
+
+// Methods counted under their own name; anything else is "other", so
+// clients cannot add arbitrary label values
+var metricMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodDelete, http.MethodOptions, http.MethodPatch,
+}
+
+func metricMethod(method string) string {
+	if slices.Contains(metricMethods, method) {
+		return method
+	}
+	return "other"
+}
+
+// parsePathGroups reads METRICS_PATH_GROUPS, a comma separated list of
+// top-level directory names.
+func parsePathGroups(value string) []string {
+	var groups []string
+	for _, group := range splitList(value) {
+		if group = strings.Trim(group, "/"); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// pathGroup returns the path_group label of urlPath: its first segment when
+// listed in METRICS_PATH_GROUPS, "/" for the root and "other" otherwise, so
+// the number of label values stays bounded.
+func pathGroup(urlPath string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(urlPath, "/"), "/")
+	switch {
+	case segment == "":
+		return "/"
+	case slices.Contains(metricsPathGroups, segment):
+		return segment
+	}
+	return "other"
+}
+
+// withRequestMetrics counts every request but scrapes of /metrics by
+// method and status code, and observes its duration.
+func withRequestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		values := []string{metricMethod(r.Method), strconv.Itoa(status)}
+		if len(metricsPathGroups) > 0 {
+			values = append(values, pathGroup(r.URL.Path))
+		}
+		httpRequests.WithLabelValues(values...).Inc()
+		requestDuration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+	})
+}
+
+// requestCounts sums the request counter for the admin dashboard, counting
+// 4xx and 5xx responses as errors.
+func requestCounts() (total, failed uint64) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		httpRequests.Collect(ch)
+		close(ch)
+	}()
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		n := uint64(m.GetCounter().GetValue())
+		total += n
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "code" && label.GetValue() >= "400" {
+				failed += n
+			}
+		}
+	}
+	return total, failed
+}
+
+// countDownload wraps w so that the body written through it is added to the
+// download metrics when the returned function is called.
+func countDownload(w http.ResponseWriter) (http.ResponseWriter, func()) {
+	rec := &responseRecorder{ResponseWriter: w}
+	return rec, func() {
+		if rec.bytes > 0 {
+			downloadBytes.Add(float64(rec.bytes))
+			downloadSize.Observe(float64(rec.bytes))
+		}
+	}
+}
+
+// countUpload adds a completed upload of n bytes to the upload metrics.
+func countUpload(n int64) {
+	uploadBytes.Add(float64(n))
+	uploadSize.Observe(float64(n))
+}
+
+// counterValue returns the current value of c, for the admin dashboard.
+func counterValue(c prometheus.Counter) uint64 {
+	var m dto.Metric
+	if err := c.Write(&m); err != nil {
+		return 0
+	}
+	return uint64(m.GetCounter().GetValue())
+}
+
+var (
+	memoryDesc          = prometheus.NewDesc("filebrowser_memory_bytes", "Memory usage in bytes", []string{"type"}, nil)
+	goroutinesDesc      = prometheus.NewDesc("filebrowser_goroutines", "Current number of goroutines", nil, nil)
+	gcDesc              = prometheus.NewDesc("filebrowser_gc_total", "Total number of garbage collections", nil, nil)
+	transfersDesc       = prometheus.NewDesc("filebrowser_transfers", "Transfers in progress and their limit", []string{"direction", "type"}, nil)
+	quotaDesc           = prometheus.NewDesc("filebrowser_quota_bytes", "Storage quota limit and usage per path prefix", []string{"prefix", "type"}, nil)
+	filesystemBytesDesc = prometheus.NewDesc("filebrowser_filesystem_bytes", "Capacity of the filesystem backing the files dir", []string{"type"}, nil)
+	filesystemInodeDesc = prometheus.NewDesc("filebrowser_filesystem_inodes", "Inodes of the filesystem backing the files dir", []string{"type"}, nil)
+	configDesc          = prometheus.NewDesc("filebrowser_config", "Configuration settings", []string{"setting"}, nil)
+)
+
+// Reports the runtime, transfer slots, quotas and disk usage as they are
+// at scrape time
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{memoryDesc, goroutinesDesc, gcDesc, transfersDesc, quotaDesc, filesystemBytesDesc, filesystemInodeDesc, configDesc} {
+		ch <- desc
+	}
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	gauge(memoryDesc, float64(m.Alloc), "alloc")
+	gauge(memoryDesc, float64(m.Sys), "sys")
+	gauge(memoryDesc, float64(m.HeapAlloc), "heap_alloc")
+	gauge(memoryDesc, float64(m.HeapSys), "heap_sys")
+	gauge(goroutinesDesc, float64(runtime.NumGoroutine()))
+	ch <- prometheus.MustNewConstMetric(gcDesc, prometheus.CounterValue, float64(m.NumGC))
+
+	for _, t := range []struct {
+		direction string
+		slots     chan struct{}
+	}{{"upload", uploadSlots}, {"download", downloadSlots}} {
+		if t.slots != nil {
+			gauge(transfersDesc, float64(len(t.slots)), t.direction, "active")
+			gauge(transfersDesc, float64(cap(t.slots)), t.direction, "limit")
+		}
+	}
+
+	for _, q := range quotas {
+		gauge(quotaDesc, float64(q.Limit), q.Prefix, "limit")
+		gauge(quotaDesc, float64(q.Used()), q.Prefix, "used")
+	}
+
+	if usage := lastDiskUsage.Load(); usage != nil {
+		gauge(filesystemBytesDesc, float64(usage.TotalBytes), "total")
+		gauge(filesystemBytesDesc, float64(usage.UsedBytes()), "used")
+		gauge(filesystemBytesDesc, float64(usage.FreeBytes), "free")
+		gauge(filesystemBytesDesc, float64(usage.AvailBytes), "avail")
+		gauge(filesystemInodeDesc, float64(usage.TotalInodes), "total")
+		gauge(filesystemInodeDesc, float64(usage.UsedInodes()), "used")
+		gauge(filesystemInodeDesc, float64(usage.FreeInodes), "free")
+	}
+
+	if enableUpload {
+		gauge(configDesc, 1, "uploads_enabled")
+	} else {
+		gauge(configDesc, 1, "uploads_disabled")
+	}
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !enableMetrics {
+		http.Error(w, "Metrics are disabled", http.StatusForbidden)
+		return
+	}
+	metricsHTTPHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeName converts an uploaded file name to the configured Unicode
+// normalization form ("nfc", "nfd" or "none").
+func normalizeName(name string) string {
+	switch strings.ToLower(normalizeNames) {
+	case "nfc":
+		return norm.NFC.String(name)
+	case "nfd":
+		return norm.NFD.String(name)
+	default:
+		return name
+	}
+}
+
+// resolvePath maps a URL path onto the filesystem below filesDir. When the
+// exact path does not exist, each segment is matched against the directory
+// entries normalization-insensitively, so a name stored as NFD is still
+// reachable from a client sending NFC and vice versa.
+func resolvePath(urlPath string) string {
+	fullPath := filepath.Join(filesDir, urlPath)
+	if _, err := os.Lstat(fullPath); err == nil {
+		return fullPath
+	}
+
+	current := filesDir
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean("/"+urlPath)), "/") {
+		if part == "" {
+			continue
+		}
+		next := filepath.Join(current, part)
+		if _, err := os.Lstat(next); err != nil {
+			match, ok := findEquivalentName(current, part)
+			if !ok {
+				return fullPath
+			}
+			next = filepath.Join(current, match)
+		}
+		current = next
+	}
+	return current
+}
+
+// findEquivalentName returns the entry of dir whose name is canonically
+// equivalent to name.
+func findEquivalentName(dir, name string) (string, bool) {
+	if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+		return name, true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	want := norm.NFC.String(name)
+	for _, entry := range entries {
+		if norm.NFC.String(entry.Name()) == want {
+			return entry.Name(), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// OpenAPI 3 forbids paths that only differ in the names of their templates
+func TestOpenAPIPathsAreDistinct(t *testing.T) {
+	template := regexp.MustCompile(`\{[^}]*\}`)
+	seen := map[string]string{}
+	for p := range openAPISpec()["paths"].(map[string]any) {
+		shape := template.ReplaceAllString(p, "{}")
+		if other, ok := seen[shape]; ok {
+			t.Errorf("paths %s and %s have the same hierarchy", p, other)
+		}
+		seen[shape] = p
+	}
+}
+
+func TestAPIDocsAssetsAreEmbedded(t *testing.T) {
+	defer func(enabled bool) { enableAPIDocs = enabled }(enableAPIDocs)
+	enableAPIDocs = true
+
+	for _, name := range []string{"/api/docs/swagger-ui.css", "/api/docs/swagger-ui-bundle.js"} {
+		w := httptest.NewRecorder()
+		apiDocsAssetsHandler(w, httptest.NewRequest("GET", name, nil))
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("GET %s = %d with %d bytes", name, w.Code, w.Body.Len())
+		}
+	}
+}
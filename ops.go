@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// resolveTarget maps a client supplied path onto the files dir, rejecting
+// the files dir itself and anything outside it.
+func resolveTarget(p string) (urlPath, fullPath string, ok bool) {
+	urlPath = path.Clean("/" + p)
+	fullPath = resolvePath(urlPath)
+	if urlPath == "/" || !withinRoot(fullPath) {
+		return "", "", false
+	}
+	if filepath.Base(fullPath) == accessFileName || strings.HasPrefix(filepath.Base(fullPath), stagingPrefix) {
+		return "", "", false
+	}
+	if blockIgnored && isIgnored(fullPath) {
+		return "", "", false
+	}
+	return urlPath, fullPath, true
+}
+
+// checkWritable rejects modifications while uploads are disabled or the
+// server is in read-only mode.
+func checkWritable(w http.ResponseWriter) bool {
+	if !enableUpload {
+		http.Error(w, "Modifications are disabled", http.StatusForbidden)
+		return false
+	}
+	if readOnly.Load() {
+		http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// canModify checks .fbaccess files and the ACL for writing at urlPath.
+func canModify(r *http.Request, urlPath, fullPath string) bool {
+	return checkAccess(r, filepath.Dir(fullPath)) && permitted(r, urlPath, PermWrite)
+}
+
+// errProtected stops the walk of canModifyTree at the first access file
+// refusing the request.
+var errProtected = errors.New("protected subtree")
+
+// canModifyTree is canModify for removing or moving the whole tree at
+// urlPath: the request also needs write access wherever an ACL rule or an
+// access file below it applies, or the protection would go away with the
+// tree.
+func canModifyTree(r *http.Request, urlPath, fullPath string) bool {
+	if !canModify(r, urlPath, fullPath) {
+		return false
+	}
+	info, err := os.Lstat(fullPath)
+	if err != nil || !info.IsDir() {
+		return err == nil
+	}
+
+	prefix := aclPath(urlPath) + "/"
+	for _, rule := range aclRules {
+		if strings.HasPrefix(rule.Prefix, prefix) && !permitted(r, rule.Prefix, PermWrite) {
+			return false
+		}
+	}
+
+	err = filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Name() != accessFileName {
+			return nil
+		}
+		dir := filepath.Dir(p)
+		rule, err := loadAccessRule(dir)
+		if err != nil {
+			return err
+		}
+		if rule != nil && !rule.allows(r, dir) {
+			return errProtected
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errProtected) {
+		slog.Warn("Denying modification", "path", urlPath, "err", err)
+	}
+	return err == nil
+}
+
+// requestValues reads the named string fields from a JSON body or from the
+// posted form values.
+func requestValues(r *http.Request, keys ...string) (map[string]string, error) {
+	values := map[string]string{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		err := json.NewDecoder(r.Body).Decode(&values)
+		return values, err
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		values[key] = r.PostForm.Get(key)
+	}
+	return values, nil
+}
+
+// serverError logs err and answers with a generic 500 so server paths don't
+// leak to clients.
+func serverError(w http.ResponseWriter, message string, err error) {
+	slog.Error(message, "err", err)
+	http.Error(w, message, http.StatusInternalServerError)
+}
+
+// respondDone answers a successful mutation with JSON for API clients or a
+// redirect back to the listing for browser forms.
+func respondDone(w http.ResponseWriter, r *http.Request, status int, urlPath string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"path": urlPath})
+		return
+	}
+	http.Redirect(w, r, path.Dir(strings.TrimSuffix(urlPath, "/"))+"/", http.StatusSeeOther)
+}
+
+// renameHandler moves or renames the "from" path to "to", both relative to
+// the files dir.
+func renameHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWritable(w) {
+		return
+	}
+
+	req, err := requestValues(r, "from", "to")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	fromURL, fromPath, ok := resolveTarget(req["from"])
+	if !ok {
+		http.Error(w, "Invalid source path", http.StatusBadRequest)
+		return
+	}
+	toDir, toName := path.Split(path.Clean("/" + req["to"]))
+	toURL, toPath, ok := resolveTarget(path.Join(toDir, normalizeName(toName)))
+	if !ok {
+		http.Error(w, "Invalid destination path", http.StatusBadRequest)
+		return
+	}
+
+	if !checkMove(w, r, fromURL, fromPath, toURL, toPath) {
+		return
+	}
+
+	size, _ := dirSize(fromPath)
+	if err := moveTree(fromPath, toPath); err != nil {
+		serverError(w, "Error renaming "+fromURL, err)
+		return
+	}
+	moveVersions(fromPath, toPath)
+	addQuotaUsage(fromURL, -size)
+	addQuotaUsage(toURL, size)
+
+	recordAudit(r, "rename", fromURL+" -> "+toURL)
+	respondDone(w, r, http.StatusOK, toURL)
+}
+
+// checkMove answers with an error and returns false unless fromPath exists
+// and may be moved to toPath, which must not exist yet. Moving a directory
+// needs write access to everything protected inside it.
+func checkMove(w http.ResponseWriter, r *http.Request, fromURL, fromPath, toURL, toPath string) bool {
+	if _, err := os.Lstat(fromPath); err != nil {
+		http.Error(w, fmt.Sprintf("%s: no such file or directory", fromURL), http.StatusNotFound)
+		return false
+	}
+	if !canModifyTree(r, fromURL, fromPath) || !canModify(r, toURL, toPath) {
+		denyPermission(w, r)
+		return false
+	}
+	if _, err := os.Lstat(toPath); err == nil {
+		http.Error(w, fmt.Sprintf("%s already exists", toURL), http.StatusConflict)
+		return false
+	}
+	if rel, err := filepath.Rel(fromPath, toPath); err == nil && !strings.HasPrefix(rel, "..") {
+		http.Error(w, "Cannot move a directory into itself", http.StatusBadRequest)
+		return false
+	}
+	if info, err := os.Stat(filepath.Dir(toPath)); err != nil || !info.IsDir() {
+		http.Error(w, "Destination directory does not exist", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// moveTree renames src to dst, copying across devices when needed.
+func moveTree(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return moveFile(src, dst)
+	}
+
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case d.IsDir():
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return moveFile(p, target)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// mkdirHandler creates the directory "name" inside "dir".
+func mkdirHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWritable(w) {
+		return
+	}
+
+	req, err := requestValues(r, "dir", "name")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	name := normalizeName(strings.TrimSpace(req["name"]))
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		http.Error(w, "Invalid folder name", http.StatusBadRequest)
+		return
+	}
+
+	urlPath, fullPath, ok := resolveTarget(path.Join(req["dir"], name))
+	if !ok {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if !canModify(r, urlPath, fullPath) {
+		denyPermission(w, r)
+		return
+	}
+	if existing, ok := findEquivalentName(filepath.Dir(fullPath), name); ok {
+		http.Error(w, fmt.Sprintf("%s already exists", path.Join(path.Dir(urlPath), existing)), http.StatusConflict)
+		return
+	}
+
+	if err := os.Mkdir(fullPath, os.ModePerm); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "Parent directory does not exist", http.StatusNotFound)
+			return
+		}
+		serverError(w, "Error creating folder "+urlPath, err)
+		return
+	}
+
+	recordAudit(r, "mkdir", urlPath)
+	respondDone(w, r, http.StatusCreated, urlPath+"/")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withTestTree points the files dir at a temporary directory holding files,
+// a map of slash separated paths to contents, and enables modifications.
+func withTestTree(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir, upload, rules := filesDir, enableUpload, aclRules
+	t.Cleanup(func() { filesDir, enableUpload, aclRules = dir, upload, rules })
+	filesDir, enableUpload, aclRules = t.TempDir(), true, nil
+	for name, content := range files {
+		fullPath := filepath.Join(filesDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCanModifyTree(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"open/a.txt":                "",
+		"locked/notes/.fbaccess":    "users: alice\n",
+		"locked/notes/secret.txt":   "",
+		"ruled/archive/old.txt":     "",
+		"ruled/archive/2020/x.txt":  "",
+		"ruled/elsewhere/other.txt": "",
+	})
+	aclRules = []ACLRule{
+		{Prefix: "/", Subject: "*", Perms: PermRead | PermWrite | PermList},
+		{Prefix: "/ruled/archive", Subject: "*", Perms: PermRead | PermList},
+		{Prefix: "/ruled/archive", Subject: "alice", Perms: PermRead | PermWrite | PermList},
+	}
+
+	alice := &Identity{Name: "alice"}
+	tests := []struct {
+		path string
+		id   *Identity
+		want bool
+	}{
+		{"/open", nil, true},
+		{"/open/a.txt", nil, true},
+		{"/locked", nil, false},
+		{"/locked", alice, true},
+		{"/locked/notes", nil, false},
+		{"/ruled", nil, false},
+		{"/ruled", alice, true},
+		{"/ruled/elsewhere", nil, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		if tt.id != nil {
+			r = withIdentity(r, tt.id)
+		}
+		fullPath := filepath.Join(filesDir, filepath.FromSlash(tt.path))
+		if got := canModifyTree(r, tt.path, fullPath); got != tt.want {
+			t.Errorf("canModifyTree(%s, id %v) = %v, want %v", tt.path, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestRenameKeepsProtectedSubtrees(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"projects/private/.fbaccess": "password: s3cret\n",
+		"projects/private/plans.txt": "",
+	})
+
+	form := url.Values{"from": {"/projects"}, "to": {"/moved"}}
+	r := httptest.NewRequest("POST", "/rename", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	renameHandler(w, r)
+	if w.Code == http.StatusSeeOther || w.Code == http.StatusOK {
+		t.Fatalf("rename of a protected subtree succeeded with %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, "projects", "private", "plans.txt")); err != nil {
+		t.Errorf("protected file moved: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Largest accepted ?per_page=
+const maxPerPage = 10000
+
+// Rendered page of listing rows, fetched by the infinite scroll with ?rows=1
+type ListingChunk struct {
+	Page    int    `json:"page"`
+	Pages   int    `json:"pages"`
+	Total   int    `json:"total"`
+	Rows    string `json:"rows"`
+	Gallery string `json:"gallery"`
+	// URL of the following chunk, empty on the last page
+	Next string `json:"next"`
+}
+
+// Page of a directory listing from ?page=&per_page=
+type Pagination struct {
+	Page    int
+	PerPage int
+	Total   int
+
+	sort ListingSort
+}
+
+// parsePagination reads the page parameters. perPage is used when
+// per_page is absent; 0 means the whole listing on one page.
+func parsePagination(r *http.Request, perPage int, s ListingSort) (Pagination, error) {
+	p := Pagination{Page: 1, PerPage: perPage, sort: s}
+	if value := r.URL.Query().Get("page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return p, fmt.Errorf("invalid page %q", value)
+		}
+		p.Page = n
+	}
+	if value := r.URL.Query().Get("per_page"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxPerPage {
+			return p, fmt.Errorf("invalid per_page %q, expected 1 to %d", value, maxPerPage)
+		}
+		p.PerPage = n
+	}
+	return p, nil
+}
+
+// Paginated reports whether the listing is split into pages at all.
+func (p Pagination) Paginated() bool {
+	return p.PerPage > 0
+}
+
+// Pages is the number of pages, at least 1.
+func (p Pagination) Pages() int {
+	if p.PerPage <= 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PerPage - 1) / p.PerPage
+}
+
+// slice records the total and returns the current page of infos.
+func (p *Pagination) slice(infos []fs.FileInfo) []fs.FileInfo {
+	p.Total = len(infos)
+	if p.PerPage <= 0 {
+		return infos
+	}
+	start := min((p.Page-1)*p.PerPage, len(infos))
+	end := min(start+p.PerPage, len(infos))
+	return infos[start:end]
+}
+
+// URL links page n, keeping the sort order and page size.
+func (p Pagination) URL(n int) string {
+	values := url.Values{}
+	if !p.sort.isDefault() {
+		values.Set("sort", p.sort.Key)
+		values.Set("order", p.sort.Order)
+	}
+	if p.PerPage != pageSize {
+		values.Set("per_page", strconv.Itoa(p.PerPage))
+	}
+	if n > 1 {
+		values.Set("page", strconv.Itoa(n))
+	}
+	if len(values) == 0 {
+		return "?"
+	}
+	return "?" + values.Encode()
+}
+
+func (p Pagination) PrevURL() string {
+	if p.Page <= 1 {
+		return ""
+	}
+	return p.URL(min(p.Page-1, p.Pages()))
+}
+
+func (p Pagination) NextURL() string {
+	if p.Page >= p.Pages() {
+		return ""
+	}
+	return p.URL(p.Page + 1)
+}
+
+// NextChunkURL is NextURL asking for a ListingChunk.
+func (p Pagination) NextChunkURL() string {
+	next := p.NextURL()
+	if next == "" {
+		return ""
+	}
+	return next + "&rows=1"
+}
+
+// serveListingChunk renders only the table rows and gallery items of data,
+// the listing page's template data, for appending to an open page.
+func serveListingChunk(w http.ResponseWriter, tmpl *template.Template, p Pagination, data any) {
+	var rows, gallery strings.Builder
+	if err := tmpl.ExecuteTemplate(&rows, "rows", data); err != nil {
+		serverError(w, "Error rendering rows", err)
+		return
+	}
+	if err := tmpl.ExecuteTemplate(&gallery, "gallery-items", data); err != nil {
+		serverError(w, "Error rendering rows", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ListingChunk{
+		Page:    p.Page,
+		Pages:   p.Pages(),
+		Total:   p.Total,
+		Rows:    rows.String(),
+		Gallery: gallery.String(),
+		Next:    p.NextChunkURL(),
+	})
+}
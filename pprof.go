@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"net/netip"
+)
+
+// pprofMux serves the runtime profiles under /debug/pprof/. Importing
+// net/http/pprof also registers them on http.DefaultServeMux, which is why
+// the server routes requests through a mux of its own.
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// pprofHandler serves the profiles on the main listeners to admins only,
+// since they expose the command line and memory contents.
+func pprofHandler() http.Handler {
+	mux := pprofMux()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !requireAdmin(w, r) {
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// checkLoopbackAddr refuses a PPROF_ADDR reachable from other hosts, as the
+// separate listener has no authentication.
+func checkLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !ip.IsLoopback() {
+		return fmt.Errorf("%q is not a loopback address", addr)
+	}
+	return nil
+}
+
+// servePprof runs the profiles on their own listener at addr. Without a
+// write timeout, long CPU profiles and traces are not cut short.
+func servePprof(addr string) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           pprofMux(),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+	slog.Info("Serving pprof", "address", addr)
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("pprof listener stopped", "err", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Content codings of precompressed siblings, in order of preference
+var precompressedEncodings = []struct {
+	name, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header allows coding,
+// either by name or through "*", with a non-zero quality.
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, coding) && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// precompressedSibling returns the file.br or file.gz next to fullPath that
+// the client accepts, like nginx's gzip_static, and its content coding.
+// Siblings that are not regular files, lead outside the root or are hidden
+// by .fbignore are skipped.
+func precompressedSibling(r *http.Request, fullPath string) (string, string, bool) {
+	header := r.Header.Get("Accept-Encoding")
+	if header == "" {
+		return "", "", false
+	}
+	for _, enc := range precompressedEncodings {
+		if !acceptsEncoding(header, enc.name) {
+			continue
+		}
+		sibling := fullPath + enc.ext
+		info, err := os.Stat(sibling)
+		if err != nil || !info.Mode().IsRegular() || !withinRoot(sibling) || isIgnored(sibling) {
+			continue
+		}
+		return sibling, enc.name, true
+	}
+	return "", "", false
+}
+
+// servePrecompressed serves the precompressed sibling of fullPath with the
+// original file's type and reports whether there was one. The type cannot be
+// sniffed from compressed content, so it falls back to application/octet-stream.
+func servePrecompressed(w http.ResponseWriter, r *http.Request, fullPath string) bool {
+	w.Header().Add("Vary", "Accept-Encoding")
+	sibling, encoding, ok := precompressedSibling(r, fullPath)
+	if !ok {
+		return false
+	}
+	f, err := os.Open(sibling)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(fullPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", encoding)
+	http.ServeContent(w, r, filepath.Base(fullPath), info.ModTime(), f)
+	return true
+}
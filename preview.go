@@ -0,0 +1,137 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Bytes of a text file shown in the preview pane
+const previewTextBytes = 4096
+
+var previewTmpl = template.Must(template.New("preview").Funcs(template.FuncMap{
+	"formatSize": formatSize,
+	"url":        prefixURL,
+}).Parse(previewTemplate))
+
+// previewHandler serves GET /preview?path=..., an HTML fragment with the
+// metadata and a preview of an entry for the listing's side pane.
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	urlPath, fullPath, ok := resolveTarget(r.URL.Query().Get("path"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	accessDir, perm := filepath.Dir(fullPath), PermRead
+	if info.IsDir() {
+		accessDir, perm = fullPath, PermList
+	}
+	if !checkAccess(r, accessDir) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, perm) {
+		denyPermission(w, r)
+		return
+	}
+
+	entry := newAPIEntry(info, urlPath)
+	data := struct {
+		APIEntry
+		Modified  string
+		URL       string
+		Image     bool
+		Thumbnail bool
+		Audio     bool
+		PDF       bool
+		Text      string
+		Truncated bool
+		Items     int
+		Exif      *ExifInfo
+	}{
+		APIEntry:  entry,
+		Modified:  formatDate(info.ModTime()),
+		URL:       prefixURL(entry.Path),
+		Image:     !info.IsDir() && hasThumbnail(info.Name()),
+		Thumbnail: enableThumbnails,
+		Audio:     !info.IsDir() && isAudio(info.Name()),
+		PDF:       !info.IsDir() && isPDF(info.Name()),
+	}
+
+	if data.Image && hasExif(info.Name()) {
+		data.Exif, _ = readExif(fullPath)
+	}
+
+	if info.IsDir() {
+		if entries, err := readDirectory(fullPath); err == nil {
+			data.Items = len(entries)
+		}
+	} else if !data.Image && !data.Audio && !data.PDF && isTextFile(fullPath) {
+		data.Text, data.Truncated = readTextHead(fullPath, info.Size())
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	previewTmpl.Execute(w, data)
+}
+
+// readTextHead returns the first previewTextBytes of the file, cut at a
+// valid UTF-8 boundary.
+func readTextHead(fullPath string, size int64) (string, bool) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	buf := make([]byte, previewTextBytes)
+	n, _ := io.ReadFull(f, buf)
+	text := buf[:n]
+	for i := 0; i < utf8.UTFMax && len(text) > 0 && !utf8.Valid(text); i++ {
+		text = text[:len(text)-1]
+	}
+	return string(text), size > int64(len(text))
+}
+
+const previewTemplate = `<div class="preview">
+  <h2>{{.Name}}{{if .IsDir}}/{{end}}</h2>
+  {{if .Image}}
+  <a href="{{.URL}}"><img src="{{if .Thumbnail}}{{url "/thumb"}}{{.Path}}?w=400{{else}}{{.URL}}{{end}}" alt="{{.Name}}"></a>
+  {{else if .Audio}}
+  <audio controls preload="metadata" src="{{.URL}}"></audio>
+  {{else if .PDF}}
+  <iframe src="{{.URL}}" title="{{.Name}}"></iframe>
+  {{else if .Text}}
+  <pre>{{.Text}}{{if .Truncated}}
+…{{end}}</pre>
+  {{end}}
+  <table>
+    <tr><th>Path</th><td>{{.Path}}</td></tr>
+    {{if .IsDir}}<tr><th>Items</th><td>{{.Items}}</td></tr>
+    {{else}}<tr><th>Size</th><td>{{formatSize .Size}} ({{.Size}} bytes)</td></tr>
+    <tr><th>Type</th><td>{{.MimeType}}</td></tr>{{end}}
+    <tr><th>Modified</th><td>{{.Modified}}</td></tr>
+  </table>
+  {{with .Exif}}
+  <table class="exif">
+    {{with .Camera}}<tr><th>Camera</th><td>{{.}}</td></tr>{{end}}
+    {{with .Lens}}<tr><th>Lens</th><td>{{.}}</td></tr>{{end}}
+    {{if .Width}}<tr><th>Dimensions</th><td>{{.Width}} × {{.Height}}</td></tr>{{end}}
+    {{with .Taken}}<tr><th>Taken</th><td>{{.}}</td></tr>{{end}}
+    {{if .ExposureTime}}<tr><th>Exposure</th><td>{{.ExposureTime}} s{{if .FNumber}}, f/{{.FNumber}}{{end}}{{if .ISO}}, ISO {{.ISO}}{{end}}{{if .FocalLength}}, {{.FocalLength}} mm{{end}}</td></tr>{{end}}
+    {{if .Latitude}}<tr><th>Location</th><td><a href="https://www.openstreetmap.org/?mlat={{.Latitude}}&amp;mlon={{.Longitude}}" rel="noopener noreferrer" target="_blank">{{.Coordinates}}</a></td></tr>{{end}}
+  </table>
+  {{end}}
+  <p><a href="{{.URL}}">Open</a>{{if not .IsDir}} · <a href="{{.URL}}?format=json">Metadata</a>{{end}}</p>
+</div>`
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies reads TRUSTED_PROXIES, a comma separated list of
+// addresses and CIDR ranges.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range splitList(value) {
+		prefix, err := parseAddrRange(entry)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// parseAddrRange parses a CIDR range, or a single address as a range
+// holding only it.
+func parseAddrRange(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid address range %q", entry)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", entry)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func isTrustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromTrustedProxy reports whether the request's peer is a trusted proxy,
+// whose X-Forwarded-* headers can be believed.
+func fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return isTrustedProxy(host)
+}
+
+// clientIP returns the address of the client without the port. Behind
+// trusted proxies it is the last X-Forwarded-For hop that is not one of
+// them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// requestScheme returns http or https as seen by the client, taking
+// X-Forwarded-Proto from trusted proxies into account.
+func requestScheme(r *http.Request) string {
+	if fromTrustedProxy(r) {
+		proto := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0])
+		if proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// externalURL returns the absolute URL the app is reachable at for the
+// client of r, including the base URL.
+func externalURL(r *http.Request) string {
+	host := r.Host
+	if fromTrustedProxy(r) {
+		if forwarded := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Host"), ",")[0]); forwarded != "" {
+			host = forwarded
+		}
+	}
+	return requestScheme(r) + "://" + host + baseURL
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// Light modules around the code, as the QR specification asks for
+const qrQuietZone = 4
+
+// qrHandler serves GET /qr?path=<path>, an SVG QR code of the absolute link
+// to a file or directory, so phones can open it without typing.
+func qrHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Query().Get("path"))
+	fullPath := resolvePath(urlPath)
+	if !withinRoot(fullPath) || (blockIgnored && isIgnored(fullPath)) {
+		notFound(w, r)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+	accessDir, perm := filepath.Dir(fullPath), PermRead
+	if info.IsDir() {
+		accessDir, perm = fullPath, PermList
+		if !strings.HasSuffix(urlPath, "/") {
+			urlPath += "/"
+		}
+	}
+	if !checkAccess(r, accessDir) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, perm) {
+		denyPermission(w, r)
+		return
+	}
+
+	link := externalURL(r) + (&url.URL{Path: urlPath}).EscapedPath()
+	code, err := qr.Encode(link, qr.M)
+	if err != nil {
+		serverError(w, "Error encoding QR code", err)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write([]byte(qrSVG(code, link)))
+}
+
+// qrSVG draws code as an SVG image with one unit per module, titled with
+// the encoded link.
+func qrSVG(code *qr.Code, link string) string {
+	size := code.Size + 2*qrQuietZone
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, size, size, size*8, size*8)
+	fmt.Fprintf(&b, `<title>%s</title>`, html.EscapeString(link))
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(&b, "M%d %dh1v1h-1z", x+qrQuietZone, y+qrQuietZone)
+			}
+		}
+	}
+	b.WriteString(`"/></svg>`)
+	return b.String()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Storage limit for everything below a path prefix
+type Quota struct {
+	Prefix string
+	Limit  int64
+
+	used atomic.Int64
+}
+
+func (q *Quota) Used() int64 {
+	return q.used.Load()
+}
+
+func (q *Quota) Remaining() int64 {
+	return max(q.Limit-q.used.Load(), 0)
+}
+
+// Longest prefix first
+var quotas []*Quota
+
+const quotaRefreshInterval = 5 * time.Minute
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// parseQuotas reads a comma separated list of prefix=size pairs. A bare size
+// applies to the whole files dir.
+func parseQuotas(value string) ([]*Quota, error) {
+	var list []*Quota
+	for _, entry := range splitList(value) {
+		prefix, size, found := strings.Cut(entry, "=")
+		if !found {
+			prefix, size = "/", entry
+		}
+		limit, err := parseSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("quota %q: %v", entry, err)
+		}
+		list = append(list, &Quota{Prefix: path.Clean("/" + strings.TrimSpace(prefix)), Limit: limit})
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return len(list[i].Prefix) > len(list[j].Prefix)
+	})
+	return list, nil
+}
+
+func (q *Quota) contains(urlPath string) bool {
+	return q.Prefix == "/" || urlPath == q.Prefix || strings.HasPrefix(urlPath, q.Prefix+"/")
+}
+
+// quotasFor returns every quota that covers urlPath.
+func quotasFor(urlPath string) []*Quota {
+	var matched []*Quota
+	for _, q := range quotas {
+		if q.contains(urlPath) {
+			matched = append(matched, q)
+		}
+	}
+	return matched
+}
+
+// tightestQuota returns the covering quota with the least space left.
+func tightestQuota(urlPath string) *Quota {
+	var tightest *Quota
+	for _, q := range quotasFor(urlPath) {
+		if tightest == nil || q.Remaining() < tightest.Remaining() {
+			tightest = q
+		}
+	}
+	return tightest
+}
+
+// limitQuota caps src to the space left for urlPath. Bytes of a file being
+// replaced count as free.
+func limitQuota(src io.Reader, urlPath string, replaced int64) io.Reader {
+	q := tightestQuota(urlPath)
+	if q == nil {
+		return src
+	}
+	return &quotaReader{r: src, remaining: q.Remaining() + replaced}
+}
+
+// addQuotaUsage accounts for delta bytes written below urlPath.
+func addQuotaUsage(urlPath string, delta int64) {
+	for _, q := range quotasFor(urlPath) {
+		q.used.Add(delta)
+	}
+}
+
+type quotaReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	q.remaining -= int64(n)
+	if q.remaining < 0 {
+		return n, errQuotaExceeded
+	}
+	return n, err
+}
+
+// dirSize sums the size of the regular files below dir.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+// refreshQuotaUsage periodically recomputes usage from disk, picking up
+// deletes and changes made outside the server.
+func refreshQuotaUsage() {
+	job := registerJob("quota usage")
+	for {
+		job.Run(func() error {
+			var firstErr error
+			for _, q := range quotas {
+				used, err := dirSize(filepath.Join(filesDir, filepath.FromSlash(q.Prefix)))
+				if err != nil {
+					slog.Warn("Unable to compute quota usage", "prefix", q.Prefix, "err", err)
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+				q.used.Store(used)
+			}
+			return firstErr
+		})
+		time.Sleep(quotaRefreshInterval)
+	}
+}
+
+func quotaSummary() string {
+	if len(quotas) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(quotas))
+	for _, q := range quotas {
+		parts = append(parts, q.Prefix+"="+formatSize(q.Limit))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Size of the file at fullPath, or 0 when it does not exist yet
+func existingSize(fullPath string) int64 {
+	if info, err := os.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+		return info.Size()
+	}
+	return 0
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	searchMaxDepth   = 20
+	searchMaxResults = 500
+	searchTimeout    = 5 * time.Second
+)
+
+// Entry matching a search
+type SearchResult struct {
+	APIEntry
+	// Fuzzy match quality, higher is better; unset for content matches
+	Score int `json:"score,omitempty"`
+}
+
+// Search results returned by /search
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Dir     string         `json:"dir"`
+	Content bool           `json:"content"`
+	Results []SearchResult `json:"results"`
+	// Set when the walk stopped at the depth, time or result limit
+	Truncated bool `json:"truncated"`
+}
+
+// searchNames walks dirPath for entries whose name fuzzily matches query,
+// stopping at maxDepth levels or searchTimeout. Only the searchMaxResults
+// best scored matches are kept, best first.
+func searchNames(r *http.Request, dirPath, urlPath, query string, maxDepth int) SearchResponse {
+	response := SearchResponse{Query: query, Dir: urlPath, Results: []SearchResult{}}
+	pattern := []rune(foldName(strings.Join(strings.Fields(query), "")))
+	deadline := time.Now().Add(searchTimeout)
+
+	walkArchive(r, dirPath, urlPath, func(fullPath, rel string, info fs.FileInfo) error {
+		if rel == "." {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			response.Truncated = true
+			return fs.SkipAll
+		}
+		if score, ok := fuzzyScore(info.Name(), pattern); ok {
+			response.Results = append(response.Results, SearchResult{APIEntry: newAPIEntry(info, path.Join(urlPath, rel)), Score: score})
+			// Trim in batches rather than keeping a heap
+			if len(response.Results) >= 2*searchMaxResults {
+				response.Results = rankResults(response.Results)
+				response.Truncated = true
+			}
+		}
+		if info.IsDir() && strings.Count(rel, "/")+1 >= maxDepth {
+			response.Truncated = true
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if len(response.Results) > searchMaxResults {
+		response.Truncated = true
+	}
+	response.Results = rankResults(response.Results)
+	return response
+}
+
+// rankResults sorts by descending score, then shorter and alphabetically
+// earlier paths, and keeps the first searchMaxResults.
+func rankResults(results []SearchResult) []SearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+		return a.Path < b.Path
+	})
+	if len(results) > searchMaxResults {
+		results = results[:searchMaxResults]
+	}
+	return results
+}
+
+// Scoring for fuzzyScore, loosely following fzf: every matched character
+// scores, more so at word starts and in runs, and gaps cost a little.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+	bonusBoundary     = 8
+	bonusCamel        = 7
+	bonusConsecutive  = 4
+	bonusFirstChar    = 2 // multiplier for the bonus of the pattern's first character
+)
+
+// fuzzyScore reports whether the folded pattern occurs in name as a
+// subsequence, e.g. "qrtrpt" in "Quarterly Report.pdf", and how well. Each
+// occurrence of the first character starts a candidate window, shrunk from
+// its end like fzf does, and the best scoring window wins.
+func fuzzyScore(name string, pattern []rune) (int, bool) {
+	if len(pattern) == 0 {
+		return 0, true
+	}
+	text := []rune(norm.NFC.String(name))
+	lower := make([]rune, len(text))
+	for i, c := range text {
+		lower[i] = unicode.ToLower(c)
+	}
+
+	best, found := 0, false
+	for from := range lower {
+		if lower[from] != pattern[0] {
+			continue
+		}
+		// Forward: find where the match starting here ends
+		pi, end := 0, -1
+		for i := from; i < len(lower); i++ {
+			if lower[i] == pattern[pi] {
+				pi++
+				if pi == len(pattern) {
+					end = i
+					break
+				}
+			}
+		}
+		if end < 0 {
+			// Later starts cannot complete either
+			break
+		}
+		// Backward: tighten the start of that window
+		start := end
+		for i, pi := end, len(pattern)-1; i >= from; i-- {
+			if lower[i] == pattern[pi] {
+				if pi--; pi < 0 {
+					start = i
+					break
+				}
+			}
+		}
+		if score := scoreWindow(text, lower, pattern, start, end); !found || score > best {
+			best, found = score, true
+		}
+	}
+	return best, found
+}
+
+// scoreWindow scores matching pattern left to right within text[start:end+1].
+func scoreWindow(text, lower, pattern []rune, start, end int) int {
+	score, pi, run, inGap := 0, 0, 0, false
+	for i := start; i <= end && pi < len(pattern); i++ {
+		if lower[i] != pattern[pi] {
+			if inGap {
+				score += scoreGapExtension
+			} else {
+				score += scoreGapStart
+			}
+			inGap, run = true, 0
+			continue
+		}
+		bonus := charBonus(text, i)
+		if run > 0 {
+			bonus = max(bonus, bonusConsecutive)
+		}
+		if pi == 0 {
+			bonus *= bonusFirstChar
+		}
+		score += scoreMatch + bonus
+		pi, run, inGap = pi+1, run+1, false
+	}
+	return score
+}
+
+// charBonus rewards matching at the start of a word or a camelCase hump.
+func charBonus(text []rune, i int) int {
+	if i == 0 {
+		return bonusBoundary
+	}
+	prev, c := text[i-1], text[i]
+	switch {
+	case !unicode.IsLetter(prev) && !unicode.IsDigit(prev):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(c), !unicode.IsDigit(prev) && unicode.IsDigit(c):
+		return bonusCamel
+	}
+	return 0
+}
+
+// searchContents looks up the files below dirPath containing every word of
+// query in the content index, skipping those the request may not read.
+func searchContents(r *http.Request, dirPath, urlPath, query string) SearchResponse {
+	response := SearchResponse{Query: query, Dir: urlPath, Content: true, Results: []SearchResult{}}
+	for _, match := range contentIndex.search(urlPath, query) {
+		if len(response.Results) >= searchMaxResults {
+			response.Truncated = true
+			break
+		}
+		rel := strings.TrimPrefix(match, strings.TrimSuffix(urlPath, "/"))
+		fullPath := filepath.Join(dirPath, filepath.FromSlash(rel))
+		if !checkAccess(r, filepath.Dir(fullPath)) || !permitted(r, match, PermRead) || isIgnored(fullPath) {
+			continue
+		}
+		info, err := os.Lstat(fullPath)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		response.Results = append(response.Results, SearchResult{APIEntry: newAPIEntry(info, match)})
+	}
+	return response
+}
+
+// foldName prepares a name for case and normalization insensitive matching.
+func foldName(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// searchHandler serves GET /search?q=...&dir=/&depth=20 as JSON or as a
+// results page. With content=1 the content index is searched instead of
+// file names.
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		http.Error(w, "Missing search query", http.StatusBadRequest)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Query().Get("dir"))
+	dirPath := resolvePath(urlPath)
+	if !withinRoot(dirPath) {
+		notFound(w, r)
+		return
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		notFound(w, r)
+		return
+	}
+	if !checkAccess(r, dirPath) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermList) {
+		denyPermission(w, r)
+		return
+	}
+
+	if r.URL.Query().Get("content") == "1" {
+		if !enableContentIndex {
+			http.Error(w, "Content search is disabled", http.StatusNotFound)
+			return
+		}
+		response := searchContents(r, dirPath, urlPath, query)
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusOK, response)
+			return
+		}
+		serveSearchResults(w, r, response)
+		return
+	}
+
+	depth := searchMaxDepth
+	if value := r.URL.Query().Get("depth"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid depth", http.StatusBadRequest)
+			return
+		}
+		depth = min(n, searchMaxDepth)
+	}
+
+	response := searchNames(r, dirPath, urlPath, query, depth)
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	serveSearchResults(w, r, response)
+}
+
+var searchResultsTmpl = template.Must(template.New("search").Funcs(template.FuncMap{
+	"formatSize": formatSize,
+	"url":        prefixURL,
+}).Parse(searchResultsTemplate))
+
+func serveSearchResults(w http.ResponseWriter, r *http.Request, response SearchResponse) {
+	var buf bytes.Buffer
+	data := struct {
+		SearchResponse
+		ContentIndex bool
+	}{response, enableContentIndex}
+	if err := searchResultsTmpl.Execute(&buf, data); err != nil {
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+	dirURL := strings.TrimSuffix(response.Dir, "/") + "/"
+	serveDocument(w, r, response.Dir, Document{
+		Content:     template.HTML(buf.String()),
+		Name:        "Search: " + response.Query,
+		Breadcrumbs: append(buildBreadcrumbs(dirURL), Crumb{Label: " 🔍 " + response.Query, URL: ""}),
+		Actions:     []Crumb{{Label: "back", URL: prefixURL(dirURL)}},
+	})
+}
+
+const searchResultsTemplate = `<form class="search-form" action="{{url "/search"}}" method="get">
+  <input type="hidden" name="dir" value="{{.Dir}}">
+  <input type="text" name="q" value="{{.Query}}" class="search-box" autofocus>
+  {{- if .ContentIndex}}
+  <label><input type="checkbox" name="content" value="1"{{if .Content}} checked{{end}} onchange="this.form.submit()"> file contents</label>
+  {{- end}}
+</form>
+<p class="search-summary">{{len .Results}} {{if .Content}}file{{else}}result{{end}}{{if ne (len .Results) 1}}s{{end}} {{if .Content}}containing{{else}}matching{{end}} “{{.Query}}” in {{.Dir}}{{if .Truncated}} (search stopped early, narrow it down){{end}}</p>
+<table class="search-results">
+  {{range .Results}}
+  <tr>
+    <td class="name">{{if .IsDir}}📁{{else}}📄{{end}} <a href="{{url .Path}}">{{.Path}}</a></td>
+    <td class="size">{{if not .IsDir}}{{formatSize .Size}}{{end}}</td>
+  </tr>
+  {{end}}
+</table>`
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Default HTTPS address with TLS_CERT and TLS_KEY
+const tlsAddr = ":8443"
+
+// tlsEnabled reports whether an HTTPS listener is configured, from
+// certificate files or ACME.
+func tlsEnabled() bool {
+	return tlsCert != "" || len(acmeDomains) > 0
+}
+
+// resolveListenAddrs fills in the default listener addresses. Plain HTTP
+// runs on :8000 unless HTTPS is configured, in which case it only runs when
+// HTTP_ADDR is set, e.g. on localhost for health checks.
+func resolveListenAddrs() error {
+	if (tlsCert == "") != (tlsKey == "") {
+		return fmt.Errorf("TLS_CERT and TLS_KEY must be set together")
+	}
+	if tlsCert != "" && len(acmeDomains) > 0 {
+		return fmt.Errorf("TLS_CERT and ACME_DOMAINS are mutually exclusive")
+	}
+	if httpsAddr == "" && tlsCert != "" {
+		httpsAddr = tlsAddr
+	}
+	if httpsAddr == "" && len(acmeDomains) > 0 {
+		httpsAddr = acmeHTTPSAddr
+	}
+	if httpAddr == "" && !tlsEnabled() {
+		httpAddr = port
+	}
+	if httpsAddr != "" && !tlsEnabled() {
+		return fmt.Errorf("HTTPS_ADDR needs TLS_CERT and TLS_KEY or ACME_DOMAINS")
+	}
+	if enableHTTP3 && !tlsEnabled() {
+		return fmt.Errorf("HTTP/3 needs HTTPS, set TLS_CERT and TLS_KEY or ACME_DOMAINS")
+	}
+	return nil
+}
+
+// parseServerLimits reads the listener timeouts and the request header
+// limit. Without them a slowloris client can hold connections open forever.
+func parseServerLimits() error {
+	timeouts := []struct {
+		key, value string
+		dst        *time.Duration
+	}{
+		{"READ_HEADER_TIMEOUT", "10s", &readHeaderTimeout},
+		{"IDLE_TIMEOUT", "2m", &idleTimeout},
+		{"WRITE_TIMEOUT", "0", &writeTimeout},
+	}
+	for _, t := range timeouts {
+		d, err := time.ParseDuration(getEnv(t.key, t.value))
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid %s %q", t.key, getEnv(t.key, t.value))
+		}
+		*t.dst = d
+	}
+	n, err := parseSize(getEnv("MAX_HEADER_BYTES", "1M"))
+	if err != nil || n < 1 || n > 1<<30 {
+		return fmt.Errorf("invalid MAX_HEADER_BYTES %q", getEnv("MAX_HEADER_BYTES", "1M"))
+	}
+	maxHeaderBytes = int(n)
+	return nil
+}
+
+// newServer returns a server for addr with the configured limits.
+func newServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+		WriteTimeout:      writeTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// allowLongWrite lifts WRITE_TIMEOUT for a response that may legitimately
+// take long, like a large download, an archive or a tail stream.
+func allowLongWrite(w http.ResponseWriter) {
+	if writeTimeout > 0 {
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+}
+
+// serverTLSConfig loads the certificate files or sets up ACME.
+func serverTLSConfig() (*tls.Config, error) {
+	if len(acmeDomains) > 0 {
+		return acmeTLSConfig(), nil
+	}
+	cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// serve runs every configured listener with the same handler: plain HTTP on
+// httpAddr or a socket-activated listener, and HTTPS on httpsAddr, also
+// over HTTP/3 when enabled. It returns the first listener's failure.
+func serve(handler http.Handler) error {
+	errs := make(chan error, 2)
+
+	if tlsEnabled() {
+		tlsConfig, err := serverTLSConfig()
+		if err != nil {
+			return fmt.Errorf("TLS: %w", err)
+		}
+		httpsHandler := handler
+		if enableHTTP3 {
+			httpsHandler = serveHTTP3(httpsAddr, handler, tlsConfig)
+		}
+		server := newServer(httpsAddr, httpsHandler)
+		server.TLSConfig = tlsConfig
+		if len(acmeDomains) > 0 {
+			slog.Info("Serving HTTPS", "address", httpsAddr, "domains", acmeDomains, "cache", acmeCacheDir)
+		} else {
+			slog.Info("Serving HTTPS", "address", httpsAddr)
+		}
+		go func() { errs <- server.ListenAndServeTLS("", "") }()
+	}
+
+	listener, err := systemdListener()
+	if err != nil {
+		return fmt.Errorf("socket-activated listener: %w", err)
+	}
+	if listener != nil {
+		slog.Info("Serving HTTP on a socket-activated listener", "address", listener.Addr().String())
+		go func() { errs <- newServer("", handler).Serve(listener) }()
+	} else if httpAddr != "" {
+		slog.Info("Serving HTTP", "address", httpAddr)
+		go func() { errs <- newServer(httpAddr, handler).ListenAndServe() }()
+	}
+
+	return <-errs
+}
@@ -0,0 +1,666 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Route shared links are served under, without credentials
+const sharePrefix = "/s/"
+
+// Link giving anyone who knows its token access to a file or directory
+type Share struct {
+	Token     string     `json:"token"`
+	Path      string     `json:"path"`
+	Created   time.Time  `json:"created"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	CreatedBy string     `json:"createdBy,omitempty"`
+	// Downloads the link allows, 0 for unlimited, and those made so far
+	MaxDownloads int `json:"maxDownloads,omitempty"`
+	Downloads    int `json:"downloads"`
+}
+
+func (s *Share) expired(now time.Time) bool {
+	return s.Expires != nil && !now.Before(*s.Expires)
+}
+
+func (s *Share) exhausted() bool {
+	return s.MaxDownloads > 0 && s.Downloads >= s.MaxDownloads
+}
+
+// Share as returned to API clients, with its absolute link
+type ShareView struct {
+	Share
+	URL     string `json:"url"`
+	Expired bool   `json:"expired"`
+	// Whether the download limit has been reached
+	Exhausted bool `json:"exhausted"`
+}
+
+func shareView(r *http.Request, s Share) ShareView {
+	return ShareView{Share: s, URL: externalURL(r) + sharePrefix + s.Token, Expired: s.expired(time.Now()), Exhausted: s.exhausted()}
+}
+
+// Shares by token, persisted to sharesFile when one is configured
+var shareStore = struct {
+	sync.Mutex
+	shares map[string]*Share
+}{shares: map[string]*Share{}}
+
+// loadShares reads the shares saved in file; a missing file holds none.
+func loadShares(file string) error {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var list []*Share
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	shareStore.Lock()
+	defer shareStore.Unlock()
+	for _, s := range list {
+		shareStore.shares[s.Token] = s
+	}
+	return nil
+}
+
+// saveShares writes the shares to sharesFile through a temporary file, so
+// a crash never leaves it half written. The caller holds shareStore.
+func saveShares() error {
+	if sharesFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(sortedShares(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(sharesFile), ".shares-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), sharesFile)
+}
+
+// sortedShares returns the shares, oldest first. The caller holds
+// shareStore.
+func sortedShares() []*Share {
+	list := make([]*Share, 0, len(shareStore.shares))
+	for _, s := range shareStore.shares {
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b *Share) int { return a.Created.Compare(b.Created) })
+	return list
+}
+
+// Context key of the shared root a request is served under
+type shareRootKey struct{}
+
+func withSharedRoot(r *http.Request, root string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), shareRootKey{}, root))
+}
+
+func sharedRoot(r *http.Request) (string, bool) {
+	root, ok := r.Context().Value(shareRootKey{}).(string)
+	return root, ok
+}
+
+// restrictingRules returns the ACL rules below root that withhold reading
+// or listing from someone, and so protect part of its tree more than root.
+func restrictingRules(root string) []ACLRule {
+	prefix := strings.TrimSuffix(aclPath(root), "/") + "/"
+	var rules []ACLRule
+	for _, rule := range aclRules {
+		if strings.HasPrefix(rule.Prefix, prefix) && rule.Perms&(PermRead|PermList) != PermRead|PermList {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// hasAccessFile reports whether dir holds an access file, or one that can't
+// be read.
+func hasAccessFile(dir string) bool {
+	rule, err := loadAccessRule(dir)
+	return err != nil || rule != nil
+}
+
+// shareableTree reports whether the tree at fullPath can be shared: access
+// files and stricter ACL rules below it would stop protecting anything,
+// since a share's token is the only permission its visitors need.
+func shareableTree(urlPath, fullPath string) bool {
+	if len(restrictingRules(urlPath)) > 0 {
+		return false
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.IsDir() {
+		return err == nil
+	}
+	err = filepath.WalkDir(fullPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == accessFileName && filepath.Dir(p) != fullPath {
+			return errProtected
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errProtected) {
+		slog.Warn("Refusing to share", "path", urlPath, "err", err)
+	}
+	return err == nil
+}
+
+// shareBlocked reports whether the share of root must not serve fullPath,
+// for trees that gained an access file or a stricter ACL rule after being
+// shared, or a symlink leading out of the shared tree.
+func shareBlocked(root, fullPath string) bool {
+	rootReal, err := realPath(resolvePath(root))
+	if err != nil {
+		return true
+	}
+	real, err := realPath(fullPath)
+	if err != nil || !isUnder(real, rootReal) {
+		return true
+	}
+	if real == rootReal {
+		return false
+	}
+	rel, err := filepath.Rel(rootReal, real)
+	if err != nil {
+		return true
+	}
+	urlPath := aclPath(path.Join(root, filepath.ToSlash(rel)))
+	for _, rule := range restrictingRules(root) {
+		if rule.matchesPath(urlPath) {
+			return true
+		}
+	}
+	dir := real
+	if info, err := os.Stat(real); err != nil || !info.IsDir() {
+		dir = filepath.Dir(real)
+	}
+	for ; dir != rootReal; dir = filepath.Dir(dir) {
+		if hasAccessFile(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupShare(token string) (Share, bool) {
+	shareStore.Lock()
+	defer shareStore.Unlock()
+	s, ok := shareStore.shares[token]
+	if !ok {
+		return Share{}, false
+	}
+	return *s, true
+}
+
+// claimShareDownload counts a download against the share's limit, failing
+// once the limit is reached. Checking and counting under the store's lock
+// keeps concurrent downloads from going over it.
+func claimShareDownload(token string) bool {
+	shareStore.Lock()
+	defer shareStore.Unlock()
+	s, ok := shareStore.shares[token]
+	if !ok || s.exhausted() {
+		return false
+	}
+	s.Downloads++
+	if err := saveShares(); err != nil {
+		slog.Error("Unable to save shares", "err", err)
+	}
+	return true
+}
+
+// releaseShareDownload gives back a download claimed for a request that
+// failed.
+func releaseShareDownload(token string) {
+	shareStore.Lock()
+	defer shareStore.Unlock()
+	if s, ok := shareStore.shares[token]; ok && s.Downloads > 0 {
+		s.Downloads--
+		if err := saveShares(); err != nil {
+			slog.Error("Unable to save shares", "err", err)
+		}
+	}
+}
+
+// serveShareDownload serves a file or archive of share through serve. Each
+// new download, a GET without a range or with one from the start, counts
+// against its download limit unless serving it fails; ranges resuming a
+// download are free, but like every other GET refused once the limit is
+// reached. HEAD requests are always answered.
+func serveShareDownload(w http.ResponseWriter, r *http.Request, share Share, serve func(http.ResponseWriter)) {
+	if r.Method == http.MethodGet {
+		rng := r.Header.Get("Range")
+		if rng == "" || strings.HasPrefix(rng, "bytes=0-") {
+			if !claimShareDownload(share.Token) {
+				serveError(w, r, http.StatusGone, "This link has reached its download limit")
+				return
+			}
+			rec := &responseRecorder{ResponseWriter: w}
+			serve(rec)
+			if rec.status >= 400 {
+				releaseShareDownload(share.Token)
+			}
+			return
+		}
+		if current, ok := lookupShare(share.Token); !ok || current.exhausted() {
+			serveError(w, r, http.StatusGone, "This link has reached its download limit")
+			return
+		}
+	}
+	serve(w)
+}
+
+func newShareToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// parseShareExpiry reads when a new share expires: empty or "never" for no
+// expiry, a duration like 24h or 7d from now, or an RFC 3339 time.
+func parseShareExpiry(value string, now time.Time) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "never" {
+		return nil, nil
+	}
+	var expires time.Time
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expiry %q", value)
+		}
+		expires = now.AddDate(0, 0, n)
+	} else if d, err := time.ParseDuration(value); err == nil {
+		expires = now.Add(d)
+	} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+		expires = t
+	} else {
+		return nil, fmt.Errorf("invalid expiry %q, expected a duration like 24h or 7d, or an RFC 3339 time", value)
+	}
+	if !expires.After(now) {
+		return nil, errors.New("expiry must be in the future")
+	}
+	return &expires, nil
+}
+
+// canManageShare reports whether the client may see and revoke s: admins
+// manage every share, users their own, and without authentication everyone
+// manages the anonymous ones.
+func canManageShare(r *http.Request, s *Share) bool {
+	if isAdmin(r) {
+		return true
+	}
+	if id := requestIdentity(r); id != nil {
+		return s.CreatedBy == id.Name
+	}
+	return s.CreatedBy == ""
+}
+
+// shareHandler creates a share of the "path" file or directory the client
+// may read, expiring after "expires" when given.
+func shareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !enableShares {
+		http.Error(w, "Sharing is disabled", http.StatusNotFound)
+		return
+	}
+
+	req, err := requestValues(r, "path", "expires", "maxDownloads")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	urlPath, fullPath, ok := resolveTarget(req["path"])
+	if !ok {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("%s: no such file or directory", urlPath), http.StatusNotFound)
+		return
+	}
+	accessDir, perm := filepath.Dir(fullPath), PermRead
+	if info.IsDir() {
+		accessDir, perm = fullPath, PermList
+	}
+	if !checkAccess(r, accessDir) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, perm) {
+		denyPermission(w, r)
+		return
+	}
+	if !shareableTree(urlPath, fullPath) {
+		http.Error(w, fmt.Sprintf("%s holds folders protected by a password or the ACL and can't be shared", urlPath), http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	expires, err := parseShareExpiry(req["expires"], now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxDownloads := 0
+	if value := strings.TrimSpace(req["maxDownloads"]); value != "" {
+		if maxDownloads, err = strconv.Atoi(value); err != nil || maxDownloads < 0 {
+			http.Error(w, "Invalid download limit", http.StatusBadRequest)
+			return
+		}
+	}
+	token, err := newShareToken()
+	if err != nil {
+		serverError(w, "Error creating share", err)
+		return
+	}
+	share := &Share{Token: token, Path: urlPath, Created: now, Expires: expires, MaxDownloads: maxDownloads}
+	if id := requestIdentity(r); id != nil {
+		share.CreatedBy = id.Name
+	}
+
+	shareStore.Lock()
+	shareStore.shares[token] = share
+	err = saveShares()
+	if err != nil {
+		delete(shareStore.shares, token)
+	}
+	shareStore.Unlock()
+	if err != nil {
+		serverError(w, "Error saving shares", err)
+		return
+	}
+
+	recordAudit(r, "share", urlPath)
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, shareView(r, *share))
+		return
+	}
+	http.Redirect(w, r, "/shares", http.StatusSeeOther)
+}
+
+// sharesHandler lists the shares the client manages, as JSON or as a page
+// with revoke buttons.
+func sharesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !enableShares {
+		http.Error(w, "Sharing is disabled", http.StatusNotFound)
+		return
+	}
+
+	views := []ShareView{}
+	shareStore.Lock()
+	for _, s := range sortedShares() {
+		if canManageShare(r, s) {
+			views = append(views, shareView(r, *s))
+		}
+	}
+	shareStore.Unlock()
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string][]ShareView{"shares": views})
+		return
+	}
+	serveSharesPage(w, r, views)
+}
+
+// revokeShareHandler deletes the share with the given "token".
+func revokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !enableShares {
+		http.Error(w, "Sharing is disabled", http.StatusNotFound)
+		return
+	}
+
+	req, err := requestValues(r, "token")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	shareStore.Lock()
+	share, ok := shareStore.shares[req["token"]]
+	if !ok || !canManageShare(r, share) {
+		shareStore.Unlock()
+		http.Error(w, "No such share", http.StatusNotFound)
+		return
+	}
+	delete(shareStore.shares, share.Token)
+	err = saveShares()
+	shareStore.Unlock()
+	if err != nil {
+		serverError(w, "Error saving shares", err)
+		return
+	}
+
+	recordAudit(r, "revoke share", share.Path)
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"token": share.Token})
+		return
+	}
+	http.Redirect(w, r, "/shares", http.StatusSeeOther)
+}
+
+// sharedHandler serves /s/<token>/<path>: the shared file, or below a
+// shared directory a plain listing, its files and a zip of it. The token is
+// the permission for the shared tree, but parts of it protected by access
+// files or stricter ACL rules below the shared directory are not served.
+func sharedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, sharePrefix), "/")
+	share, ok := lookupShare(token)
+	if !enableShares || !ok {
+		notFound(w, r)
+		return
+	}
+	if share.expired(time.Now()) {
+		serveError(w, r, http.StatusGone, "This link has expired")
+		return
+	}
+	if share.exhausted() {
+		serveError(w, r, http.StatusGone, "This link has reached its download limit")
+		return
+	}
+
+	rel := path.Clean("/" + rest)
+	urlPath := path.Join(share.Path, rel)
+	fullPath := resolvePath(urlPath)
+	name := filepath.Base(fullPath)
+	if !withinRoot(fullPath) || name == accessFileName || strings.HasPrefix(name, stagingPrefix) || isIgnored(fullPath) {
+		notFound(w, r)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || shareBlocked(share.Path, fullPath) {
+		notFound(w, r)
+		return
+	}
+
+	if !info.IsDir() {
+		f, err := os.Open(fullPath)
+		if err != nil {
+			notFound(w, r)
+			return
+		}
+		defer f.Close()
+		fileServes.Inc()
+		release, ok := acquireTransfer(w, r, downloadSlots)
+		if !ok {
+			return
+		}
+		defer release()
+		serveShareDownload(w, r, share, func(w http.ResponseWriter) {
+			w, done := countDownload(w)
+			defer done()
+			allowLongWrite(w)
+			http.ServeContent(w, r, name, info.ModTime(), f)
+		})
+		return
+	}
+
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusFound)
+		return
+	}
+	if r.URL.Query().Get("download") == "zip" {
+		serveShareDownload(w, r, share, func(w http.ResponseWriter) {
+			serveZip(w, withSharedRoot(r, share.Path), fullPath, urlPath)
+		})
+		return
+	}
+	serveSharedListing(w, r, share, rel, fullPath)
+}
+
+// Entry of a shared directory's page
+type SharedEntry struct {
+	Name  string
+	IsDir bool
+	Size  int64
+}
+
+var sharedListingTmpl = template.Must(template.New("shared").Funcs(template.FuncMap{
+	"formatSize": formatSize,
+	"pathEscape": url.PathEscape,
+}).Parse(sharedListingTemplate))
+
+func serveSharedListing(w http.ResponseWriter, r *http.Request, share Share, rel, dirPath string) {
+	entries, err := readDirectory(dirPath)
+	if err != nil {
+		serverError(w, "Error reading directory", err)
+		return
+	}
+	var list []SharedEntry
+	for _, info := range sortedInfos(filterIgnored(entries, dirPath), dirPath, defaultSort) {
+		if info.Mode()&fs.ModeSymlink != 0 || shareBlocked(share.Path, filepath.Join(dirPath, info.Name())) {
+			continue
+		}
+		list = append(list, SharedEntry{Name: info.Name(), IsDir: info.IsDir(), Size: info.Size()})
+	}
+
+	var buf bytes.Buffer
+	if err := sharedListingTmpl.Execute(&buf, struct{ Entries []SharedEntry }{list}); err != nil {
+		serverError(w, "Error rendering page", err)
+		return
+	}
+
+	// Breadcrumbs start at the shared directory, not at the root
+	rootURL := prefixURL(sharePrefix + share.Token + "/")
+	crumbs := []Crumb{{Label: path.Base(share.Path) + "/", URL: rootURL}}
+	current := rootURL
+	for _, part := range strings.Split(strings.Trim(rel, "/"), "/") {
+		if part != "" {
+			current += part + "/"
+			crumbs = append(crumbs, Crumb{Label: part + "/", URL: current})
+		}
+	}
+	serveDocument(w, r, path.Join(share.Path, rel), Document{
+		Content:     template.HTML(buf.String()),
+		Name:        path.Base(path.Join(share.Path, rel)),
+		Breadcrumbs: crumbs,
+		Actions:     []Crumb{{Label: "zip", URL: "?download=zip"}},
+	})
+}
+
+const sharedListingTemplate = `<table class="search-results">
+  {{range .Entries}}
+  <tr>
+    <td class="name">{{if .IsDir}}📁 <a href="{{pathEscape .Name}}/">{{.Name}}/</a>{{else}}📄 <a href="{{pathEscape .Name}}">{{.Name}}</a>{{end}}</td>
+    <td class="size">{{if not .IsDir}}{{formatSize .Size}}{{end}}</td>
+  </tr>
+  {{else}}
+  <tr><td>Empty folder</td></tr>
+  {{end}}
+</table>`
+
+var sharesTmpl = template.Must(template.New("shares").Funcs(template.FuncMap{
+	"formatDate": formatDate,
+	"url":        prefixURL,
+}).Parse(sharesTemplate))
+
+func serveSharesPage(w http.ResponseWriter, r *http.Request, views []ShareView) {
+	var buf bytes.Buffer
+	data := struct {
+		Shares    []ShareView
+		CSRFToken string
+	}{views, csrfToken(w, r)}
+	if err := sharesTmpl.Execute(&buf, data); err != nil {
+		serverError(w, "Error rendering page", err)
+		return
+	}
+	serveDocument(w, r, "/", Document{
+		Content:     template.HTML(buf.String()),
+		Name:        "Shared links",
+		Breadcrumbs: append(buildBreadcrumbs("/"), Crumb{Label: " 🔗 shared links", URL: ""}),
+		Actions:     []Crumb{{Label: "back", URL: prefixURL("/")}},
+	})
+}
+
+const sharesTemplate = `<p class="search-summary">{{len .Shares}} shared link{{if ne (len .Shares) 1}}s{{end}}</p>
+<table class="search-results">
+  {{range .Shares}}
+  <tr>
+    <td class="name"><a href="{{url .Path}}">{{.Path}}</a></td>
+    <td><a href="{{.URL}}">{{.URL}}</a></td>
+    <td class="date">{{if .Expired}}expired{{else if .Expires}}until {{formatDate .Expires}}{{else}}no expiry{{end}}</td>
+    <td>{{if .MaxDownloads}}{{if .Exhausted}}used up, {{end}}{{.Downloads}} of {{.MaxDownloads}} downloads{{else}}{{.Downloads}} downloads{{end}}</td>
+    <td>{{.CreatedBy}}</td>
+    <td>
+      <form method="post" action="{{url "/shares/revoke"}}">
+        <input type="hidden" name="csrf" value="{{$.CSRFToken}}">
+        <input type="hidden" name="token" value="{{.Token}}">
+        <button type="submit">revoke</button>
+      </form>
+    </td>
+  </tr>
+  {{end}}
+</table>`
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withShares enables sharing with an in-memory store holding shares.
+func withShares(t *testing.T, shares ...*Share) {
+	t.Helper()
+	enabled, file, store := enableShares, sharesFile, shareStore.shares
+	t.Cleanup(func() { enableShares, sharesFile, shareStore.shares = enabled, file, store })
+	enableShares, sharesFile, shareStore.shares = true, "", map[string]*Share{}
+	for _, s := range shares {
+		shareStore.shares[s.Token] = s
+	}
+}
+
+func sharedRequest(method, target, rng string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	if rng != "" {
+		r.Header.Set("Range", rng)
+	}
+	w := httptest.NewRecorder()
+	sharedHandler(w, r)
+	return w
+}
+
+func TestClaimShareDownload(t *testing.T) {
+	withShares(t,
+		&Share{Token: "limited", Path: "/a.txt", MaxDownloads: 2},
+		&Share{Token: "unlimited", Path: "/a.txt"},
+	)
+
+	for i := range 2 {
+		if !claimShareDownload("limited") {
+			t.Fatalf("claim %d refused below the limit", i+1)
+		}
+	}
+	if claimShareDownload("limited") {
+		t.Error("claim beyond the limit accepted")
+	}
+	releaseShareDownload("limited")
+	if s, _ := lookupShare("limited"); s.Downloads != 1 || s.exhausted() {
+		t.Errorf("after a release: downloads = %d, exhausted = %v", s.Downloads, s.exhausted())
+	}
+	if !claimShareDownload("limited") {
+		t.Error("released download not claimable again")
+	}
+
+	for range 100 {
+		if !claimShareDownload("unlimited") {
+			t.Fatal("claim refused on a share without limit")
+		}
+	}
+	if claimShareDownload("missing") {
+		t.Error("claim accepted for an unknown token")
+	}
+}
+
+func TestSharedFileDownloadLimit(t *testing.T) {
+	withTestTree(t, map[string]string{"a.txt": "hello"})
+	share := &Share{Token: "tok", Path: "/a.txt", MaxDownloads: 1, Created: time.Now()}
+	withShares(t, share)
+
+	if w := sharedRequest("HEAD", "/s/tok", ""); w.Code != http.StatusOK {
+		t.Errorf("HEAD: status = %d, want 200", w.Code)
+	}
+	if w := sharedRequest("GET", "/s/tok", "bytes=2-"); w.Code != http.StatusPartialContent {
+		t.Errorf("resuming range: status = %d, want 206", w.Code)
+	}
+	if share.Downloads != 0 {
+		t.Errorf("HEAD and resumed ranges counted %d downloads", share.Downloads)
+	}
+
+	if w := sharedRequest("GET", "/s/tok", ""); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("first download: status = %d, body %q", w.Code, w.Body)
+	}
+	if share.Downloads != 1 {
+		t.Errorf("downloads = %d after a full download, want 1", share.Downloads)
+	}
+	if w := sharedRequest("GET", "/s/tok", ""); w.Code != http.StatusGone {
+		t.Errorf("download beyond the limit: status = %d, want 410", w.Code)
+	}
+	for _, rng := range []string{"bytes=0-", "bytes=1-", "bytes=-2"} {
+		if w := sharedRequest("GET", "/s/tok", rng); w.Code != http.StatusGone {
+			t.Errorf("range %s beyond the limit: status = %d, want 410", rng, w.Code)
+		}
+	}
+}
+
+func TestFailedShareDownloadIsReleased(t *testing.T) {
+	withShares(t, &Share{Token: "tok", Path: "/a.txt", MaxDownloads: 1})
+	share, _ := lookupShare("tok")
+
+	r := httptest.NewRequest("GET", "/s/tok", nil)
+	serveShareDownload(httptest.NewRecorder(), r, share, func(w http.ResponseWriter) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	if s, _ := lookupShare("tok"); s.Downloads != 0 {
+		t.Errorf("failed download counted: downloads = %d", s.Downloads)
+	}
+
+	// A client going away after the whole body was sent still used it up
+	ctx, cancel := context.WithCancel(r.Context())
+	serveShareDownload(httptest.NewRecorder(), r.WithContext(ctx), share, func(w http.ResponseWriter) {
+		w.Write([]byte("hello"))
+		cancel()
+	})
+	if s, _ := lookupShare("tok"); s.Downloads != 1 {
+		t.Errorf("completed download released: downloads = %d", s.Downloads)
+	}
+}
+
+func TestExpiredShare(t *testing.T) {
+	withTestTree(t, map[string]string{"a.txt": "hello"})
+	past := time.Now().Add(-time.Minute)
+	withShares(t, &Share{Token: "old", Path: "/a.txt", Expires: &past})
+
+	if w := sharedRequest("GET", "/s/old", ""); w.Code != http.StatusGone {
+		t.Errorf("expired share: status = %d, want 410", w.Code)
+	}
+}
+
+func TestShareableTree(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"public/a.txt":              "",
+		"public/.fbaccess":          "password: s3cret\n",
+		"public/private/.fbaccess":  "password: s3cret\n",
+		"public/private/secret.txt": "",
+		"docs/a.txt":                "",
+		"docs/hidden/b.txt":         "",
+		"open/sub/c.txt":            "",
+	})
+	aclRules = []ACLRule{
+		{Prefix: "/", Subject: "*", Perms: PermRead | PermList},
+		{Prefix: "/docs/hidden", Subject: "*", Perms: 0},
+		{Prefix: "/open/sub", Subject: "alice", Perms: PermRead | PermList | PermWrite},
+	}
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/public", false},
+		{"/public/a.txt", true},
+		{"/public/private", true},
+		{"/docs", false},
+		{"/docs/a.txt", true},
+		{"/open", true},
+	}
+	for _, tt := range tests {
+		fullPath := filepath.Join(filesDir, filepath.FromSlash(tt.path))
+		if got := shareableTree(tt.path, fullPath); got != tt.want {
+			t.Errorf("shareableTree(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestSharedTreeSkipsProtectedParts(t *testing.T) {
+	withTestTree(t, map[string]string{
+		"public/a.txt":              "hello",
+		"public/private/.fbaccess":  "password: s3cret\n",
+		"public/private/secret.txt": "secret",
+		"public/hidden/b.txt":       "hidden",
+		"outside/c.txt":             "outside",
+	})
+	if err := os.Symlink(filepath.Join("..", "outside"), filepath.Join(filesDir, "public", "link")); err != nil {
+		t.Fatal(err)
+	}
+	// Protections added after the directory was shared
+	aclRules = []ACLRule{
+		{Prefix: "/", Subject: "*", Perms: PermRead | PermList},
+		{Prefix: "/public/hidden", Subject: "*", Perms: 0},
+	}
+	withShares(t, &Share{Token: "tok", Path: "/public", Created: time.Now()})
+
+	if w := sharedRequest("GET", "/s/tok/a.txt", ""); w.Code != http.StatusOK {
+		t.Errorf("unprotected file: status = %d, want 200", w.Code)
+	}
+	for _, target := range []string{"/s/tok/private/secret.txt", "/s/tok/private/", "/s/tok/hidden/b.txt", "/s/tok/link/c.txt"} {
+		if w := sharedRequest("GET", target, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404", target, w.Code)
+		}
+	}
+
+	w := sharedRequest("GET", "/s/tok/", "")
+	if body := w.Body.String(); !strings.Contains(body, `href="a.txt"`) || strings.Contains(body, `href="private`) || strings.Contains(body, `href="hidden`) {
+		t.Errorf("listing shows protected folders or misses files:\n%s", body)
+	}
+
+	w = sharedRequest("GET", "/s/tok/?download=zip", "")
+	zr, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("zip: %v (status %d)", err, w.Code)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if !slices.Contains(names, "public/a.txt") || slices.ContainsFunc(names, func(name string) bool {
+		return strings.Contains(name, "private") || strings.Contains(name, "hidden")
+	}) {
+		t.Errorf("zip holds %v, want a.txt without the protected folders", names)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Lifetime of a signed URL when POST /sign names none
+const defaultSignedTTL = time.Hour
+
+// Key of the HMAC signing temporary URLs, from URL_SIGNING_SECRET; signed
+// URLs are disabled while it is empty
+var urlSigningKey []byte
+
+// parseSigningSecret validates URL_SIGNING_SECRET, which anyone able to
+// guess could mint links to every file.
+func parseSigningSecret(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	if len(value) < 16 {
+		return nil, errors.New("secret is too short (minimum 16 characters)")
+	}
+	return []byte(value), nil
+}
+
+// signPath returns the hex HMAC-SHA256 of "<urlPath>\n<expires>", so
+// scripts holding the secret can compute it with standard tools. urlPath is
+// the unescaped path below the base URL.
+func signPath(urlPath string, expires int64) string {
+	mac := hmac.New(sha256.New, urlSigningKey)
+	fmt.Fprintf(mac, "%s\n%d", urlPath, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURL returns the link to urlPath valid until expires.
+func signedURL(r *http.Request, urlPath string, expires time.Time) string {
+	e := expires.Unix()
+	return externalURL(r) + (&url.URL{Path: urlPath}).EscapedPath() +
+		"?expires=" + strconv.FormatInt(e, 10) + "&sig=" + signPath(urlPath, e)
+}
+
+// validSignature reports whether the request's expires and sig parameters
+// sign its path and haven't expired. Links expiring beyond
+// SIGNED_URL_MAX_TTL are refused too, even when signed by scripts holding
+// the secret, so lowering it also cuts short links already handed out.
+func validSignature(r *http.Request) bool {
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	now := time.Now()
+	if err != nil || now.Unix() >= expires || expires > now.Add(signedURLMaxTTL).Unix() {
+		return false
+	}
+	return hmac.Equal([]byte(q.Get("sig")), []byte(signPath(r.URL.Path, expires)))
+}
+
+// withSignedURLs serves requests carrying both expires and sig parameters
+// as signed links to files, without credentials: like a share's token, the
+// signature is the permission, so access files and ACLs are not consulted.
+// Other requests go on to next.
+func withSignedURLs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if q := r.URL.Query(); len(urlSigningKey) == 0 || !q.Has("expires") || !q.Has("sig") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !validSignature(r) {
+			serveError(w, r, http.StatusForbidden, "This link is invalid or has expired")
+			return
+		}
+		serveSignedFile(w, r)
+	})
+}
+
+func serveSignedFile(w http.ResponseWriter, r *http.Request) {
+	fullPath := resolvePath(r.URL.Path)
+	name := filepath.Base(fullPath)
+	if !withinRoot(fullPath) || name == accessFileName || strings.HasPrefix(name, stagingPrefix) || isIgnored(fullPath) {
+		notFound(w, r)
+		return
+	}
+	f, err := os.Open(fullPath)
+	if err != nil {
+		notFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		notFound(w, r)
+		return
+	}
+
+	fileServes.Inc()
+	release, ok := acquireTransfer(w, r, downloadSlots)
+	if !ok {
+		return
+	}
+	defer release()
+	w, done := countDownload(w)
+	defer done()
+	allowLongWrite(w)
+	// The link stops working at its expiry, caches must not outlive it
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// signHandler mints a signed URL to a file the client may read, valid for
+// the duration in expires (1h when empty), at most SIGNED_URL_MAX_TTL.
+func signHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(urlSigningKey) == 0 {
+		http.Error(w, "Signed URLs are disabled", http.StatusNotFound)
+		return
+	}
+
+	req, err := requestValues(r, "path", "expires")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	urlPath, fullPath, ok := resolveTarget(req["path"])
+	if !ok {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		http.Error(w, fmt.Sprintf("%s: no such file", urlPath), http.StatusNotFound)
+		return
+	}
+	if !checkAccess(r, filepath.Dir(fullPath)) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermRead) {
+		denyPermission(w, r)
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(min(defaultSignedTTL, signedURLMaxTTL))
+	if value := strings.TrimSpace(req["expires"]); value != "" {
+		if value == "never" {
+			http.Error(w, "Signed URLs must expire", http.StatusBadRequest)
+			return
+		}
+		t, err := parseShareExpiry(value, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		expires = *t
+	}
+	if expires.Sub(now) > signedURLMaxTTL {
+		http.Error(w, fmt.Sprintf("Signed URLs may be valid for at most %s", signedURLMaxTTL), http.StatusBadRequest)
+		return
+	}
+
+	recordAudit(r, "sign", urlPath)
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"url":     signedURL(r, urlPath, expires),
+		"path":    urlPath,
+		"expires": expires.UTC(),
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withSigningKey(t *testing.T) {
+	t.Helper()
+	key, ttl := urlSigningKey, signedURLMaxTTL
+	t.Cleanup(func() { urlSigningKey, signedURLMaxTTL = key, ttl })
+	urlSigningKey, signedURLMaxTTL = []byte("0123456789abcdef"), 24*time.Hour
+}
+
+func TestSignPath(t *testing.T) {
+	withSigningKey(t)
+	// printf '/docs/a.txt\n1767225600' | openssl dgst -sha256 -hmac 0123456789abcdef
+	want := "c7fe7bc6d8b30237f0b61c6154ede7f846f18aca6ce45f56dee221c8093e36a2"
+	if got := signPath("/docs/a.txt", 1767225600); got != want {
+		t.Errorf("signPath = %s, want %s", got, want)
+	}
+}
+
+func TestValidSignature(t *testing.T) {
+	withSigningKey(t)
+	now := time.Now()
+	valid := now.Add(time.Hour).Unix()
+	expired := now.Add(-time.Minute).Unix()
+	tooLong := now.Add(48 * time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		path    string
+		expires int64
+		sig     string
+		want    bool
+	}{
+		{"valid", "/docs/a.txt", valid, signPath("/docs/a.txt", valid), true},
+		{"expired", "/docs/a.txt", expired, signPath("/docs/a.txt", expired), false},
+		{"tampered path", "/docs/b.txt", valid, signPath("/docs/a.txt", valid), false},
+		{"tampered expiry", "/docs/a.txt", valid + 60, signPath("/docs/a.txt", valid), false},
+		{"beyond max ttl", "/docs/a.txt", tooLong, signPath("/docs/a.txt", tooLong), false},
+		{"wrong signature", "/docs/a.txt", valid, strings.Repeat("0", 64), false},
+		{"missing signature", "/docs/a.txt", valid, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := (&url.URL{Path: tt.path}).EscapedPath() + fmt.Sprintf("?expires=%d&sig=%s", tt.expires, tt.sig)
+			r := httptest.NewRequest("GET", target, nil)
+			if got := validSignature(r); got != tt.want {
+				t.Errorf("validSignature(%s) = %v, want %v", target, got, tt.want)
+			}
+		})
+	}
+
+	other := urlSigningKey
+	urlSigningKey = []byte("another secret of 16+ chars")
+	defer func() { urlSigningKey = other }()
+	r := httptest.NewRequest("GET", fmt.Sprintf("/docs/a.txt?expires=%d&sig=%s", valid, tests[0].sig), nil)
+	if validSignature(r) {
+		t.Error("signature accepted under another secret")
+	}
+}
+
+func TestWithSignedURLs(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/a.txt": "hello", "docs/.fbaccess": "password: s3cret\n"})
+	withSigningKey(t)
+	handler := withSignedURLs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	expires := time.Now().Add(time.Hour).Unix()
+	signed := func(p string) string {
+		return fmt.Sprintf("%s?expires=%d&sig=%s", p, expires, signPath(p, expires))
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"signed file", "GET", signed("/docs/a.txt"), http.StatusOK},
+		{"tampered path", "GET", strings.Replace(signed("/docs/a.txt"), "a.txt", "b.txt", 1), http.StatusForbidden},
+		{"access file", "GET", signed("/docs/.fbaccess"), http.StatusNotFound},
+		{"directory", "GET", signed("/docs"), http.StatusNotFound},
+		{"post", "POST", signed("/docs/a.txt"), http.StatusMethodNotAllowed},
+		{"unsigned request", "GET", "/docs/a.txt", http.StatusTeapot},
+		{"sig without expires", "GET", "/docs/a.txt?sig=abc", http.StatusTeapot},
+		{"post with sig only", "POST", "/docs/a.txt?sig=abc", http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != "hello" {
+				t.Errorf("body = %q, want the file", w.Body)
+			}
+		})
+	}
+
+	urlSigningKey = nil
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", signed("/docs/a.txt"), nil))
+	if w.Code != http.StatusTeapot {
+		t.Errorf("signed URL without a signing key: status = %d, want it passed on", w.Code)
+	}
+}
+
+func TestSignHandlerMaxTTL(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/a.txt": "hello"})
+	withSigningKey(t)
+
+	sign := func(expires string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"path": "/docs/a.txt", "expires": %q}`, expires)
+		r := httptest.NewRequest("POST", "/sign", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		signHandler(w, r)
+		return w
+	}
+
+	w := sign("2h")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expires 2h: status = %d, body %s", w.Code, w.Body)
+	}
+	var resp struct{ URL string }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	link, err := url.Parse(resp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := httptest.NewRequest("GET", link.RequestURI(), nil); !validSignature(r) {
+		t.Errorf("minted URL %s does not verify", resp.URL)
+	}
+
+	for _, expires := range []string{"25h", "7d", "never"} {
+		if w := sign(expires); w.Code != http.StatusBadRequest {
+			t.Errorf("expires %s: status = %d, want 400", expires, w.Code)
+		}
+	}
+}
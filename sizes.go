@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Cookie set by the footer button to keep the chosen size units
+const unitsCookie = "filebrowser-units"
+
+// parseSizeUnits validates the SIZE_UNITS setting.
+func parseSizeUnits(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value != "binary" && value != "si" {
+		return "", fmt.Errorf("unknown size units %q, expected binary or si", value)
+	}
+	return value, nil
+}
+
+// requestSizeUnits returns the units saved in the request's cookie, or
+// SIZE_UNITS.
+func requestSizeUnits(r *http.Request) string {
+	if cookie, err := r.Cookie(unitsCookie); err == nil && (cookie.Value == "binary" || cookie.Value == "si") {
+		return cookie.Value
+	}
+	return sizeUnits
+}
+
+// formatSize formats bytes in the configured units.
+func formatSize(bytes int64) string {
+	return formatSizeIn(sizeUnits, bytes)
+}
+
+// formatSizeIn formats bytes in SI units, where a MB is 10^6 bytes, or in
+// binary ones, where a MiB is 2^20.
+func formatSizeIn(units string, bytes int64) string {
+	unit, prefixes, suffix := int64(1024), "KMGTPE", "iB"
+	if units == "si" {
+		unit, prefixes, suffix = 1000, "kMGTPE", "B"
+	}
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := unit, 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %c%s", float64(bytes)/float64(div), prefixes[exp], suffix)
+}
+
+// formatExactSize returns bytes with thousands separators in lang, like
+// "1,234,567 bytes", for the size cells' tooltips.
+func formatExactSize(lang string, bytes int64) string {
+	digits := strconv.FormatInt(bytes, 10)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 && digits[i-1] != '-' {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return translate(lang, "%s bytes", b.String())
+}
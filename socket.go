@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// First file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// systemdListener returns the listening socket passed by systemd through
+// LISTEN_FDS, or nil when the process was not socket-activated. Only the
+// first socket is used.
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+	// Keep the variables from leaking into child processes
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	f := os.NewFile(uintptr(listenFDsStart), "systemd-socket")
+	defer f.Close()
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("LISTEN_FDS socket: %w", err)
+	}
+	return listener, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Listing order from ?sort=name|size|mtime&order=asc|desc
+type ListingSort struct {
+	Key   string
+	Order string
+	// Encoded per_page and hidden parameters of the request, kept by the
+	// column headers' links
+	keep string
+}
+
+var defaultSort = ListingSort{Key: "name", Order: "asc"}
+
+// parseListingSort reads the sort parameters, defaulting to ascending by name
+// and to the key's natural order when only sort is given.
+func parseListingSort(r *http.Request) (ListingSort, error) {
+	s := defaultSort
+	keep := url.Values{}
+	for _, name := range []string{"per_page", "hidden"} {
+		if value := r.URL.Query().Get(name); value != "" {
+			keep.Set(name, value)
+		}
+	}
+	s.keep = keep.Encode()
+	if key := r.URL.Query().Get("sort"); key != "" {
+		switch key {
+		case "name", "size", "mtime":
+		default:
+			return s, fmt.Errorf("invalid sort %q, expected name, size or mtime", key)
+		}
+		s.Key, s.Order = key, naturalOrder(key)
+	}
+	if order := r.URL.Query().Get("order"); order != "" {
+		if order != "asc" && order != "desc" {
+			return s, fmt.Errorf("invalid order %q, expected asc or desc", order)
+		}
+		s.Order = order
+	}
+	return s, nil
+}
+
+// naturalOrder is the first order used when sorting by key: biggest and
+// newest first, names alphabetically.
+func naturalOrder(key string) string {
+	if key == "name" {
+		return "asc"
+	}
+	return "desc"
+}
+
+// isDefault reports whether s is the default order.
+func (s ListingSort) isDefault() bool {
+	return s.Key == defaultSort.Key && s.Order == defaultSort.Order
+}
+
+// Query returns the query string selecting s, empty for the default order.
+func (s ListingSort) Query() string {
+	if s.isDefault() {
+		return ""
+	}
+	return "?" + url.Values{"sort": {s.Key}, "order": {s.Order}}.Encode()
+}
+
+// URL links a column header: clicking the current key flips the order.
+// The page size and dotfiles choice of the request are kept, the page is not.
+func (s ListingSort) URL(key string) string {
+	next := ListingSort{Key: key, Order: naturalOrder(key)}
+	if key == s.Key && s.Order == next.Order {
+		if next.Order == "asc" {
+			next.Order = "desc"
+		} else {
+			next.Order = "asc"
+		}
+	}
+	values, _ := url.ParseQuery(s.keep)
+	if !next.isDefault() {
+		values.Set("sort", next.Key)
+		values.Set("order", next.Order)
+	}
+	if len(values) == 0 {
+		return "?"
+	}
+	return "?" + values.Encode()
+}
+
+// AriaSort is the aria-sort attribute of a column header, empty for the
+// columns the listing is not sorted by.
+func (s ListingSort) AriaSort(key string) string {
+	if key != s.Key {
+		return ""
+	}
+	if s.Order == "asc" {
+		return "ascending"
+	}
+	return "descending"
+}
+
+// Indicator marks the sorted column header.
+func (s ListingSort) Indicator(key string) string {
+	if key != s.Key {
+		return ""
+	}
+	if s.Order == "asc" {
+		return "▲"
+	}
+	return "▼"
+}
+
+// sortedInfos stats entries and orders them by s, directories first and
+// ties by name. When sorting by size, directories use their cached recursive
+// size if DIR_SIZES is enabled and sort by name otherwise.
+func sortedInfos(entries []os.DirEntry, dirPath string, s ListingSort) []fs.FileInfo {
+	infos := make([]fs.FileInfo, 0, len(entries))
+	var dirSizes map[string]int64
+	if s.Key == "size" && enableDirSizes {
+		dirSizes = make(map[string]int64)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		info = resolveLink(dirPath, info)
+		infos = append(infos, info)
+		if dirSizes != nil && info.IsDir() {
+			dirSizes[info.Name()], _ = cachedDirSize(filepath.Join(dirPath, info.Name()))
+		}
+	}
+
+	sizeOf := func(info fs.FileInfo) int64 {
+		if info.IsDir() {
+			return dirSizes[info.Name()]
+		}
+		return info.Size()
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.IsDir() != b.IsDir() {
+			return a.IsDir()
+		}
+		var c int
+		switch s.Key {
+		case "size":
+			c = cmp.Compare(sizeOf(a), sizeOf(b))
+		case "mtime":
+			c = a.ModTime().Compare(b.ModTime())
+		}
+		if c == 0 {
+			c = strings.Compare(a.Name(), b.Name())
+		}
+		if s.Order == "desc" {
+			return c > 0
+		}
+		return c < 0
+	})
+	return infos
+}
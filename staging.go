@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Prefix of in-progress uploads written next to their destination when no
+// staging directory is configured. Such files are hidden from listings.
+const stagingPrefix = ".fb-upload-"
+
+// stageUpload writes src to a temporary file and moves it to finalPath once
+// the copy has completed and passed the virus scan, so clients never see
+// partially written or rejected files. A file it replaces is kept as a
+// version when versioning is on.
+func stageUpload(src io.Reader, finalPath string) (int64, error) {
+	dir := uploadTmpDir
+	if dir == "" {
+		dir = filepath.Dir(finalPath)
+	}
+
+	tmp, err := os.CreateTemp(dir, stagingPrefix+"*")
+	if err != nil {
+		return 0, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	n, err := io.Copy(tmp, src)
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if err := scanFile(tmpPath); err != nil {
+		return n, err
+	}
+
+	if err := keepVersion(finalPath); err != nil {
+		slog.Error("Unable to keep the previous version", "path", finalPath, "err", err)
+	}
+
+	return n, moveFile(tmpPath, finalPath)
+}
+
+// moveFile renames src to dst, falling back to copying through a temporary
+// file in the destination directory when they live on different devices.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), stagingPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	os.Chmod(out.Name(), info.Mode().Perm())
+	if err := os.Rename(out.Name(), dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// withinRoot reports whether fullPath stays inside filesDir, or one of the
+// symlinkRoots, once symlinks are resolved. Paths that do not exist yet,
+// like upload targets, are judged by their closest existing parent.
+func withinRoot(fullPath string) bool {
+	root, err := realPath(filesDir)
+	if err != nil {
+		return false
+	}
+	real, err := realPath(fullPath)
+	if err != nil {
+		return false
+	}
+	if isUnder(real, root) {
+		return true
+	}
+	for _, allowed := range symlinkRoots {
+		if isUnder(real, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// realURLPath returns where fullPath lies below filesDir once symlinks are
+// resolved, as a URL path, or false when it resolves outside filesDir.
+func realURLPath(fullPath string) (string, bool) {
+	root, err := realPath(filesDir)
+	if err != nil {
+		return "", false
+	}
+	real, err := realPath(fullPath)
+	if err != nil || !isUnder(real, root) {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, real)
+	if err != nil {
+		return "", false
+	}
+	return path.Clean("/" + filepath.ToSlash(rel)), true
+}
+
+func isUnder(p, root string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// parseSymlinkRoots resolves the FOLLOW_SYMLINKS directories to real paths.
+func parseSymlinkRoots(value string) ([]string, error) {
+	var roots []string
+	for _, dir := range splitList(value) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return nil, err
+		}
+		if real, err = filepath.Abs(real); err != nil {
+			return nil, err
+		}
+		roots = append(roots, real)
+	}
+	return roots, nil
+}
+
+// realPath resolves the symlinks in fullPath, keeping missing trailing
+// components as they are.
+func realPath(fullPath string) (string, error) {
+	fullPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for {
+		real, err := filepath.EvalSymlinks(fullPath)
+		if err == nil {
+			return filepath.Join(append([]string{real}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(fullPath)
+		if parent == fullPath {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(fullPath)}, missing...)
+		fullPath = parent
+	}
+}
+
+// Symlink entry described by its target, which lies inside the root or an
+// allowed symlink root
+type resolvedLink struct {
+	fs.FileInfo
+}
+
+func (l resolvedLink) Mode() fs.FileMode {
+	return l.FileInfo.Mode() | fs.ModeSymlink
+}
+
+// resolveLink describes a symlink in dirPath by its target when the target
+// exists inside the root or an allowed symlink root. Other symlinks keep
+// their own info and show up as broken links.
+func resolveLink(dirPath string, info fs.FileInfo) fs.FileInfo {
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return info
+	}
+	target := filepath.Join(dirPath, info.Name())
+	if !withinRoot(target) {
+		return info
+	}
+	if targetInfo, err := os.Stat(target); err == nil {
+		return resolvedLink{targetInfo}
+	}
+	return info
+}
+
+// isBrokenLink reports whether info is a symlink resolveLink could not follow.
+func isBrokenLink(info fs.FileInfo) bool {
+	_, resolved := info.(resolvedLink)
+	return info.Mode()&fs.ModeSymlink != 0 && !resolved
+}
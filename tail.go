@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tailPollInterval = 500 * time.Millisecond
+	// Bytes shown from the end of the file when a client first connects
+	tailInitialBytes = 8 << 10
+	// Most bytes sent per poll; a larger backlog is skipped
+	tailMaxBytes = 64 << 10
+	// Client reconnect delay in milliseconds
+	tailRetry = 2000
+)
+
+// isTextFile sniffs the start of the file for a text/* content type.
+func isTextFile(fullPath string) bool {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	return n == 0 || strings.HasPrefix(http.DetectContentType(head[:n]), "text/")
+}
+
+// serveTail shows a page following the file, or streams appended lines as
+// Server-Sent Events to an EventSource. Event ids are byte offsets, so a
+// reconnecting client resumes where it left off via Last-Event-ID.
+func serveTail(w http.ResponseWriter, r *http.Request, fullPath, urlPath string) {
+	if !isTextFile(fullPath) {
+		http.Error(w, "Only text files can be tailed", http.StatusUnsupportedMediaType)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		name := filepath.Base(fullPath)
+		serveDocument(w, r, urlPath, Document{
+			Content: template.HTML(`<pre id="tail" class="tail"></pre>`),
+			Script:  template.JS(tailScript),
+			Actions: []Crumb{{Label: "open", URL: name}},
+		})
+		return
+	}
+
+	allowLongWrite(w)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	f, err := os.Open(fullPath)
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	offset := max(info.Size()-tailInitialBytes, 0)
+	if id, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && id >= 0 && id <= info.Size() {
+		offset = id
+	} else if offset > 0 {
+		// Start at a line boundary
+		offset = nextLineStart(f, offset)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", tailRetry)
+	flusher.Flush()
+
+	buf := make([]byte, tailMaxBytes)
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+	for {
+		info, err := f.Stat()
+		if err != nil {
+			return
+		}
+		size := info.Size()
+		if size < offset {
+			fmt.Fprintf(w, "event: truncated\nid: 0\ndata: \n\n")
+			offset = 0
+		}
+		if size-offset > tailMaxBytes {
+			fmt.Fprintf(w, "event: skipped\ndata: %d\n\n", size-offset-tailMaxBytes)
+			offset = nextLineStart(f, size-tailMaxBytes)
+		}
+		if size > offset {
+			n, _ := f.ReadAt(buf[:size-offset], offset)
+			chunk := buf[:n]
+			// Hold back a partial last line until it is complete
+			if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+				chunk = chunk[:i+1]
+			} else if n < tailMaxBytes {
+				chunk = nil
+			}
+			if len(chunk) > 0 {
+				offset += int64(len(chunk))
+				fmt.Fprintf(w, "id: %d\n", offset)
+				for _, line := range strings.Split(strings.TrimSuffix(string(chunk), "\n"), "\n") {
+					fmt.Fprintf(w, "data: %s\n", strings.TrimSuffix(line, "\r"))
+				}
+				fmt.Fprintf(w, "\n")
+			}
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextLineStart returns the offset just past the first newline at or after
+// offset, or offset itself when there is none nearby.
+func nextLineStart(f *os.File, offset int64) int64 {
+	buf := make([]byte, 4096)
+	n, _ := f.ReadAt(buf, offset)
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return offset + int64(i) + 1
+	}
+	return offset
+}
+
+const tailScript = `
+    const output = document.getElementById('tail');
+    const main = document.querySelector('main');
+    const source = new EventSource(location.pathname + '?tail=1');
+    function append(text) {
+      const follow = main.scrollTop + main.clientHeight >= main.scrollHeight - 5;
+      output.appendChild(document.createTextNode(text));
+      if (follow) main.scrollTop = main.scrollHeight;
+    }
+    source.onmessage = e => append(e.data + '\n');
+    source.addEventListener('truncated', () => append('--- file truncated ---\n'));
+    source.addEventListener('skipped', e => append('--- skipped ' + e.data + ' bytes ---\n'));
+`
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Files in TEMPLATES_DIR replacing the embedded listing and document pages
+const (
+	listingTemplateFile  = "index.html"
+	documentTemplateFile = "document.html"
+)
+
+// Contents of the .html files in templatesDir by file name, read once at
+// startup
+var templateOverrides map[string]string
+
+// loadTemplateOverrides reads the .html files of dir. index.html and
+// document.html replace whole pages; any other file holds {{define}} blocks
+// replacing those of the same name, like "rows", "head" or "style".
+func loadTemplateOverrides(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".html") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		overrides[entry.Name()] = string(data)
+	}
+	return overrides, nil
+}
+
+// parseBlockOverrides adds the block files of templateOverrides to tmpl in
+// name order, after the pages, so their definitions win.
+func parseBlockOverrides(tmpl *template.Template) error {
+	names := make([]string, 0, len(templateOverrides))
+	for name := range templateOverrides {
+		if name != listingTemplateFile && name != documentTemplateFile {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := tmpl.New(name).Parse(templateOverrides[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Themes the pages can be shown in, in the order the footer button cycles
+// through them. classic follows the system's light or dark preference.
+var themes = []string{"classic", "light", "dark", "compact", "high-contrast", "solarized"}
+
+// parseTheme validates the THEME setting.
+func parseTheme(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !slices.Contains(themes, value) {
+		return "", fmt.Errorf("unknown theme %q, expected one of %s", value, strings.Join(themes, ", "))
+	}
+	return value, nil
+}
+
+// Cookie set by the footer button to keep the chosen theme across pages
+const themeCookie = "filebrowser-theme"
+
+// requestTheme returns the data-theme attribute of a page: the theme saved
+// in the request's cookie, or THEME. It is empty for classic, which has no
+// attribute.
+func requestTheme(r *http.Request) string {
+	name := theme
+	if cookie, err := r.Cookie(themeCookie); err == nil && slices.Contains(themes, cookie.Value) {
+		name = cookie.Value
+	}
+	if name == "classic" {
+		return ""
+	}
+	return name
+}
+
+// serveThemeCSS serves the variable sets of the themes beyond the classic
+// light and dark ones, which are part of the pages' own styles.
+func serveThemeCSS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, "theme.css", startTime, strings.NewReader(themeCSS))
+}
+
+const themeCSS = `[data-theme="compact"] {
+  --font-size: 12px;
+  --cell-padding: 2px 4px;
+  --table-margin: 4px;
+  --footer-height: 24px;
+}
+
+[data-theme="high-contrast"] {
+  --bg-color: #000;
+  --text-color: #fff;
+  --header-bg: #000;
+  --border-color: #fff;
+  --border-light: #aaa;
+  --row-even: #000;
+  --footer-bg: #000;
+  --footer-text: #fff;
+}
+[data-theme="high-contrast"] a { color: #ff0; }
+[data-theme="high-contrast"] a:visited { color: #0ff; }
+
+[data-theme="solarized"] {
+  --bg-color: #fdf6e3;
+  --text-color: #586e75;
+  --header-bg: #eee8d5;
+  --border-color: #93a1a1;
+  --border-light: #eee8d5;
+  --row-even: #f7f0dc;
+  --footer-bg: #eee8d5;
+  --footer-text: #839496;
+}
+@media (prefers-color-scheme: dark) {
+  [data-theme="solarized"] {
+    --bg-color: #002b36;
+    --text-color: #93a1a1;
+    --header-bg: #073642;
+    --border-color: #586e75;
+    --border-light: #073642;
+    --row-even: #03313c;
+    --footer-bg: #073642;
+    --footer-text: #657b83;
+  }
+}
+[data-theme="solarized"] a { color: #268bd2; }
+[data-theme="solarized"] a:visited { color: #6c71c4; }
+`
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	thumbDefaultWidth = 200
+	thumbMinWidth     = 16
+	thumbMaxWidth     = 1024
+	// Sources above these limits are not decoded
+	thumbMaxSourceBytes  = 50 << 20
+	thumbMaxSourcePixels = 50_000_000
+	thumbPruneInterval   = 10 * time.Minute
+)
+
+var thumbExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+}
+
+// Bounds concurrent decodes, which are CPU and memory heavy
+var thumbSlots = make(chan struct{}, max(runtime.NumCPU()/2, 1))
+
+// Wakes the pruner after new thumbnails were written
+var thumbPruneTrigger = make(chan struct{}, 1)
+
+func hasThumbnail(name string) bool {
+	return thumbExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// thumbHandler serves GET /thumb/<path>?w=200, generating the thumbnail on
+// first request and serving it from the cache afterwards.
+func thumbHandler(w http.ResponseWriter, r *http.Request) {
+	if !enableThumbnails {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath, fullPath, ok := resolveTarget(strings.TrimPrefix(r.URL.Path, "/thumb"))
+	if !ok || !hasThumbnail(fullPath) {
+		http.NotFound(w, r)
+		return
+	}
+	if !checkAccess(r, filepath.Dir(fullPath)) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermRead) {
+		denyPermission(w, r)
+		return
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if info.Size() > thumbMaxSourceBytes {
+		http.Error(w, "Image too large for a thumbnail", http.StatusUnprocessableEntity)
+		return
+	}
+
+	width := thumbDefaultWidth
+	if value := r.URL.Query().Get("w"); value != "" {
+		width, err = strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid width", http.StatusBadRequest)
+			return
+		}
+		width = min(max(width, thumbMinWidth), thumbMaxWidth)
+	}
+
+	cachePath := thumbCachePath(fullPath, info, width)
+	if _, err := os.Stat(cachePath); err != nil {
+		if err := generateThumbnail(fullPath, cachePath, width); err != nil {
+			slog.Warn("Unable to create thumbnail", "path", fullPath, "err", err)
+			http.Error(w, "Unable to create thumbnail", http.StatusUnprocessableEntity)
+			return
+		}
+	} else {
+		// Keep recently used thumbnails ahead of eviction
+		now := time.Now()
+		os.Chtimes(cachePath, now, now)
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeFile(w, r, cachePath)
+}
+
+// thumbCachePath derives the cache file from the source path, its size and
+// mtime, so modified images get a fresh thumbnail.
+func thumbCachePath(fullPath string, info fs.FileInfo, width int) string {
+	key := fmt.Sprintf("%s\x00%d\x00%d\x00%d", fullPath, info.Size(), info.ModTime().UnixNano(), width)
+	sum := sha256.Sum256([]byte(key))
+	ext := ".jpg"
+	if strings.EqualFold(filepath.Ext(fullPath), ".png") {
+		ext = ".png"
+	}
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(thumbCacheDir, name[:2], name+ext)
+}
+
+func generateThumbnail(srcPath, cachePath string, width int) error {
+	thumbSlots <- struct{}{}
+	defer func() { <-thumbSlots }()
+
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return err
+	}
+	if config.Width*config.Height > thumbMaxSourcePixels {
+		return fmt.Errorf("image is %dx%d pixels", config.Width, config.Height)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return err
+	}
+
+	bounds := src.Bounds()
+	dst := src
+	if bounds.Dx() > width {
+		height := max(bounds.Dy()*width/bounds.Dx(), 1)
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, bounds, draw.Over, nil)
+		dst = scaled
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), stagingPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if filepath.Ext(cachePath) == ".png" {
+		err = png.Encode(tmp, dst)
+	} else {
+		err = jpeg.Encode(tmp, dst, &jpeg.Options{Quality: 80})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return err
+	}
+
+	select {
+	case thumbPruneTrigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pruneThumbnails evicts the least recently used thumbnails whenever the
+// cache grows past thumbCacheSize.
+func pruneThumbnails() {
+	job := registerJob("thumbnail cache")
+	for {
+		job.Run(func() error {
+			type cached struct {
+				path    string
+				size    int64
+				touched time.Time
+			}
+			var files []cached
+			var total int64
+			err := filepath.WalkDir(thumbCacheDir, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return nil
+				}
+				files = append(files, cached{p, info.Size(), info.ModTime()})
+				total += info.Size()
+				return nil
+			})
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if total <= thumbCacheSize {
+				return nil
+			}
+
+			sort.Slice(files, func(i, j int) bool {
+				return files[i].touched.Before(files[j].touched)
+			})
+			for _, file := range files {
+				if total <= thumbCacheSize {
+					break
+				}
+				if err := os.Remove(file.path); err == nil {
+					total -= file.size
+				}
+			}
+			return nil
+		})
+
+		select {
+		case <-thumbPruneTrigger:
+		case <-time.After(thumbPruneInterval):
+		}
+	}
+}
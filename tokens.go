@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// API tokens keyed by the SHA-256 of the token, so lookups don't leak the
+// token through timing.
+var apiTokens = map[[sha256.Size]byte]*Identity{}
+
+// addAPIToken registers token for the identity name with optional roles.
+func addAPIToken(name, token string, roles []string) error {
+	if name == "" || token == "" {
+		return fmt.Errorf("token entries need a name and a token")
+	}
+	if len(token) < 16 {
+		return fmt.Errorf("token for %s is too short (minimum 16 characters)", name)
+	}
+	apiTokens[sha256.Sum256([]byte(token))] = &Identity{Name: name, Roles: roles}
+	return nil
+}
+
+// parseAPITokens reads "name:token" pairs separated by commas, as used by the
+// API_TOKENS env var.
+func parseAPITokens(value string) error {
+	for _, entry := range splitList(value) {
+		name, token, _ := strings.Cut(entry, ":")
+		if err := addAPIToken(name, token, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAPITokens reads a tokens file with one "name token [role,...]" entry
+// per line.
+func loadAPITokens(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return fmt.Errorf("%s:%d: expected name token [roles]", path, lineNo)
+		}
+		var roles []string
+		if len(fields) == 3 {
+			roles = splitList(fields[2])
+		}
+		if err := addAPIToken(fields[0], fields[1], roles); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func lookupAPIToken(token string) *Identity {
+	return apiTokens[sha256.Sum256([]byte(token))]
+}
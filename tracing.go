@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Spans are no-ops until setupTracing installs an exporting provider
+var tracer = otel.Tracer("github.com/francorbacho/filebrowser")
+
+// setupTracing exports spans over OTLP/HTTP to otlpEndpoint, sampling
+// traceSampleRatio of the requests that do not carry a sampling decision
+// from their caller.
+func setupTracing() error {
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(otlpEndpoint))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint %q: %w", otlpEndpoint, err)
+	}
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(attribute.String("service.name", "filebrowser")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return err
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(traceSampleRatio))),
+	))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return nil
+}
+
+// withTracing starts a server span for every request, continuing the trace
+// of callers sending a traceparent header.
+func withTracing(h http.Handler) http.Handler {
+	return otelhttp.NewHandler(h, "filebrowser", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method
+	}))
+}
+
+// startSpan starts a span for an operation of the request r. The returned
+// request carries the span so nested operations become its children.
+func startSpan(r *http.Request, name string, attrs ...attribute.KeyValue) (*http.Request, trace.Span) {
+	ctx, span := tracer.Start(r.Context(), name, trace.WithAttributes(attrs...))
+	return r.WithContext(ctx), span
+}
+
+// endSpan ends span, marking it failed when err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
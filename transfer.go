@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// Slots for simultaneous transfers; nil means unlimited
+	uploadSlots   chan struct{}
+	downloadSlots chan struct{}
+)
+
+func newTransferSlots(limit int) chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+	return make(chan struct{}, limit)
+}
+
+// acquireTransfer takes one of slots, waiting up to transferQueueTimeout
+// for a transfer to finish. When none frees up, or the client goes away,
+// it answers 503 and reports false. The returned function gives the slot
+// back.
+func acquireTransfer(w http.ResponseWriter, r *http.Request, slots chan struct{}) (func(), bool) {
+	if slots == nil {
+		return func() {}, true
+	}
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	if transferQueueTimeout > 0 {
+		timer := time.NewTimer(transferQueueTimeout)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+			return release, true
+		case <-r.Context().Done():
+			return nil, false
+		case <-timer.C:
+		}
+	}
+	transfersRejected.Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds()))
+	serveError(w, r, http.StatusServiceUnavailable, "Too many transfers in progress, try again later")
+	return nil, false
+}
+
+func retryAfterSeconds() int {
+	return max(int(transferQueueTimeout.Seconds()), 5)
+}
+
+func formatTransferLimits() string {
+	limit := func(slots chan struct{}) string {
+		if slots == nil {
+			return "unlimited"
+		}
+		return fmt.Sprintf("%d/%d", len(slots), cap(slots))
+	}
+	return fmt.Sprintf("uploads %s, downloads %s, queue %s",
+		limit(uploadSlots), limit(downloadSlots), transferQueueTimeout)
+}
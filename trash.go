@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// trashBatch names the trash directory receiving the entries of one delete
+// request.
+func trashBatch() string {
+	return time.Now().UTC().Format("20060102-150405.000000000")
+}
+
+// removeTree deletes the file or directory at fullPath. With a trash
+// configured it is moved into the batch directory there instead, below its
+// URL path, so it can be restored by hand until the trash is purged.
+func removeTree(batch, urlPath, fullPath string) error {
+	if trashDir == "" {
+		return os.RemoveAll(fullPath)
+	}
+	dst := filepath.Join(trashDir, batch, filepath.FromSlash(strings.TrimPrefix(urlPath, "/")))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return err
+	}
+	return moveTree(fullPath, dst)
+}
+
+// trashUsage returns the number of delete batches in the trash and their
+// total size.
+func trashUsage() (int, int64, error) {
+	entries, err := os.ReadDir(trashDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := dirSize(trashDir)
+	return len(entries), size, err
+}
+
+// purgeTrash permanently removes everything in the trash, returning the
+// number of delete batches removed.
+func purgeTrash() (int, error) {
+	entries, err := os.ReadDir(trashDir)
+	if err != nil {
+		return 0, err
+	}
+	for i, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(trashDir, entry.Name())); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
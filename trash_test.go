@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeleteMovesToTrash(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/report.txt": "draft"})
+	defer func(dir string) { trashDir = dir }(trashDir)
+	trashDir = t.TempDir()
+
+	if w := deleteRequest("/docs", "report.txt"); w.Code != http.StatusSeeOther {
+		t.Fatalf("delete: status = %d, body %s", w.Code, w.Body)
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, "docs", "report.txt")); !os.IsNotExist(err) {
+		t.Errorf("deleted file still in the files dir: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(trashDir, "*", "docs", "report.txt"))
+	if len(matches) != 1 {
+		t.Fatalf("trash holds %v, want the file below its original path", matches)
+	}
+	if data, _ := os.ReadFile(matches[0]); string(data) != "draft" {
+		t.Errorf("trashed content = %q", data)
+	}
+	if batches, size, err := trashUsage(); err != nil || batches != 1 || size != 5 {
+		t.Errorf("trashUsage = %d, %d, %v, want 1 batch of 5 bytes", batches, size, err)
+	}
+}
+
+func TestAdminPurgeTrash(t *testing.T) {
+	defer func(dir, user, pass string) { trashDir, adminUser, adminPass = dir, user, pass }(trashDir, adminUser, adminPass)
+	trashDir, adminUser, adminPass = t.TempDir(), "admin", "pw"
+	if err := os.MkdirAll(filepath.Join(trashDir, "20240501-100000.000000000", "docs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", "/admin/trash/purge", nil)
+	w := httptest.NewRecorder()
+	adminPurgeTrashHandler(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("purge without admin credentials: status = %d, want 401", w.Code)
+	}
+
+	r = httptest.NewRequest("POST", "/admin/trash/purge", nil)
+	r.SetBasicAuth("admin", "pw")
+	w = httptest.NewRecorder()
+	adminPurgeTrashHandler(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("purge: status = %d, body %s", w.Code, w.Body)
+	}
+	if entries, err := os.ReadDir(trashDir); err != nil || len(entries) != 0 {
+		t.Errorf("trash after purge holds %v, %v", entries, err)
+	}
+}
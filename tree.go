@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Subdirectory in the tree sidebar
+type TreeNode struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Whether expanding the node would show anything
+	HasChildren bool `json:"hasChildren"`
+}
+
+// Children of a directory in the tree sidebar
+type TreeChildren struct {
+	Path string     `json:"path"`
+	Dirs []TreeNode `json:"dirs"`
+}
+
+// treeHandler serves GET /tree?path=<dir>, the subdirectories of dir the
+// client may list, so the sidebar loads one level at a time as nodes are
+// expanded.
+func treeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Query().Get("path"))
+	dirPath := resolvePath(urlPath)
+	if !withinRoot(dirPath) {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		writeJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !checkAccess(r, dirPath) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermList) {
+		denyPermission(w, r)
+		return
+	}
+
+	entries, err := readDirectory(dirPath)
+	if err != nil {
+		serverError(w, "Error reading directory", err)
+		return
+	}
+	entries = filterIgnored(filterDotfiles(r, entries), dirPath)
+
+	children := TreeChildren{Path: strings.TrimSuffix(urlPath, "/") + "/", Dirs: []TreeNode{}}
+	for _, info := range sortedInfos(entries, dirPath, defaultSort) {
+		if !info.IsDir() {
+			continue
+		}
+		childURL := children.Path + info.Name() + "/"
+		childPath := filepath.Join(dirPath, info.Name())
+		if !checkAccess(r, childPath) || !permitted(r, childURL, PermList) {
+			continue
+		}
+		children.Dirs = append(children.Dirs, TreeNode{
+			Name:        info.Name(),
+			Path:        childURL,
+			HasChildren: hasSubdirectory(childPath),
+		})
+	}
+	writeJSON(w, http.StatusOK, children)
+}
+
+// hasSubdirectory reports whether dir contains a directory, reading it in
+// batches so huge flat directories stop at the first one.
+func hasSubdirectory(dir string) bool {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	for {
+		entries, err := f.ReadDir(256)
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), stagingPrefix) {
+				return true
+			}
+		}
+		// io.EOF once the directory is exhausted
+		if err != nil {
+			return false
+		}
+	}
+}
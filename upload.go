@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Outcome of saving one uploaded file
+type UploadResult struct {
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+	status int
+}
+
+func uploadHandler(w http.ResponseWriter, r *http.Request) {
+	// The write deadline runs from the request headers, so it would also
+	// bound the time spent receiving a large upload
+	allowLongWrite(w)
+
+	if !enableUpload {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		http.Error(w, "File uploads are disabled", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "POST" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if readOnly.Load() {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		http.Error(w, "Server is in read-only mode", http.StatusForbidden)
+		return
+	}
+
+	release, ok := acquireTransfer(w, r, uploadSlots)
+	if !ok {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		return
+	}
+	defer release()
+
+	if maxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			uploadTooLarge(w)
+			return
+		}
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	targetDir := r.FormValue("dir")
+	if targetDir == "" {
+		targetDir = "/"
+	}
+
+	fullPath := resolvePath(filepath.Clean(targetDir))
+	if !checkAccess(r, fullPath) {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		denyAccess(w, r)
+		return
+	}
+
+	headers := r.MultipartForm.File["file"]
+	// Folder uploads send each file's relative path in a parallel field, as
+	// multipart parsing only keeps the base name.
+	relPaths := r.MultipartForm.Value["path"]
+	if len(relPaths) != len(headers) {
+		relPaths = nil
+	}
+	if len(headers) == 0 {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		http.Error(w, "Invalid upload", http.StatusBadRequest)
+		return
+	}
+	// Checked before creating the directory; uploadTarget checks each file
+	if !permitted(r, path.Clean("/"+targetDir), PermWrite) || !withinRoot(fullPath) {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		denyPermission(w, r)
+		return
+	}
+	if err := os.MkdirAll(fullPath, os.ModePerm); err != nil {
+		uploadsTotal.Inc()
+		uploadsError.Inc()
+		serverError(w, "Error creating "+targetDir, err)
+		return
+	}
+
+	results := make([]UploadResult, 0, len(headers))
+	for i, header := range headers {
+		uploadsTotal.Inc()
+		relPath := header.Filename
+		if relPaths != nil {
+			relPath = relPaths[i]
+		}
+		result := saveMultipartFile(r, targetDir, fullPath, relPath, header)
+		if result.Error != "" {
+			uploadsError.Inc()
+		} else {
+			uploadsSuccess.Inc()
+			uploadCompleted(r, result)
+		}
+		results = append(results, result)
+	}
+
+	respondUpload(w, r, targetDir, results)
+}
+
+// sanitizeRelPath splits a client supplied relative path into normalized
+// segments, rejecting traversal and reserved names.
+func sanitizeRelPath(relPath string) ([]string, bool) {
+	var segments []string
+	for _, segment := range strings.FieldsFunc(relPath, func(c rune) bool { return c == '/' || c == '\\' }) {
+		segment = normalizeName(segment)
+		switch {
+		case segment == ".":
+			continue
+		case segment == "..", segment == accessFileName, strings.HasPrefix(segment, stagingPrefix):
+			return nil, false
+		}
+		segments = append(segments, segment)
+	}
+	return segments, len(segments) > 0
+}
+
+// uploadTarget validates an upload to relPath inside dirPath and returns
+// the final file path, creating intermediate directories for folder uploads.
+// The returned result carries an error when the upload must be rejected.
+func uploadTarget(r *http.Request, targetDir, dirPath, relPath string) (string, UploadResult) {
+	result := UploadResult{Name: relPath}
+	fail := func(status int, message string) (string, UploadResult) {
+		result.status = status
+		result.Error = message
+		return "", result
+	}
+
+	segments, ok := sanitizeRelPath(relPath)
+	if !ok {
+		return fail(http.StatusBadRequest, "Invalid file name")
+	}
+	if !uploadTypes.allowsName(segments[len(segments)-1]) {
+		return fail(http.StatusUnsupportedMediaType, "Unsupported file type")
+	}
+
+	// Reuse existing names that only differ in Unicode normalization
+	finalPath := dirPath
+	for _, segment := range segments {
+		if existing, ok := findEquivalentName(finalPath, segment); ok {
+			segment = existing
+		}
+		finalPath = filepath.Join(finalPath, segment)
+	}
+	rel, _ := filepath.Rel(dirPath, finalPath)
+	result.Path = path.Join(path.Clean("/"+targetDir), filepath.ToSlash(rel))
+
+	if !permitted(r, result.Path, PermWrite) || !checkAccess(r, filepath.Dir(finalPath)) {
+		return fail(http.StatusForbidden, "Forbidden")
+	}
+
+	if !withinRoot(finalPath) {
+		return fail(http.StatusForbidden, "Invalid file path")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(finalPath), os.ModePerm); err != nil {
+		slog.Error("Unable to create directories for upload", "path", finalPath, "err", err)
+		return fail(http.StatusInternalServerError, "Error saving file")
+	}
+	return finalPath, result
+}
+
+// saveUpload stores src at relPath inside dirPath.
+func saveUpload(r *http.Request, targetDir, dirPath, relPath string, src io.Reader) UploadResult {
+	finalPath, result := uploadTarget(r, targetDir, dirPath, relPath)
+	if result.Error != "" {
+		return result
+	}
+	return storeUpload(r, finalPath, result, src)
+}
+
+// storeUpload writes src to finalPath as validated by uploadTarget, which
+// returned result.
+func storeUpload(r *http.Request, finalPath string, result UploadResult, src io.Reader) UploadResult {
+	src, ok := uploadTypes.sniffUpload(src)
+	if !ok {
+		result.status = http.StatusUnsupportedMediaType
+		result.Error = "Unsupported file type"
+		return result
+	}
+
+	replaced := existingSize(finalPath)
+	src = limitQuota(src, result.Path, replaced)
+
+	hash := sha256.New()
+	_, span := startSpan(r, "upload copy", attribute.String("path", result.Path))
+	n, err := stageUpload(io.TeeReader(src, hash), finalPath)
+	span.SetAttributes(attribute.Int64("bytes", n))
+	endSpan(span, err)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		var infected *InfectedError
+		switch {
+		case errors.As(err, &tooLarge):
+			result.status = http.StatusRequestEntityTooLarge
+			result.Error = uploadTooLargeMessage()
+			return result
+		case errors.Is(err, errQuotaExceeded):
+			result.status = http.StatusInsufficientStorage
+			result.Error = "Storage quota exceeded"
+			return result
+		case errors.As(err, &infected):
+			slog.Info("Rejected upload", "path", result.Path, "err", err)
+			result.status = http.StatusUnprocessableEntity
+			result.Error = "File rejected by virus scanner: " + infected.Signature
+			return result
+		case errors.Is(err, errScanFailed):
+			slog.Info("Rejected upload", "path", result.Path, "err", err)
+			result.status = http.StatusServiceUnavailable
+			result.Error = "Virus scan unavailable, try again later"
+			return result
+		}
+		slog.Error("Unable to save upload", "path", finalPath, "err", err)
+		result.status = http.StatusInternalServerError
+		result.Error = "Error saving file"
+		return result
+	}
+	addQuotaUsage(result.Path, n-replaced)
+	result.Size = n
+	result.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return result
+}
+
+// saveMultipartFile stores one file of a multipart upload.
+func saveMultipartFile(r *http.Request, targetDir, dirPath, relPath string, header *multipart.FileHeader) UploadResult {
+	file, err := header.Open()
+	if err != nil {
+		return UploadResult{Name: relPath, Error: "Invalid upload", status: http.StatusBadRequest}
+	}
+	defer file.Close()
+	return saveUpload(r, targetDir, dirPath, relPath, file)
+}
+
+// uploadCompleted records a successfully stored upload.
+func uploadCompleted(r *http.Request, result UploadResult) {
+	countUpload(result.Size)
+	recordAudit(r, "upload", result.Path)
+	notifyWebhooks(r, WebhookEvent{Event: "upload", Path: result.Path, Size: result.Size, SHA256: result.SHA256})
+	indexUpload(result.Path)
+}
+
+// respondUpload reports the per-file results: JSON for API clients, a
+// redirect back to the listing when everything was saved, and a plain text
+// summary otherwise.
+func respondUpload(w http.ResponseWriter, r *http.Request, targetDir string, results []UploadResult) {
+	failed := 0
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			status = result.status
+		}
+	}
+	if failed > 0 && failed < len(results) {
+		status = http.StatusMultiStatus
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]any{"files": results})
+		return
+	}
+
+	if failed == 0 {
+		http.Redirect(w, r, targetDir, http.StatusSeeOther)
+		return
+	}
+	if len(results) == 1 {
+		http.Error(w, results[0].Error, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Fprintf(w, "%s: %s\n", result.Name, result.Error)
+		} else {
+			fmt.Fprintf(w, "%s: saved\n", result.Name)
+		}
+	}
+}
+
+func uploadTooLargeMessage() string {
+	return fmt.Sprintf("File too large (maximum upload size is %s)", formatSize(maxUploadSize))
+}
+
+func uploadTooLarge(w http.ResponseWriter) {
+	http.Error(w, uploadTooLargeMessage(), http.StatusRequestEntityTooLarge)
+}
+
+// putHandler stores the raw request body at the request path, so that
+// "curl -T file http://host/dir/file" works. It answers 201 for new files
+// and 204 when an existing file was replaced.
+func putHandler(w http.ResponseWriter, r *http.Request) {
+	allowLongWrite(w)
+
+	uploadsTotal.Inc()
+	fail := func(message string, status int) {
+		uploadsError.Inc()
+		http.Error(w, message, status)
+	}
+
+	if !enableUpload {
+		fail("File uploads are disabled", http.StatusForbidden)
+		return
+	}
+	if readOnly.Load() {
+		fail("Server is in read-only mode", http.StatusForbidden)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		fail("PUT needs a file path", http.StatusBadRequest)
+		return
+	}
+	release, ok := acquireTransfer(w, r, uploadSlots)
+	if !ok {
+		uploadsError.Inc()
+		return
+	}
+	defer release()
+	if maxUploadSize > 0 {
+		if r.ContentLength > maxUploadSize {
+			fail(uploadTooLargeMessage(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	}
+
+	targetDir, name := path.Split(path.Clean("/" + r.URL.Path))
+	dirPath := resolvePath(targetDir)
+	if !checkAccess(r, dirPath) {
+		uploadsError.Inc()
+		denyAccess(w, r)
+		return
+	}
+
+	finalPath, result := uploadTarget(r, targetDir, dirPath, name)
+	if result.Error != "" {
+		if result.status == http.StatusForbidden {
+			uploadsError.Inc()
+			denyPermission(w, r)
+			return
+		}
+		fail(result.Error, result.status)
+		return
+	}
+	if info, err := os.Stat(finalPath); err == nil && info.IsDir() {
+		fail("Cannot replace a directory", http.StatusConflict)
+		return
+	}
+	_, statErr := os.Stat(finalPath)
+	existed := statErr == nil
+
+	result = storeUpload(r, finalPath, result, r.Body)
+	if result.Error != "" {
+		fail(result.Error, result.status)
+		return
+	}
+
+	uploadsSuccess.Inc()
+	uploadCompleted(r, result)
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Location", result.Path)
+	w.WriteHeader(http.StatusCreated)
+}
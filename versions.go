@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Earlier content of a file, kept when an upload replaced it
+type FileVersion struct {
+	ID       string    `json:"id"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// Kept versions of a file, newest first
+type FileHistory struct {
+	Path     string        `json:"path"`
+	Versions []FileVersion `json:"versions"`
+}
+
+// versionDir returns the directory of versionsDir holding the versions of
+// the file at fullPath. It is named after a hash of the path relative to
+// the files dir, so no file name can collide with another's versions.
+func versionDir(fullPath string) string {
+	rel, err := filepath.Rel(filesDir, fullPath)
+	if err != nil {
+		rel = fullPath
+	}
+	sum := sha256.Sum256([]byte(filepath.ToSlash(rel)))
+	return filepath.Join(versionsDir, hex.EncodeToString(sum[:]))
+}
+
+// keepVersion preserves the file at fullPath before an upload replaces it,
+// then drops all but the newest keepVersions versions. Nothing is kept for
+// new files or when versioning is off.
+func keepVersion(fullPath string) error {
+	if keepVersions <= 0 {
+		return nil
+	}
+	info, err := os.Lstat(fullPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+
+	dir := versionDir(fullPath)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	versionPath := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10))
+	// A copy rather than a hard link, which would share the inode with a file
+	// later written in place
+	if err := copyVersion(fullPath, versionPath); err != nil {
+		os.Remove(versionPath)
+		return err
+	}
+	os.Chtimes(versionPath, info.ModTime(), info.ModTime())
+
+	versions, err := listVersions(fullPath)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions[min(keepVersions, len(versions)):] {
+		os.Remove(filepath.Join(dir, v.ID))
+	}
+	return nil
+}
+
+func copyVersion(src, dst string) error {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = copyFileTo(out, src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// walkVersioned calls fn for every regular file in the tree at root, when
+// versioning is on.
+func walkVersioned(root string, fn func(fullPath string) error) {
+	if keepVersions <= 0 {
+		return
+	}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return fn(p)
+	})
+	if err != nil {
+		slog.Warn("Unable to update kept versions", "path", root, "err", err)
+	}
+}
+
+// treeVersionDirs returns the version directories of the files in the tree
+// at fullPath, collected before deleting it.
+func treeVersionDirs(fullPath string) []string {
+	var dirs []string
+	walkVersioned(fullPath, func(p string) error {
+		dirs = append(dirs, versionDir(p))
+		return nil
+	})
+	return dirs
+}
+
+// dropVersions removes the version directories of deleted files, so a new
+// file at the same path starts without their history.
+func dropVersions(dirs []string) {
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			slog.Warn("Unable to remove kept versions", "path", dir, "err", err)
+		}
+	}
+}
+
+// moveVersions carries the kept versions of the files moved from the tree
+// at src along to the tree at dst, once the move is done.
+func moveVersions(src, dst string) {
+	walkVersioned(dst, func(p string) error {
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		to := versionDir(p)
+		// Left over from an earlier file at the destination
+		if err := os.RemoveAll(to); err != nil {
+			return err
+		}
+		err = os.Rename(versionDir(filepath.Join(src, rel)), to)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// listVersions returns the kept versions of the file at fullPath, newest
+// first.
+func listVersions(fullPath string) ([]FileVersion, error) {
+	entries, err := os.ReadDir(versionDir(fullPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return []FileVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]FileVersion, 0, len(entries))
+	for _, entry := range entries {
+		if _, err := strconv.ParseInt(entry.Name(), 10, 64); err != nil || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, FileVersion{ID: entry.Name(), Size: info.Size(), Modified: info.ModTime()})
+	}
+	slices.SortFunc(versions, func(a, b FileVersion) int {
+		x, _ := strconv.ParseInt(a.ID, 10, 64)
+		y, _ := strconv.ParseInt(b.ID, 10, 64)
+		return cmp.Compare(y, x)
+	})
+	return versions, nil
+}
+
+// findVersion returns the version of the file at fullPath with the given
+// ID, which is only accepted when listed so it can't name another file.
+func findVersion(fullPath, id string) (string, bool) {
+	versions, err := listVersions(fullPath)
+	if err != nil {
+		return "", false
+	}
+	for _, v := range versions {
+		if v.ID == id {
+			return filepath.Join(versionDir(fullPath), id), true
+		}
+	}
+	return "", false
+}
+
+// versionsHandler serves GET /versions?path=<file>, the file's history as
+// JSON or as a page with download and restore buttons, and with &id= the
+// content of one version.
+func versionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if keepVersions <= 0 {
+		http.Error(w, "File versioning is disabled", http.StatusNotFound)
+		return
+	}
+
+	urlPath, fullPath, ok := resolveTarget(r.URL.Query().Get("path"))
+	if !ok {
+		notFound(w, r)
+		return
+	}
+	if !checkAccess(r, filepath.Dir(fullPath)) {
+		denyAccess(w, r)
+		return
+	}
+	if !permitted(r, urlPath, PermRead) {
+		denyPermission(w, r)
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		versionPath, ok := findVersion(fullPath, id)
+		if !ok {
+			notFound(w, r)
+			return
+		}
+		f, err := os.Open(versionPath)
+		if err != nil {
+			notFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			serverError(w, "Error reading version", err)
+			return
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(urlPath)}))
+		http.ServeContent(w, r, path.Base(urlPath), info.ModTime(), f)
+		return
+	}
+
+	versions, err := listVersions(fullPath)
+	if err != nil {
+		serverError(w, "Error reading versions", err)
+		return
+	}
+	history := FileHistory{Path: urlPath, Versions: versions}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, history)
+		return
+	}
+	serveHistory(w, r, history)
+}
+
+// restoreVersionHandler puts a kept version back in place of the file. The
+// content it replaces becomes a version itself, so a restore can be undone.
+func restoreVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !checkWritable(w) {
+		return
+	}
+	if keepVersions <= 0 {
+		http.Error(w, "File versioning is disabled", http.StatusNotFound)
+		return
+	}
+
+	req, err := requestValues(r, "path", "id")
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	urlPath, fullPath, ok := resolveTarget(req["path"])
+	if !ok {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if !canModify(r, urlPath, fullPath) {
+		denyPermission(w, r)
+		return
+	}
+	if info, err := os.Lstat(fullPath); err == nil && !info.Mode().IsRegular() {
+		http.Error(w, "Cannot replace a directory", http.StatusConflict)
+		return
+	}
+	if info, err := os.Stat(filepath.Dir(fullPath)); err != nil || !info.IsDir() {
+		http.Error(w, "Destination directory does not exist", http.StatusNotFound)
+		return
+	}
+	versionPath, ok := findVersion(fullPath, req["id"])
+	if !ok {
+		http.Error(w, "No such version", http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(versionPath)
+	if err != nil {
+		serverError(w, "Error reading version", err)
+		return
+	}
+	defer f.Close()
+	replaced := existingSize(fullPath)
+	n, err := stageUpload(limitQuota(f, urlPath, replaced), fullPath)
+	if errors.Is(err, errQuotaExceeded) {
+		http.Error(w, "Storage quota exceeded", http.StatusInsufficientStorage)
+		return
+	}
+	if err != nil {
+		serverError(w, "Error restoring "+urlPath, err)
+		return
+	}
+	addQuotaUsage(urlPath, n-replaced)
+	indexUpload(urlPath)
+
+	recordAudit(r, "restore", urlPath+" @ "+req["id"])
+	respondDone(w, r, http.StatusOK, urlPath)
+}
+
+var historyTmpl = template.Must(template.New("history").Funcs(template.FuncMap{
+	"formatSize": formatSize,
+	"formatDate": formatDate,
+	"url":        prefixURL,
+}).Parse(historyTemplate))
+
+func serveHistory(w http.ResponseWriter, r *http.Request, history FileHistory) {
+	var buf bytes.Buffer
+	data := struct {
+		FileHistory
+		CSRFToken string
+		Writable  bool
+	}{history, csrfToken(w, r), enableUpload && !readOnly.Load()}
+	if err := historyTmpl.Execute(&buf, data); err != nil {
+		slog.Error("Error rendering history", "err", err)
+		http.Error(w, "Error rendering page", http.StatusInternalServerError)
+		return
+	}
+	name := path.Base(history.Path)
+	dirURL := strings.TrimSuffix(path.Dir(history.Path), "/") + "/"
+	serveDocument(w, r, history.Path, Document{
+		Content:     template.HTML(buf.String()),
+		Name:        name + " history",
+		Breadcrumbs: append(buildBreadcrumbs(dirURL), Crumb{Label: name, URL: name}, Crumb{Label: " 🕓 history", URL: ""}),
+		Actions:     []Crumb{{Label: "back", URL: prefixURL(dirURL)}},
+	})
+}
+
+const historyTemplate = `<p class="search-summary">{{len .Versions}} earlier version{{if ne (len .Versions) 1}}s{{end}} of {{.Path}}</p>
+<table class="search-results">
+  {{range .Versions}}
+  <tr>
+    <td class="date">{{formatDate .Modified}}</td>
+    <td class="size">{{formatSize .Size}}</td>
+    <td><a href="{{url "/versions"}}?path={{$.Path}}&amp;id={{.ID}}">download</a></td>
+    {{if $.Writable}}<td>
+      <form method="post" action="{{url "/versions/restore"}}">
+        <input type="hidden" name="csrf" value="{{$.CSRFToken}}">
+        <input type="hidden" name="path" value="{{$.Path}}">
+        <input type="hidden" name="id" value="{{.ID}}">
+        <button type="submit">restore</button>
+      </form>
+    </td>{{end}}
+  </tr>
+  {{end}}
+</table>`
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func withVersions(t *testing.T) {
+	t.Helper()
+	keep, dir := keepVersions, versionsDir
+	t.Cleanup(func() { keepVersions, versionsDir = keep, dir })
+	keepVersions, versionsDir = 3, t.TempDir()
+}
+
+func TestKeepVersionCopies(t *testing.T) {
+	withTestTree(t, map[string]string{"notes.txt": "first"})
+	withVersions(t)
+	fullPath := filepath.Join(filesDir, "notes.txt")
+
+	if err := keepVersion(fullPath); err != nil {
+		t.Fatal(err)
+	}
+	// Writing the file in place must not change the kept version
+	if err := os.WriteFile(fullPath, []byte("second"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := listVersions(fullPath)
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("listVersions = %v, %v, want one version", versions, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(versionDir(fullPath), versions[0].ID))
+	if string(data) != "first" {
+		t.Errorf("kept version = %q, want %q", data, "first")
+	}
+}
+
+func TestDeleteDropsVersions(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/a.txt": "old"})
+	withVersions(t)
+	fullPath := filepath.Join(filesDir, "docs", "a.txt")
+	if err := keepVersion(fullPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := deleteRequest("/", "docs"); w.Code != http.StatusSeeOther {
+		t.Fatalf("delete: status = %d, body %s", w.Code, w.Body)
+	}
+	if versions, _ := listVersions(fullPath); len(versions) != 0 {
+		t.Errorf("a new file at the deleted path inherits %d versions", len(versions))
+	}
+}
+
+func TestRenameMovesVersions(t *testing.T) {
+	withTestTree(t, map[string]string{"docs/a.txt": "old"})
+	withVersions(t)
+	fromPath := filepath.Join(filesDir, "docs", "a.txt")
+	if err := keepVersion(fromPath); err != nil {
+		t.Fatal(err)
+	}
+
+	form := url.Values{"from": {"/docs"}, "to": {"/archive"}}
+	r := httptest.NewRequest("POST", "/rename", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	renameHandler(w, r)
+	if w.Code != http.StatusSeeOther && w.Code != http.StatusOK {
+		t.Fatalf("rename: status = %d, body %s", w.Code, w.Body)
+	}
+	if versions, _ := listVersions(fromPath); len(versions) != 0 {
+		t.Errorf("old path still has %d versions", len(versions))
+	}
+	if versions, _ := listVersions(filepath.Join(filesDir, "archive", "a.txt")); len(versions) != 1 {
+		t.Errorf("renamed file has %d versions, want 1", len(versions))
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	webhookQueueSize = 1000
+	webhookAttempts  = 5
+	webhookTimeout   = 10 * time.Second
+)
+
+// Payload posted to the webhook URLs
+type WebhookEvent struct {
+	Event    string    `json:"event"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size,omitempty"`
+	SHA256   string    `json:"sha256,omitempty"`
+	ClientIP string    `json:"clientIp"`
+	User     string    `json:"user,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+var (
+	webhookQueue  = make(chan WebhookEvent, webhookQueueSize)
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+)
+
+// notifyWebhooks queues event for delivery without blocking the request.
+func notifyWebhooks(r *http.Request, event WebhookEvent) {
+	if len(webhookURLs) == 0 {
+		return
+	}
+	event.ClientIP = clientIP(r)
+	event.Time = time.Now().UTC()
+	if id := requestIdentity(r); id != nil {
+		event.User = id.Name
+	}
+	select {
+	case webhookQueue <- event:
+	default:
+		slog.Warn("Webhook queue full, dropping event", "event", event.Event, "path", event.Path)
+	}
+}
+
+// deliverWebhooks sends queued events to every URL, retrying failed
+// deliveries with exponential backoff.
+func deliverWebhooks() {
+	for event := range webhookQueue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			slog.Error("Unable to encode webhook event", "err", err)
+			continue
+		}
+		for _, url := range webhookURLs {
+			backoff := time.Second
+			for attempt := 1; ; attempt++ {
+				err := postWebhook(url, body)
+				if err == nil {
+					break
+				}
+				if attempt == webhookAttempts {
+					slog.Warn("Giving up on webhook", "url", url, "attempts", attempt, "err", err)
+					break
+				}
+				time.Sleep(backoff)
+				backoff *= 2
+			}
+		}
+	}
+}
+
+func postWebhook(url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "filebrowser/"+GitCommit)
+	if webhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(webhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Filebrowser-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}